@@ -1,20 +1,66 @@
 package main
 
 import (
+	"context"
+	"crypto"
 	"fmt"
+	jwtdecode "github.com/fgb-andu/hustl-api/internal"
 	"github.com/fgb-andu/hustl-api/pkg/api"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/fgb-andu/hustl-api/pkg/repository/cacheprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/configprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/conversationprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/eventprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/experimentprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/fallbackprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/goalprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/nudgeprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/personaprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/planprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/promptprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/sessionprovider"
 	"github.com/fgb-andu/hustl-api/pkg/repository/userprovider"
 	"github.com/fgb-andu/hustl-api/pkg/service/chat"
+	"github.com/fgb-andu/hustl-api/pkg/service/nudge"
+	"github.com/fgb-andu/hustl-api/pkg/service/session"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func main() {
-	// Get OpenAI API key from environment
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		log.Fatal("OPENAI_API_KEY environment variable is required")
+	// Select the LLM backend from environment; defaults to OpenAI
+	providerConfig := chat.ProviderConfig{
+		Backend: os.Getenv("LLM_PROVIDER"),
+		APIKey:  os.Getenv("LLM_API_KEY"),
+		BaseURL: os.Getenv("LLM_BASE_URL"),
+	}
+	if providerConfig.Backend == "" {
+		providerConfig.Backend = chat.BackendOpenAI
+	}
+	if providerConfig.APIKey == "" {
+		switch providerConfig.Backend {
+		case chat.BackendOpenAI:
+			providerConfig.APIKey = os.Getenv("OPENAI_API_KEY")
+		case chat.BackendAnthropic:
+			providerConfig.APIKey = os.Getenv("ANTHROPIC_API_KEY")
+		}
+	}
+
+	model := os.Getenv("LLM_MODEL")
+	if model == "" {
+		model = chat.DefaultModel(providerConfig.Backend)
+	}
+	if model == "" {
+		log.Fatal("LLM_MODEL environment variable is required for the " + providerConfig.Backend + " backend")
+	}
+
+	llmProvider, err := chat.NewProvider(providerConfig)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	// Get port from environment or use default
@@ -24,7 +70,8 @@ func main() {
 	}
 
 	// Initialize GPT service
-	service := chat.NewGPTService(apiKey)
+	log.Printf("Using %s backend with model %s", llmProvider.Name(), model)
+	service := chat.NewGPTService(llmProvider, model)
 
 	provider, err := userprovider.NewUserProvider(userprovider.Config{
 		DatabasePath:   "./users.db",
@@ -34,8 +81,112 @@ func main() {
 		log.Fatal(err)
 	}
 	defer provider.Close()
+
+	// Conversations, events, personas, experiments, prompts, action plans,
+	// goals, nudges, fallback messages and the model config live in the same
+	// database as users
+	conversations := conversationprovider.NewConversationProvider(provider.DB())
+	events := eventprovider.NewEventProvider(provider.DB())
+	personas := personaprovider.NewPersonaProvider(provider.DB())
+	service.SetPersonas(personas)
+	experiments := experimentprovider.NewExperimentProvider(provider.DB())
+	service.SetVariants(experiments)
+
+	prompts := promptprovider.NewPromptProvider(provider.DB())
+	prompt, err := loadActivePrompt(prompts, service.InitialPrompt())
+	if err != nil {
+		log.Fatal(err)
+	}
+	service.SetPromptVersion(prompt.ID, prompt.Content)
+	log.Printf("Using prompt version %d", prompt.Version)
+
+	plans := planprovider.NewPlanProvider(provider.DB())
+	goals := goalprovider.NewGoalProvider(provider.DB())
+	service.SetGoals(goals)
+	nudges := nudgeprovider.NewNudgeProvider(provider.DB())
+	fallbacks := fallbackprovider.NewFallbackProvider(provider.DB())
+	service.SetFallbacks(fallbacks)
+
+	configs := configprovider.NewConfigProvider(provider.DB())
+	if stored, err := configs.GetModelConfig(); err == nil {
+		service.UpdateConfig(chat.ConfigFromModel(*stored))
+		log.Printf("Using stored model config for %s", stored.Model)
+	} else if err != configprovider.ErrConfigNotFound {
+		log.Fatal(err)
+	}
+
+	policies, err := moderationPolicies(providerConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Results are cached below moderation so cached replies are still
+	// checked
+	var handlerService chat.Service = service
+	cacheOptions, err := resultCacheOptions()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cacheOptions.TTL > 0 {
+		results := cacheprovider.NewCacheProvider(provider.DB())
+		if expired, err := results.DeleteExpiredResults(); err != nil {
+			log.Println(err.Error())
+		} else if expired > 0 {
+			log.Printf("Deleted %d expired cached results", expired)
+		}
+		cached, err := chat.NewCachedService(service, results, cacheOptions)
+		if err != nil {
+			log.Fatal(err)
+		}
+		handlerService = cached
+		log.Printf("Caching up to %d results in memory for %s", cacheOptions.Size, cacheOptions.TTL)
+	}
+	if len(policies) > 0 {
+		handlerService = chat.NewModeratedService(handlerService, events, os.Getenv("MODERATION_REPLACEMENT"), policies...)
+		log.Printf("Moderation enabled with %d policies", len(policies))
+	}
+
+	// Nudges go through the same moderation as replies
+	nudgeInterval, err := nudgeSchedulerInterval()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if nudgeInterval > 0 {
+		scheduler := nudge.NewScheduler(chat.Nudger(handlerService), nudges, provider, events, nudge.LogNotifier{}, nudgeInterval)
+		go scheduler.Run(context.Background())
+		log.Printf("Checking for due nudges every %s", nudgeInterval)
+	}
+
+	// Identity tokens are verified against the keys the providers publish,
+	// refreshed in the background before they expire
+	auth, err := identityVerifiers()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, verifier := range []*jwtdecode.Verifier{auth.Apple, auth.Google} {
+		if verifier != nil {
+			go verifier.Keys.Run(context.Background())
+		}
+	}
+
+	// Once signed in, users authenticate with access tokens we sign
+	// ourselves; their refresh tokens live in the same database as users
+	sessions := sessionprovider.NewSessionProvider(provider.DB())
+	if expired, err := sessions.DeleteExpiredRefreshTokens(); err != nil {
+		log.Println(err.Error())
+	} else if expired > 0 {
+		log.Printf("Deleted %d expired refresh tokens", expired)
+	}
+	if auth.Sessions, err = sessionManager(sessions); err != nil {
+		log.Fatal(err)
+	}
+
+	// ADMIN_API_KEY authorizes the admin routes; without it they are closed
+	if auth.AdminKey = os.Getenv("ADMIN_API_KEY"); auth.AdminKey == "" {
+		log.Println("Admin routes are disabled: ADMIN_API_KEY is not set")
+	}
+
 	// Initialize handler with service
-	handler := api.NewHandler(service, provider)
+	handler := api.NewHandler(handlerService, provider, conversations, events, personas, prompts, configs, experiments, plans, goals, nudges, fallbacks, auth)
 
 	// Get router
 	router := handler.Router()
@@ -48,3 +199,222 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// loadActivePrompt returns the active prompt version. On first start it stores
+// the built-in prompt as version 1.
+func loadActivePrompt(prompts *promptprovider.PromptProvider, builtin string) (*domain.PromptVersion, error) {
+	active, err := prompts.GetActivePromptVersion()
+	if err != promptprovider.ErrNoActivePrompt {
+		return active, err
+	}
+
+	version, err := prompts.CreatePromptVersion(builtin, "system", "Built-in prompt")
+	if err != nil {
+		return nil, err
+	}
+	return prompts.ActivatePromptVersion(version.ID)
+}
+
+// moderationPolicies builds the moderation policies configured in the
+// environment. MODERATION_OPENAI_ACTION enables the OpenAI moderation
+// endpoint and MODERATION_RULES_FILE a local rule list; each takes flag,
+// replace or block.
+func moderationPolicies(providerConfig chat.ProviderConfig) ([]chat.ModerationPolicy, error) {
+	var policies []chat.ModerationPolicy
+
+	if action := os.Getenv("MODERATION_OPENAI_ACTION"); action != "" {
+		if !chat.ModerationAction(action).Valid() {
+			return nil, fmt.Errorf("invalid MODERATION_OPENAI_ACTION %q", action)
+		}
+		apiKey := os.Getenv("OPENAI_API_KEY")
+		if apiKey == "" && providerConfig.Backend == chat.BackendOpenAI {
+			apiKey = providerConfig.APIKey
+		}
+		if apiKey == "" {
+			return nil, fmt.Errorf("OPENAI_API_KEY is required for OpenAI moderation")
+		}
+		policies = append(policies, chat.ModerationPolicy{
+			Moderator: chat.NewOpenAIModerator(apiKey, os.Getenv("MODERATION_OPENAI_MODEL"), nil),
+			Action:    chat.ModerationAction(action),
+		})
+	}
+
+	if path := os.Getenv("MODERATION_RULES_FILE"); path != "" {
+		action := chat.ModerationAction(os.Getenv("MODERATION_RULES_ACTION"))
+		if action == "" {
+			action = chat.ModerationBlock
+		}
+		if !action.Valid() {
+			return nil, fmt.Errorf("invalid MODERATION_RULES_ACTION %q", action)
+		}
+		rules, err := chat.LoadModerationRules(path)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, chat.ModerationPolicy{
+			Moderator: chat.NewRuleModerator("rules", rules),
+			Action:    action,
+		})
+	}
+
+	return policies, nil
+}
+
+// resultCacheOptions reads RESULT_CACHE_SIZE, the number of results kept in
+// memory, and RESULT_CACHE_TTL, a duration such as "6h". A TTL of 0 turns
+// the cache off.
+func resultCacheOptions() (chat.CacheOptions, error) {
+	options := chat.CacheOptions{
+		Size: chat.DefaultCacheSize,
+		TTL:  chat.DefaultCacheTTL,
+	}
+
+	if v := os.Getenv("RESULT_CACHE_SIZE"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size <= 0 {
+			return options, fmt.Errorf("invalid RESULT_CACHE_SIZE %q", v)
+		}
+		options.Size = size
+	}
+	if v := os.Getenv("RESULT_CACHE_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl < 0 {
+			return options, fmt.Errorf("invalid RESULT_CACHE_TTL %q", v)
+		}
+		options.TTL = ttl
+	}
+
+	return options, nil
+}
+
+// nudgeSchedulerInterval reads NUDGE_INTERVAL, a duration such as "15m".
+// Proactive nudges are off unless it is set to more than 0.
+func nudgeSchedulerInterval() (time.Duration, error) {
+	v := os.Getenv("NUDGE_INTERVAL")
+	if v == "" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(v)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("invalid NUDGE_INTERVAL %q", v)
+	}
+	return interval, nil
+}
+
+// identityVerifiers configures sign-in with each identity provider.
+// APPLE_CLIENT_IDS and GOOGLE_CLIENT_IDS list, comma-separated, the client
+// IDs tokens must be issued to: the app's bundle ID and service IDs for
+// Apple, the iOS, Android and web client IDs for Google. A provider without
+// client IDs is disabled. APPLE_JWKS_URL and
+// GOOGLE_JWKS_URL override the providers' key sets, to test against a local
+// key server. AUTH_REQUIRE_NONCE=true rejects tokens without a nonce.
+func identityVerifiers() (api.AuthConfig, error) {
+	var auth api.AuthConfig
+	options := jwtdecode.Options{Client: &http.Client{Timeout: jwtdecode.DefaultTimeout}}
+
+	requireNonce := false
+	if v := os.Getenv("AUTH_REQUIRE_NONCE"); v != "" {
+		var err error
+		if requireNonce, err = strconv.ParseBool(v); err != nil {
+			return auth, fmt.Errorf("invalid AUTH_REQUIRE_NONCE %q", v)
+		}
+	}
+
+	if audiences := splitList(os.Getenv("APPLE_CLIENT_IDS")); len(audiences) > 0 {
+		auth.Apple = &jwtdecode.Verifier{
+			Keys:         jwtdecode.NewJWKS(envOrDefault("APPLE_JWKS_URL", jwtdecode.AppleKeysURL), options),
+			Issuers:      []string{jwtdecode.AppleIssuer},
+			Audiences:    audiences,
+			RequireNonce: requireNonce,
+			// Apple puts the SHA-256 of the nonce in the token
+			HashedNonce: true,
+		}
+	} else {
+		log.Println("Sign in with Apple is disabled: APPLE_CLIENT_IDS is not set")
+	}
+
+	if audiences := splitList(os.Getenv("GOOGLE_CLIENT_IDS")); len(audiences) > 0 {
+		auth.Google = &jwtdecode.Verifier{
+			Keys:                 jwtdecode.NewJWKS(envOrDefault("GOOGLE_JWKS_URL", jwtdecode.GoogleKeysURL), options),
+			Issuers:              []string{jwtdecode.GoogleIssuer, jwtdecode.GoogleIssuerHost},
+			Audiences:            audiences,
+			RequireNonce:         requireNonce,
+			RequireVerifiedEmail: true,
+		}
+	} else {
+		log.Println("Sign in with Google is disabled: GOOGLE_CLIENT_IDS is not set")
+	}
+
+	return auth, nil
+}
+
+// sessionManager configures the sessions we issue. AUTH_SIGNING_KEYS lists,
+// comma-separated, PEM files with ECDSA P-256 or RSA private keys. The first
+// key signs; the others only verify. To rotate, put a new key first and keep
+// the old one listed until the access tokens it signed have expired. Without
+// keys a key is generated on every start, and access tokens do not survive a
+// restart. AUTH_ISSUER names the API in the tokens; AUTH_ACCESS_TTL and
+// AUTH_REFRESH_TTL are durations such as "15m" and "720h".
+func sessionManager(store session.Store) (*session.Manager, error) {
+	options := session.Options{Issuer: os.Getenv("AUTH_ISSUER")}
+	if v := os.Getenv("AUTH_ACCESS_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid AUTH_ACCESS_TTL %q", v)
+		}
+		options.AccessTTL = ttl
+	}
+	if v := os.Getenv("AUTH_REFRESH_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid AUTH_REFRESH_TTL %q", v)
+		}
+		options.RefreshTTL = ttl
+	}
+
+	var privates []crypto.Signer
+	for _, path := range splitList(os.Getenv("AUTH_SIGNING_KEYS")) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key: %w", err)
+		}
+		private, err := jwtdecode.ParsePrivateKeyPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing key %s: %w", path, err)
+		}
+		privates = append(privates, private)
+	}
+	if len(privates) == 0 {
+		log.Println("AUTH_SIGNING_KEYS is not set: signing access tokens with a temporary key")
+		private, err := jwtdecode.GenerateSigningKey()
+		if err != nil {
+			return nil, err
+		}
+		privates = append(privates, private)
+	}
+
+	keys, err := jwtdecode.NewSigningKeys(privates...)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Signing access tokens with key %s", keys.KeyID())
+	return session.NewManager(keys, store, options), nil
+}
+
+func envOrDefault(key string, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
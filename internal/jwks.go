@@ -0,0 +1,457 @@
+package jwtdecode
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/sync/singleflight"
+)
+
+// Key sets published by the identity providers we accept.
+const (
+	AppleKeysURL  = "https://appleid.apple.com/auth/keys"
+	GoogleKeysURL = "https://www.googleapis.com/oauth2/v3/certs"
+)
+
+var (
+	ErrMissingKeyID   = errors.New("missing kid in token header")
+	ErrKeyNotFound    = errors.New("no matching public key found")
+	ErrKeyAlgorithm   = errors.New("token algorithm does not match the key")
+	ErrNoUsableKeys   = errors.New("key set contains no usable keys")
+	ErrUnsupportedKey = errors.New("unsupported key")
+)
+
+const (
+	// DefaultTTL is how long a key set is used when the response does not
+	// say with Cache-Control max-age.
+	DefaultTTL = 30 * time.Minute
+	// DefaultTimeout bounds a fetch when no client is configured.
+	DefaultTimeout = 10 * time.Second
+	// DefaultGracePeriod is how long expired keys are still used while the
+	// key set cannot be fetched, so an outage at the identity provider does
+	// not lock everyone out.
+	DefaultGracePeriod = 6 * time.Hour
+
+	// minRefreshInterval limits how often the key set is fetched, so tokens
+	// with made-up key IDs cannot make us fetch on every request.
+	minRefreshInterval = time.Minute
+	// maxKeySetSize bounds the response body.
+	maxKeySetSize = 1 << 20
+	// minRSABits rejects RSA keys too short to trust.
+	minRSABits = 2048
+)
+
+// Key is a verification key from a key set.
+type Key struct {
+	ID string
+	// Algorithm is the key's alg, or empty when the key set does not pin
+	// one and any algorithm for the key type is accepted.
+	Algorithm string
+	// Public is an *rsa.PublicKey or an *ecdsa.PublicKey on P-256.
+	Public crypto.PublicKey
+}
+
+// Options configure a JWKS. The zero value uses a client with
+// DefaultTimeout, DefaultTTL and DefaultGracePeriod.
+type Options struct {
+	Client      *http.Client
+	TTL         time.Duration
+	GracePeriod time.Duration
+}
+
+// JWKS fetches and caches the signing keys an identity provider publishes
+// as a JSON Web Key Set. It is safe for concurrent use; concurrent fetches
+// are collapsed into one request.
+type JWKS struct {
+	url         string
+	client      *http.Client
+	ttl         time.Duration
+	gracePeriod time.Duration
+
+	group singleflight.Group
+
+	mu        sync.RWMutex
+	keys      map[string]Key
+	fetchedAt time.Time
+	expiresAt time.Time
+	// failedAt is when a fetch last failed.
+	failedAt time.Time
+}
+
+func NewJWKS(url string, options Options) *JWKS {
+	if options.Client == nil {
+		options.Client = &http.Client{Timeout: DefaultTimeout}
+	}
+	if options.TTL <= 0 {
+		options.TTL = DefaultTTL
+	}
+	if options.GracePeriod <= 0 {
+		options.GracePeriod = DefaultGracePeriod
+	}
+
+	return &JWKS{
+		url:         url,
+		client:      options.Client,
+		ttl:         options.TTL,
+		gracePeriod: options.GracePeriod,
+		keys:        make(map[string]Key),
+	}
+}
+
+func (j *JWKS) URL() string {
+	return j.url
+}
+
+// Keyfunc verifies the token's signing method against the key its kid
+// names, for jwt.Parse.
+func (j *JWKS) Keyfunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, ErrMissingKeyID
+		}
+
+		key, err := j.Key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if !key.accepts(token.Method.Alg()) {
+			return nil, fmt.Errorf("%w: %s", ErrKeyAlgorithm, token.Method.Alg())
+		}
+		return key.Public, nil
+	}
+}
+
+// Key returns the key with the ID. The key set is fetched when the cached
+// one has expired, or does not have the key because the provider rotated its
+// keys. While the key set cannot be fetched, an expired key is still
+// returned for the grace period.
+func (j *JWKS) Key(ctx context.Context, kid string) (*Key, error) {
+	j.mu.RLock()
+	key, ok := j.keys[kid]
+	now := time.Now()
+	fresh := now.Before(j.expiresAt)
+	usable := now.Before(j.expiresAt.Add(j.gracePeriod))
+	fetchedAt, failedAt := j.fetchedAt, j.failedAt
+	j.mu.RUnlock()
+
+	if ok && fresh {
+		return &key, nil
+	}
+	if !ok && fresh && time.Since(fetchedAt) < minRefreshInterval {
+		return nil, ErrKeyNotFound
+	}
+	// Rather than fetch on every request while the provider is down
+	if ok && usable && time.Since(failedAt) < minRefreshInterval {
+		return &key, nil
+	}
+
+	if err := j.Refresh(ctx); err != nil {
+		if ok && usable {
+			log.Printf("Failed to refresh keys from %s, using expired key %s: %v", j.url, kid, err)
+			return &key, nil
+		}
+		return nil, err
+	}
+
+	j.mu.RLock()
+	key, ok = j.keys[kid]
+	j.mu.RUnlock()
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return &key, nil
+}
+
+// Refresh fetches the key set and replaces the cached keys. Concurrent
+// callers share a single request; a caller whose ctx is cancelled stops
+// waiting without cancelling the request for the others.
+func (j *JWKS) Refresh(ctx context.Context) error {
+	result := j.group.DoChan("refresh", func() (interface{}, error) {
+		err := j.fetch(context.WithoutCancel(ctx))
+		if err != nil {
+			j.mu.Lock()
+			j.failedAt = time.Now()
+			j.mu.Unlock()
+		}
+		return nil, err
+	})
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case res := <-result:
+		return res.Err
+	}
+}
+
+// Run keeps the key set fresh until ctx is cancelled. It refreshes shortly
+// before the keys expire, so requests rarely wait for a fetch, and retries
+// failed refreshes after a minute.
+func (j *JWKS) Run(ctx context.Context) {
+	for {
+		wait := minRefreshInterval
+		if err := j.Refresh(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Println("Failed to refresh keys from " + j.url + ": " + err.Error())
+		} else {
+			wait = j.refreshIn()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// refreshIn is the time until nine tenths of the key set's lifetime have
+// passed.
+func (j *JWKS) refreshIn() time.Duration {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	lifetime := j.expiresAt.Sub(j.fetchedAt)
+	wait := time.Until(j.fetchedAt.Add(lifetime * 9 / 10))
+	if wait < minRefreshInterval {
+		wait = minRefreshInterval
+	}
+	return wait
+}
+
+func (j *JWKS) fetch(ctx context.Context) error {
+	log.Println("Refreshing keys from " + j.url)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch public keys: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch public keys: HTTP %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxKeySetSize))
+	if err != nil {
+		return fmt.Errorf("failed to read public key response: %w", err)
+	}
+	keys, err := parseKeySet(body)
+	if err != nil {
+		return err
+	}
+
+	ttl := j.ttl
+	if maxAge, ok := cacheMaxAge(resp.Header.Get("Cache-Control")); ok {
+		ttl = maxAge
+	}
+	if ttl < minRefreshInterval {
+		ttl = minRefreshInterval
+	}
+
+	now := time.Now()
+	j.mu.Lock()
+	j.keys = keys
+	j.fetchedAt = now
+	j.expiresAt = now.Add(ttl)
+	j.mu.Unlock()
+	return nil
+}
+
+// jsonWebKey holds the members of a JWK we read and publish, per RFC 7517
+// and 7518.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// parseKeySet skips keys it cannot use, such as encryption keys, so one odd
+// key does not lock everyone out.
+func parseKeySet(body []byte) (map[string]Key, error) {
+	var keySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &keySet); err != nil {
+		return nil, fmt.Errorf("failed to parse public key JSON: %w", err)
+	}
+
+	keys := make(map[string]Key)
+	for _, jwk := range keySet.Keys {
+		key, err := parseKey(jwk)
+		if err != nil {
+			log.Printf("Skipping key %q: %v", jwk.Kid, err)
+			continue
+		}
+		keys[key.ID] = *key
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrNoUsableKeys
+	}
+	return keys, nil
+}
+
+func parseKey(jwk jsonWebKey) (*Key, error) {
+	if jwk.Kid == "" {
+		return nil, fmt.Errorf("%w: missing kid", ErrUnsupportedKey)
+	}
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return nil, fmt.Errorf("%w: use %q", ErrUnsupportedKey, jwk.Use)
+	}
+
+	var public crypto.PublicKey
+	var err error
+	switch jwk.Kty {
+	case "RSA":
+		if jwk.Alg != "" && !rsaAlgorithms[jwk.Alg] {
+			return nil, fmt.Errorf("%w: alg %q for RSA key", ErrUnsupportedKey, jwk.Alg)
+		}
+		public, err = parseRSAKey(jwk)
+	case "EC":
+		if jwk.Alg != "" && jwk.Alg != "ES256" {
+			return nil, fmt.Errorf("%w: alg %q for EC key", ErrUnsupportedKey, jwk.Alg)
+		}
+		public, err = parseECKey(jwk)
+	default:
+		return nil, fmt.Errorf("%w: kty %q", ErrUnsupportedKey, jwk.Kty)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		ID:        jwk.Kid,
+		Algorithm: jwk.Alg,
+		Public:    public,
+	}, nil
+}
+
+var rsaAlgorithms = map[string]bool{
+	"RS256": true, "RS384": true, "RS512": true,
+	"PS256": true, "PS384": true, "PS512": true,
+}
+
+func parseRSAKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+	nBytes, err := decodeBase64URL(jwk.N)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key modulus: %w", err)
+	}
+	eBytes, err := decodeBase64URL(jwk.E)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key exponent: %w", err)
+	}
+
+	n := new(big.Int).SetBytes(nBytes)
+	if n.BitLen() < minRSABits {
+		return nil, fmt.Errorf("%w: %d-bit RSA modulus", ErrUnsupportedKey, n.BitLen())
+	}
+	e := new(big.Int).SetBytes(eBytes)
+	if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("%w: RSA exponent out of range", ErrUnsupportedKey)
+	}
+
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+// parseECKey accepts P-256 keys only, the curve ES256 uses.
+func parseECKey(jwk jsonWebKey) (*ecdsa.PublicKey, error) {
+	if jwk.Crv != "P-256" {
+		return nil, fmt.Errorf("%w: curve %q", ErrUnsupportedKey, jwk.Crv)
+	}
+	x, err := decodeBase64URL(jwk.X)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key x coordinate: %w", err)
+	}
+	y, err := decodeBase64URL(jwk.Y)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key y coordinate: %w", err)
+	}
+	if len(x) != 32 || len(y) != 32 {
+		return nil, fmt.Errorf("%w: P-256 coordinates must be 32 bytes", ErrUnsupportedKey)
+	}
+
+	// NewPublicKey rejects points that are not on the curve
+	point := append([]byte{4}, append(x, y...)...)
+	if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedKey, err)
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
+
+// accepts reports whether a token signed with alg may be verified with the
+// key. Without a pinned algorithm, the key type decides.
+func (k Key) accepts(alg string) bool {
+	if k.Algorithm != "" {
+		return alg == k.Algorithm
+	}
+	switch k.Public.(type) {
+	case *rsa.PublicKey:
+		return rsaAlgorithms[alg]
+	case *ecdsa.PublicKey:
+		return alg == "ES256"
+	}
+	return false
+}
+
+// cacheMaxAge reads max-age from a Cache-Control header.
+func cacheMaxAge(header string) (time.Duration, bool) {
+	for _, directive := range strings.Split(header, ",") {
+		v, ok := strings.CutPrefix(strings.TrimSpace(strings.ToLower(directive)), "max-age=")
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	return 0, false
+}
+
+// Helper to decode Base64URL strings
+func decodeBase64URL(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(value)
+}
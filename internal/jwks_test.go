@@ -0,0 +1,421 @@
+package jwtdecode
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// keyServer publishes a key set and counts how often it is fetched.
+type keyServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	body    []byte
+	status  int
+	release chan struct{}
+
+	fetches atomic.Int32
+}
+
+func newKeyServer(t *testing.T, keys ...jsonWebKey) *keyServer {
+	t.Helper()
+
+	s := &keyServer{status: http.StatusOK}
+	s.publish(t, keys...)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+
+		s.mu.Lock()
+		body, status, release := s.body, s.status, s.release
+		s.mu.Unlock()
+
+		if release != nil {
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *keyServer) publish(t *testing.T, keys ...jsonWebKey) {
+	t.Helper()
+
+	body, err := json.Marshal(map[string][]jsonWebKey{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	s.body = body
+	s.mu.Unlock()
+}
+
+func (s *keyServer) setStatus(status int) {
+	s.mu.Lock()
+	s.status = status
+	s.mu.Unlock()
+}
+
+// jwkFor publishes the public half of private under kid, pinned to alg
+// unless alg is empty.
+func jwkFor(private crypto.Signer, kid string, alg string) jsonWebKey {
+	jwk := publicJWK(private.Public())
+	jwk.Kid = kid
+	jwk.Use = "sig"
+	jwk.Alg = alg
+	return jwk
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "user-1"})
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func generateRSAKey(t *testing.T, bits int) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func generateECKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// keyfuncError is the error Keyfunc returned to jwt.Parse, whose
+// ValidationError does not unwrap.
+func keyfuncError(err error) error {
+	var validationErr *jwt.ValidationError
+	if errors.As(err, &validationErr) && validationErr.Inner != nil {
+		return validationErr.Inner
+	}
+	return err
+}
+
+// expireKeys makes the cached key set expire at the given time, as if it
+// had been fetched well before.
+func expireKeys(j *JWKS, at time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.fetchedAt = at.Add(-j.ttl)
+	j.expiresAt = at
+}
+
+func TestJWKSVerifiesRSAAndECKeys(t *testing.T) {
+	rsaKey := generateRSAKey(t, 2048)
+	ecKey := generateECKey(t)
+	server := newKeyServer(t,
+		jwkFor(rsaKey, "rsa", "RS256"),
+		jwkFor(ecKey, "ec", "ES256"),
+		// Without alg, the key type decides
+		jwkFor(rsaKey, "rsa-any", ""),
+	)
+	keys := NewJWKS(server.URL, Options{})
+
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		kid    string
+		key    interface{}
+	}{
+		{name: "RS256", method: jwt.SigningMethodRS256, kid: "rsa", key: rsaKey},
+		{name: "ES256", method: jwt.SigningMethodES256, kid: "ec", key: ecKey},
+		{name: "PS256 without pinned alg", method: jwt.SigningMethodPS256, kid: "rsa-any", key: rsaKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := jwt.Parse(signToken(t, tt.method, tt.kid, tt.key), keys.Keyfunc(context.Background()))
+			if err != nil || !token.Valid {
+				t.Fatalf("Parse: %v", err)
+			}
+		})
+	}
+
+	if got := server.fetches.Load(); got != 1 {
+		t.Errorf("fetched %d times, want 1", got)
+	}
+}
+
+func TestJWKSRejectsUnusableKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		jwk  jsonWebKey
+	}{
+		{name: "small RSA key", jwk: jwkFor(generateRSAKey(t, 1024), "small", "RS256")},
+		{name: "EC key with RSA alg", jwk: jwkFor(generateECKey(t), "ec", "RS256")},
+		{name: "RSA key with EC alg", jwk: jwkFor(generateRSAKey(t, 2048), "rsa", "ES256")},
+		{name: "encryption key", jwk: func() jsonWebKey {
+			jwk := jwkFor(generateECKey(t), "enc", "")
+			jwk.Use = "enc"
+			return jwk
+		}()},
+		{name: "other curve", jwk: func() jsonWebKey {
+			jwk := jwkFor(generateECKey(t), "p384", "")
+			jwk.Crv = "P-384"
+			return jwk
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseKey(tt.jwk); !errors.Is(err, ErrUnsupportedKey) {
+				t.Errorf("parseKey = %v, want %v", err, ErrUnsupportedKey)
+			}
+		})
+	}
+}
+
+func TestJWKSSkipsSmallRSAKeys(t *testing.T) {
+	small := generateRSAKey(t, 1024)
+	ecKey := generateECKey(t)
+	server := newKeyServer(t, jwkFor(small, "small", "RS256"), jwkFor(ecKey, "ec", "ES256"))
+	keys := NewJWKS(server.URL, Options{})
+
+	_, err := jwt.Parse(signToken(t, jwt.SigningMethodRS256, "small", small), keys.Keyfunc(context.Background()))
+	if !errors.Is(keyfuncError(err), ErrKeyNotFound) {
+		t.Fatalf("Parse = %v, want %v", err, ErrKeyNotFound)
+	}
+	// The set's other keys still work
+	if _, err := keys.Key(context.Background(), "ec"); err != nil {
+		t.Errorf("Key(ec) = %v", err)
+	}
+
+	// A set of only small keys is unusable
+	server.publish(t, jwkFor(small, "small", "RS256"))
+	if err := keys.Refresh(context.Background()); !errors.Is(err, ErrNoUsableKeys) {
+		t.Errorf("Refresh = %v, want %v", err, ErrNoUsableKeys)
+	}
+}
+
+func TestJWKSRejectsMismatchedAlgorithm(t *testing.T) {
+	rsaKey := generateRSAKey(t, 2048)
+	ecKey := generateECKey(t)
+	server := newKeyServer(t, jwkFor(rsaKey, "rsa", "RS256"), jwkFor(ecKey, "ec", ""))
+	keys := NewJWKS(server.URL, Options{})
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "other RSA alg than pinned", token: signToken(t, jwt.SigningMethodPS256, "rsa", rsaKey)},
+		{name: "RS384 for pinned RS256", token: signToken(t, jwt.SigningMethodRS384, "rsa", rsaKey)},
+		// HMAC with the public key as the secret, the classic confusion
+		{name: "HS256 for RSA key", token: signToken(t, jwt.SigningMethodHS256, "rsa", []byte("public key bytes"))},
+		{name: "HS256 for EC key", token: signToken(t, jwt.SigningMethodHS256, "ec", []byte("public key bytes"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwt.Parse(tt.token, keys.Keyfunc(context.Background()))
+			if !errors.Is(keyfuncError(err), ErrKeyAlgorithm) {
+				t.Errorf("Parse = %v, want %v", err, ErrKeyAlgorithm)
+			}
+		})
+	}
+}
+
+func TestJWKSRefreshesOnUnknownKeyID(t *testing.T) {
+	oldKey := generateECKey(t)
+	newKey := generateECKey(t)
+	server := newKeyServer(t, jwkFor(oldKey, "old", "ES256"))
+	keys := NewJWKS(server.URL, Options{})
+
+	if _, err := keys.Key(context.Background(), "old"); err != nil {
+		t.Fatalf("Key(old) = %v", err)
+	}
+
+	// The provider rotates its keys
+	server.publish(t, jwkFor(newKey, "new", "ES256"))
+
+	// Right after a fetch, an unknown kid does not fetch again
+	if _, err := keys.Key(context.Background(), "new"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Key(new) = %v, want %v", err, ErrKeyNotFound)
+	}
+	if got := server.fetches.Load(); got != 1 {
+		t.Fatalf("fetched %d times, want 1", got)
+	}
+
+	// Once the minimum interval has passed, it does
+	keys.mu.Lock()
+	keys.fetchedAt = time.Now().Add(-minRefreshInterval)
+	keys.mu.Unlock()
+
+	key, err := keys.Key(context.Background(), "new")
+	if err != nil {
+		t.Fatalf("Key(new) = %v", err)
+	}
+	if !key.Public.(*ecdsa.PublicKey).Equal(newKey.Public()) {
+		t.Error("Key(new) returned another key")
+	}
+	if got := server.fetches.Load(); got != 2 {
+		t.Errorf("fetched %d times, want 2", got)
+	}
+}
+
+func TestJWKSCoalescesConcurrentFetches(t *testing.T) {
+	ecKey := generateECKey(t)
+	server := newKeyServer(t, jwkFor(ecKey, "ec", "ES256"))
+	release := make(chan struct{})
+	server.mu.Lock()
+	server.release = release
+	server.mu.Unlock()
+	keys := NewJWKS(server.URL, Options{})
+
+	const callers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := keys.Key(context.Background(), "ec")
+			errs <- err
+		}()
+	}
+
+	// Give every caller time to wait on the fetch in flight
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Key = %v", err)
+		}
+	}
+	if got := server.fetches.Load(); got != 1 {
+		t.Errorf("fetched %d times, want 1", got)
+	}
+}
+
+func TestJWKSRefreshCancelledCallerDoesNotCancelFetch(t *testing.T) {
+	ecKey := generateECKey(t)
+	server := newKeyServer(t, jwkFor(ecKey, "ec", "ES256"))
+	release := make(chan struct{})
+	server.mu.Lock()
+	server.release = release
+	server.mu.Unlock()
+	keys := NewJWKS(server.URL, Options{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := keys.Refresh(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Refresh = %v, want %v", err, context.Canceled)
+	}
+
+	// The shared fetch goes on and fills the cache for the next caller
+	close(release)
+	if _, err := keys.Key(context.Background(), "ec"); err != nil {
+		t.Fatalf("Key = %v", err)
+	}
+	if got := server.fetches.Load(); got != 1 {
+		t.Errorf("fetched %d times, want 1", got)
+	}
+}
+
+func TestJWKSServesExpiredKeysWithinGracePeriod(t *testing.T) {
+	ecKey := generateECKey(t)
+	server := newKeyServer(t, jwkFor(ecKey, "ec", "ES256"))
+	keys := NewJWKS(server.URL, Options{GracePeriod: time.Hour})
+
+	if _, err := keys.Key(context.Background(), "ec"); err != nil {
+		t.Fatalf("Key = %v", err)
+	}
+
+	// The provider goes down after the keys expired
+	server.setStatus(http.StatusServiceUnavailable)
+	expireKeys(keys, time.Now().Add(-time.Minute))
+
+	if _, err := keys.Key(context.Background(), "ec"); err != nil {
+		t.Fatalf("Key within grace period = %v", err)
+	}
+	if got := server.fetches.Load(); got != 2 {
+		t.Fatalf("fetched %d times, want 2", got)
+	}
+
+	// Requests right after a failed fetch do not fetch again
+	if _, err := keys.Key(context.Background(), "ec"); err != nil {
+		t.Fatalf("Key after failed fetch = %v", err)
+	}
+	if got := server.fetches.Load(); got != 2 {
+		t.Errorf("fetched %d times, want 2", got)
+	}
+
+	// An unknown kid still fails
+	keys.mu.Lock()
+	keys.failedAt = time.Time{}
+	keys.mu.Unlock()
+	if _, err := keys.Key(context.Background(), "other"); err == nil {
+		t.Error("Key(other) succeeded while the provider is down")
+	}
+
+	// Past the grace period, the expired key is no longer used
+	expireKeys(keys, time.Now().Add(-2*time.Hour))
+	if _, err := keys.Key(context.Background(), "ec"); err == nil {
+		t.Fatal("Key past grace period succeeded while the provider is down")
+	}
+
+	// Once the provider is back, the key set is fetched again
+	server.setStatus(http.StatusOK)
+	keys.mu.Lock()
+	keys.failedAt = time.Time{}
+	keys.mu.Unlock()
+	if _, err := keys.Key(context.Background(), "ec"); err != nil {
+		t.Errorf("Key after recovery = %v", err)
+	}
+}
+
+func TestJWKSUsesCacheControlMaxAge(t *testing.T) {
+	ecKey := generateECKey(t)
+	body, err := json.Marshal(map[string][]jsonWebKey{"keys": {jwkFor(ecKey, "ec", "ES256")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=7200, must-revalidate")
+		w.Write(body)
+	}))
+	defer server.Close()
+	keys := NewJWKS(server.URL, Options{})
+
+	if err := keys.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh = %v", err)
+	}
+	keys.mu.RLock()
+	ttl := keys.expiresAt.Sub(keys.fetchedAt)
+	keys.mu.RUnlock()
+	if ttl != 2*time.Hour {
+		t.Errorf("TTL = %s, want 2h", ttl)
+	}
+}
@@ -0,0 +1,237 @@
+package jwtdecode
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrNoSigningKeys       = errors.New("at least one signing key is required")
+	ErrDuplicateKey        = errors.New("signing key is listed twice")
+	ErrInvalidKeyPEM       = errors.New("no private key found in PEM data")
+	ErrUnexpectedTokenType = errors.New("unexpected token type")
+)
+
+// SigningKeys signs the tokens we issue ourselves and verifies them. The
+// first key signs; the others only verify, so tokens signed before a key
+// rotation stay valid until they expire. ECDSA P-256 keys sign with ES256,
+// RSA keys with RS256.
+//
+// Key IDs are the keys' RFC 7638 thumbprints, so a key keeps its ID across
+// restarts and instances.
+type SigningKeys struct {
+	keys []signingKey
+}
+
+type signingKey struct {
+	Key
+	private crypto.Signer
+	method  jwt.SigningMethod
+}
+
+func NewSigningKeys(privates ...crypto.Signer) (*SigningKeys, error) {
+	if len(privates) == 0 {
+		return nil, ErrNoSigningKeys
+	}
+
+	s := &SigningKeys{}
+	seen := make(map[string]bool)
+	for _, private := range privates {
+		key, err := newSigningKey(private)
+		if err != nil {
+			return nil, err
+		}
+		if seen[key.ID] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateKey, key.ID)
+		}
+		seen[key.ID] = true
+		s.keys = append(s.keys, *key)
+	}
+	return s, nil
+}
+
+func newSigningKey(private crypto.Signer) (*signingKey, error) {
+	key := &signingKey{private: private}
+	switch public := private.Public().(type) {
+	case *ecdsa.PublicKey:
+		if public.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupportedKey, public.Curve.Params().Name)
+		}
+		key.method = jwt.SigningMethodES256
+	case *rsa.PublicKey:
+		if public.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("%w: %d-bit RSA modulus", ErrUnsupportedKey, public.N.BitLen())
+		}
+		key.method = jwt.SigningMethodRS256
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, public)
+	}
+
+	key.Public = private.Public()
+	key.Algorithm = key.method.Alg()
+	kid, err := thumbprint(publicJWK(key.Public))
+	if err != nil {
+		return nil, err
+	}
+	key.ID = kid
+	return key, nil
+}
+
+// GenerateSigningKey creates a P-256 key, for when none is configured.
+func GenerateSigningKey() (crypto.Signer, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// ParsePrivateKeyPEM reads the first private key in PEM data, in PKCS #8,
+// SEC 1 ("EC PRIVATE KEY") or PKCS #1 ("RSA PRIVATE KEY") form, as written
+// by openssl genpkey or openssl ecparam -genkey.
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, ErrInvalidKeyPEM
+		}
+
+		var private interface{}
+		var err error
+		switch block.Type {
+		case "PRIVATE KEY":
+			private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			private, err = x509.ParseECPrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		default:
+			// Such as the EC PARAMETERS block openssl writes first
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, private)
+		}
+		return signer, nil
+	}
+}
+
+// KeyID is the ID of the key that signs.
+func (s *SigningKeys) KeyID() string {
+	return s.keys[0].ID
+}
+
+// Sign signs the claims with the first key. typ sets the token's typ header,
+// such as "at+jwt" for access tokens.
+func (s *SigningKeys) Sign(claims jwt.Claims, typ string) (string, error) {
+	key := s.keys[0]
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.ID
+	token.Header["typ"] = typ
+	return token.SignedString(key.private)
+}
+
+// Keyfunc verifies the token's signing method against the key its kid
+// names, for jwt.Parse. Tokens whose typ header is not typ are rejected, so
+// one kind of token cannot stand in for another.
+func (s *SigningKeys) Keyfunc(typ string) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if got, _ := token.Header["typ"].(string); got != typ {
+			return nil, fmt.Errorf("%w: %q", ErrUnexpectedTokenType, got)
+		}
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, ErrMissingKeyID
+		}
+
+		for _, key := range s.keys {
+			if key.ID != kid {
+				continue
+			}
+			if !key.accepts(token.Method.Alg()) {
+				return nil, fmt.Errorf("%w: %s", ErrKeyAlgorithm, token.Method.Alg())
+			}
+			return key.Public, nil
+		}
+		return nil, ErrKeyNotFound
+	}
+}
+
+// MarshalJSON writes the public keys as a JSON Web Key Set, for others to
+// verify our tokens with.
+func (s *SigningKeys) MarshalJSON() ([]byte, error) {
+	keySet := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	for _, key := range s.keys {
+		jwk := publicJWK(key.Public)
+		jwk.Kid = key.ID
+		jwk.Use = "sig"
+		jwk.Alg = key.Algorithm
+		keySet.Keys = append(keySet.Keys, jwk)
+	}
+	return json.Marshal(keySet)
+}
+
+// publicJWK holds the key type and public members of a key, without kid,
+// use or alg.
+func publicJWK(public crypto.PublicKey) jsonWebKey {
+	switch public := public.(type) {
+	case *ecdsa.PublicKey:
+		// Coordinates are padded to the curve's size
+		return jsonWebKey{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   encodeBase64URL(public.X.FillBytes(make([]byte, 32))),
+			Y:   encodeBase64URL(public.Y.FillBytes(make([]byte, 32))),
+		}
+	case *rsa.PublicKey:
+		return jsonWebKey{
+			Kty: "RSA",
+			N:   encodeBase64URL(public.N.Bytes()),
+			E:   encodeBase64URL(big.NewInt(int64(public.E)).Bytes()),
+		}
+	}
+	return jsonWebKey{}
+}
+
+// thumbprint is the RFC 7638 thumbprint of the key: the SHA-256 of its
+// required members in lexicographic order, without whitespace.
+func thumbprint(jwk jsonWebKey) (string, error) {
+	var members map[string]string
+	switch jwk.Kty {
+	case "EC":
+		members = map[string]string{"crv": jwk.Crv, "kty": jwk.Kty, "x": jwk.X, "y": jwk.Y}
+	case "RSA":
+		members = map[string]string{"e": jwk.E, "kty": jwk.Kty, "n": jwk.N}
+	default:
+		return "", fmt.Errorf("%w: kty %q", ErrUnsupportedKey, jwk.Kty)
+	}
+
+	// encoding/json sorts map keys
+	canonical, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return encodeBase64URL(sum[:]), nil
+}
+
+func encodeBase64URL(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
@@ -0,0 +1,216 @@
+package jwtdecode
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Issuers of the identity tokens we accept. Google uses either form.
+const (
+	AppleIssuer      = "https://appleid.apple.com"
+	GoogleIssuer     = "https://accounts.google.com"
+	GoogleIssuerHost = "accounts.google.com"
+)
+
+var (
+	ErrInvalidIssuer   = errors.New("token issuer is not accepted")
+	ErrInvalidAudience = errors.New("token audience is not one of our client IDs")
+	ErrTokenExpired    = errors.New("token has expired")
+	ErrTokenNotYet     = errors.New("token is not valid yet")
+	ErrMissingClaim    = errors.New("token is missing a required claim")
+	ErrNonceMismatch   = errors.New("token nonce does not match")
+	ErrInvalidParty    = errors.New("token authorized party is not one of our client IDs")
+	ErrEmailUnverified = errors.New("token email is not verified")
+)
+
+// DefaultLeeway absorbs clock skew between us and the identity provider.
+const DefaultLeeway = time.Minute
+
+// Verifier checks identity tokens from one provider: the signature against
+// the provider's key set, then the registered claims against our
+// configuration.
+type Verifier struct {
+	Keys *JWKS
+	// Issuers are the accepted iss values.
+	Issuers []string
+	// Audiences are our client IDs with the provider, such as an app's
+	// bundle ID and its service IDs. An azp claim, which Google sets to the
+	// client that asked for the token, must be one of them too.
+	Audiences []string
+	// RequireNonce rejects tokens without a nonce. A nonce in the token is
+	// always checked.
+	RequireNonce bool
+	// HashedNonce is set for providers whose token carries the SHA-256 of
+	// the nonce, in hex, rather than the nonce itself.
+	HashedNonce bool
+	// RequireVerifiedEmail rejects tokens with an email the provider has
+	// not verified.
+	RequireVerifiedEmail bool
+	// Leeway defaults to DefaultLeeway.
+	Leeway time.Duration
+}
+
+// Identity is who a verified token says the user is.
+type Identity struct {
+	// Subject is the provider's stable ID for the user.
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// Verify checks the token and returns the identity it carries. nonce is the
+// raw nonce the client used to request the token; it may be empty when the
+// token has none.
+func (v *Verifier) Verify(ctx context.Context, tokenString string, nonce string) (*Identity, error) {
+	// exp, iat and nbf are checked below, with leeway and stricter rules
+	// than jwt-go applies
+	parser := jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(tokenString, v.Keys.Keyfunc(ctx))
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected claims", ErrMissingClaim)
+	}
+
+	if err := v.validate(claims, nonce, time.Now()); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.EmailVerified = boolClaim(claims["email_verified"])
+	return identity, nil
+}
+
+func (v *Verifier) validate(claims jwt.MapClaims, nonce string, now time.Time) error {
+	leeway := v.Leeway
+	if leeway <= 0 {
+		leeway = DefaultLeeway
+	}
+
+	iss, _ := claims["iss"].(string)
+	if !contains(v.Issuers, iss) {
+		return fmt.Errorf("%w: %q", ErrInvalidIssuer, iss)
+	}
+	if !v.audienceMatches(claims["aud"]) {
+		return ErrInvalidAudience
+	}
+	if azp, ok := claims["azp"].(string); ok && !contains(v.Audiences, azp) {
+		return fmt.Errorf("%w: %q", ErrInvalidParty, azp)
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return fmt.Errorf("%w: sub", ErrMissingClaim)
+	}
+
+	exp, ok := timeClaim(claims["exp"])
+	if !ok {
+		return fmt.Errorf("%w: exp", ErrMissingClaim)
+	}
+	if now.After(exp.Add(leeway)) {
+		return ErrTokenExpired
+	}
+	iat, ok := timeClaim(claims["iat"])
+	if !ok {
+		return fmt.Errorf("%w: iat", ErrMissingClaim)
+	}
+	if iat.After(now.Add(leeway)) {
+		return fmt.Errorf("%w: issued in the future", ErrTokenNotYet)
+	}
+	if nbf, ok := timeClaim(claims["nbf"]); ok && nbf.After(now.Add(leeway)) {
+		return ErrTokenNotYet
+	}
+
+	if email, _ := claims["email"].(string); v.RequireVerifiedEmail && email != "" && !boolClaim(claims["email_verified"]) {
+		return ErrEmailUnverified
+	}
+
+	return v.checkNonce(claims["nonce"], nonce)
+}
+
+func (v *Verifier) audienceMatches(aud interface{}) bool {
+	switch aud := aud.(type) {
+	case string:
+		return contains(v.Audiences, aud)
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok && contains(v.Audiences, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkNonce binds the token to the client that asked for it: only that
+// client knows the raw nonce.
+func (v *Verifier) checkNonce(claim interface{}, nonce string) error {
+	want, _ := claim.(string)
+	if want == "" {
+		if v.RequireNonce {
+			return fmt.Errorf("%w: nonce", ErrMissingClaim)
+		}
+		return nil
+	}
+	if nonce == "" {
+		return ErrNonceMismatch
+	}
+
+	got := nonce
+	if v.HashedNonce {
+		sum := sha256.Sum256([]byte(nonce))
+		got = hex.EncodeToString(sum[:])
+	}
+	if subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+		return ErrNonceMismatch
+	}
+	return nil
+}
+
+// timeClaim reads a NumericDate claim.
+func timeClaim(v interface{}) (time.Time, bool) {
+	var seconds float64
+	switch v := v.(type) {
+	case float64:
+		seconds = v
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		seconds = f
+	default:
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+// boolClaim reads a boolean claim. Apple sends some booleans as strings.
+func boolClaim(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s && s != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS fallback_events;
+
+ALTER TABLE users
+    DROP COLUMN messages_reserved;
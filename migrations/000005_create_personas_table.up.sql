@@ -0,0 +1,17 @@
+-- Empty prompt and model, and NULL parameters, fall back to the global config
+CREATE TABLE IF NOT EXISTS personas (
+    id TEXT PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL,
+    system_prompt TEXT NOT NULL DEFAULT '',
+    model TEXT NOT NULL DEFAULT '',
+    max_tokens INTEGER,
+    temperature REAL,
+    presence_penalty REAL,
+    frequency_penalty REAL,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    is_default INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO personas (id, name, is_default) VALUES ('coach', 'coach', 1);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS usage_events;
+
+ALTER TABLE messages
+    DROP COLUMN prompt_version_id;
+
+DROP TABLE IF EXISTS prompt_versions;
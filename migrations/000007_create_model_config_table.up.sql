@@ -0,0 +1,11 @@
+-- Holds a single row: the model configuration applied at startup
+CREATE TABLE IF NOT EXISTS model_config (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    model TEXT NOT NULL,
+    max_tokens INTEGER NOT NULL,
+    temperature REAL NOT NULL,
+    presence_penalty REAL NOT NULL,
+    frequency_penalty REAL NOT NULL,
+    context_budgets TEXT NOT NULL DEFAULT '{}',
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
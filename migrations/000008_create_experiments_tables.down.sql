@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS idx_usage_events_variant_id;
+
+ALTER TABLE usage_events
+    DROP COLUMN variant_id;
+
+ALTER TABLE usage_events
+    DROP COLUMN experiment_id;
+
+DROP TABLE IF EXISTS message_feedback;
+DROP TABLE IF EXISTS experiment_assignments;
+DROP TABLE IF EXISTS experiment_variants;
+DROP TABLE IF EXISTS experiments;
@@ -0,0 +1,53 @@
+CREATE TABLE IF NOT EXISTS experiments (
+    id TEXT PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL,
+    status TEXT NOT NULL DEFAULT 'draft',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at DATETIME,
+    stopped_at DATETIME
+);
+
+-- Empty prompt and model, and NULL parameters, fall back to the global config
+CREATE TABLE IF NOT EXISTS experiment_variants (
+    id TEXT PRIMARY KEY,
+    experiment_id TEXT NOT NULL REFERENCES experiments(id),
+    name TEXT NOT NULL,
+    weight INTEGER NOT NULL DEFAULT 1,
+    system_prompt TEXT NOT NULL DEFAULT '',
+    model TEXT NOT NULL DEFAULT '',
+    max_tokens INTEGER,
+    temperature REAL,
+    presence_penalty REAL,
+    frequency_penalty REAL,
+    UNIQUE (experiment_id, name)
+);
+
+-- was_premium excludes users who had already converted from the conversion rate
+CREATE TABLE IF NOT EXISTS experiment_assignments (
+    experiment_id TEXT NOT NULL REFERENCES experiments(id),
+    user_id TEXT NOT NULL,
+    variant_id TEXT NOT NULL REFERENCES experiment_variants(id),
+    was_premium INTEGER NOT NULL DEFAULT 0,
+    assigned_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (experiment_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS message_feedback (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    conversation_id TEXT,
+    message_id TEXT,
+    rating INTEGER NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_feedback_user_id ON message_feedback (user_id, created_at);
+
+ALTER TABLE usage_events
+    ADD COLUMN experiment_id TEXT;
+
+ALTER TABLE usage_events
+    ADD COLUMN variant_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_usage_events_variant_id ON usage_events (variant_id, user_id, created_at);
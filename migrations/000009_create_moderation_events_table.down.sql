@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_moderation_events_created_at;
+DROP TABLE IF EXISTS moderation_events;
@@ -0,0 +1,14 @@
+-- categories is a comma separated list; excerpt is only kept for flagged text
+CREATE TABLE IF NOT EXISTS moderation_events (
+    id TEXT PRIMARY KEY,
+    stage TEXT NOT NULL,
+    moderator TEXT NOT NULL,
+    action TEXT NOT NULL,
+    categories TEXT NOT NULL DEFAULT '',
+    excerpt TEXT NOT NULL DEFAULT '',
+    user_id TEXT,
+    conversation_id TEXT,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_moderation_events_created_at ON moderation_events (created_at);
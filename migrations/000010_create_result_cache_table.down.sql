@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_result_cache_expires_at;
+DROP TABLE IF EXISTS result_cache;
@@ -0,0 +1,9 @@
+-- value is a JSON encoded chat.Result; key hashes everything that produced it
+CREATE TABLE IF NOT EXISTS result_cache (
+    key TEXT PRIMARY KEY,
+    value BLOB NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_result_cache_expires_at ON result_cache (expires_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_action_plans_user_id;
+DROP TABLE IF EXISTS action_plans;
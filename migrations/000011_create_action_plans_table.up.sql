@@ -0,0 +1,12 @@
+-- goals holds the JSON encoded goals and tasks of the plan
+CREATE TABLE IF NOT EXISTS action_plans (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    conversation_id TEXT,
+    summary TEXT NOT NULL DEFAULT '',
+    goals TEXT NOT NULL,
+    model TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_action_plans_user_id ON action_plans (user_id, created_at);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_goal_check_ins_goal_id;
+DROP TABLE IF EXISTS goal_check_ins;
+DROP INDEX IF EXISTS idx_goals_user_id;
+DROP TABLE IF EXISTS goals;
@@ -0,0 +1,25 @@
+-- target_date and day are calendar dates in YYYY-MM-DD form
+CREATE TABLE IF NOT EXISTS goals (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    title TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    target_date TEXT,
+    status TEXT NOT NULL DEFAULT 'active',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_goals_user_id ON goals (user_id, status);
+
+CREATE TABLE IF NOT EXISTS goal_check_ins (
+    id TEXT PRIMARY KEY,
+    goal_id TEXT NOT NULL REFERENCES goals(id),
+    user_id TEXT NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    day TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_goal_check_ins_goal_id ON goal_check_ins (goal_id, day);
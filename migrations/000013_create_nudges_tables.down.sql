@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_nudges_user_id;
+DROP TABLE IF EXISTS nudges;
+DROP TABLE IF EXISTS nudge_settings;
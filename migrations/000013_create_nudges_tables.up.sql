@@ -0,0 +1,26 @@
+-- send_at, quiet_start and quiet_end are wall-clock times in HH:MM form in
+-- the user's timezone; empty quiet hours mean none
+CREATE TABLE IF NOT EXISTS nudge_settings (
+    user_id TEXT PRIMARY KEY REFERENCES users(id),
+    enabled BOOLEAN NOT NULL DEFAULT 0,
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    send_at TEXT NOT NULL DEFAULT '09:00',
+    quiet_start TEXT NOT NULL DEFAULT '',
+    quiet_end TEXT NOT NULL DEFAULT '',
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- day is the user's local calendar date, so each user gets one nudge a day
+CREATE TABLE IF NOT EXISTS nudges (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    day TEXT NOT NULL,
+    content TEXT NOT NULL,
+    model TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at DATETIME,
+    read_at DATETIME,
+    UNIQUE (user_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_nudges_user_id ON nudges (user_id, created_at);
@@ -0,0 +1,4 @@
+-- Empty until the user picks a locale or one is negotiated from
+-- Accept-Language
+ALTER TABLE users
+    ADD COLUMN locale TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_fallback_messages_category;
+DROP TABLE IF EXISTS fallback_messages;
@@ -0,0 +1,15 @@
+-- category is error, quota or maintenance; locale is a supported locale such
+-- as en. Without an enabled message for a category and locale the built-in
+-- messages are used.
+CREATE TABLE IF NOT EXISTS fallback_messages (
+    id TEXT PRIMARY KEY,
+    category TEXT NOT NULL,
+    locale TEXT NOT NULL,
+    content TEXT NOT NULL,
+    weight INTEGER NOT NULL DEFAULT 1,
+    enabled BOOLEAN NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_fallback_messages_category ON fallback_messages (category, locale);
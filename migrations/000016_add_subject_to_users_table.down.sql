@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_users_subject;
+
+ALTER TABLE users
+    DROP COLUMN subject;
@@ -0,0 +1,8 @@
+-- subject is the identity provider's stable ID for the user, the sub claim
+-- of their ID token; guests have none. Users who signed up before it was
+-- recorded are linked on their first verified sign-in: their username was
+-- never verified, so it cannot be trusted as a subject here.
+ALTER TABLE users
+    ADD COLUMN subject TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_subject ON users (auth_provider, subject) WHERE subject IS NOT NULL;
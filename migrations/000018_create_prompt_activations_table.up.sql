@@ -0,0 +1,15 @@
+-- Every activation of a prompt version, in order, so a rollback can return to
+-- the version that was active before. rolled_back_at is set when a rollback
+-- undoes the activation. Only the latest activation of each version was kept
+-- until now; those seed the history.
+CREATE TABLE IF NOT EXISTS prompt_activations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    prompt_version_id TEXT NOT NULL REFERENCES prompt_versions(id),
+    activated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    rolled_back_at DATETIME
+);
+
+INSERT INTO prompt_activations (prompt_version_id, activated_at)
+SELECT id, activated_at FROM prompt_versions
+WHERE activated_at IS NOT NULL
+ORDER BY activated_at;
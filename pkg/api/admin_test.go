@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminRoutesRequireAdminKey(t *testing.T) {
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPut, "/api/v1/admin/users/user-1/entitlements"},
+		{http.MethodPost, "/api/v1/update-config"},
+		{http.MethodPatch, "/api/v1/config"},
+		{http.MethodPost, "/api/v1/update-prompt"},
+		{http.MethodGet, "/api/v1/admin/moderation"},
+		{http.MethodPost, "/api/v1/admin/personas"},
+		{http.MethodDelete, "/api/v1/admin/personas/persona-1"},
+		{http.MethodPost, "/api/v1/admin/prompts/rollback"},
+		{http.MethodPost, "/api/v1/admin/experiments/experiment-1/start"},
+		{http.MethodPut, "/api/v1/admin/fallbacks/message-1"},
+	}
+	tests := []struct {
+		name       string
+		configured string
+		sent       string
+	}{
+		{name: "no key", configured: "admin-secret"},
+		{name: "wrong key", configured: "admin-secret", sent: "guess"},
+		{name: "no key configured", configured: "", sent: ""},
+	}
+
+	for _, tt := range tests {
+		router := (&Handler{auth: AuthConfig{AdminKey: tt.configured}}).Router()
+		for _, route := range routes {
+			t.Run(tt.name+"/"+route.method+" "+route.path, func(t *testing.T) {
+				req := httptest.NewRequest(route.method, route.path, strings.NewReader(`{}`))
+				if tt.sent != "" {
+					req.Header.Set("X-Admin-Key", tt.sent)
+				}
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+
+				if rec.Code != http.StatusUnauthorized {
+					t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+				}
+				if !strings.Contains(rec.Body.String(), "admin_unauthorized") {
+					t.Errorf("body = %s, want code admin_unauthorized", rec.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func TestAuthenticateAdminAcceptsAdminKey(t *testing.T) {
+	h := &Handler{auth: AuthConfig{AdminKey: "admin-secret"}}
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/admin/users/user-1/entitlements", nil)
+	req.Header.Set("X-Admin-Key", "admin-secret")
+	rec := httptest.NewRecorder()
+	h.authenticateAdmin(next).ServeHTTP(rec, req)
+
+	if !called || rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d, called = %v, want the request passed through", rec.Code, called)
+	}
+}
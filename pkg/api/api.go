@@ -1,45 +1,152 @@
 package api
 
 import (
-	"crypto/rsa"
+	"context"
 	"encoding/json"
-	"github.com/dgrijalva/jwt-go"
+	"errors"
 	jwtdecode "github.com/fgb-andu/hustl-api/internal"
 	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/fgb-andu/hustl-api/pkg/repository/configprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/conversationprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/eventprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/experimentprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/fallbackprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/goalprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/nudgeprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/personaprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/planprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/promptprovider"
 	"github.com/fgb-andu/hustl-api/pkg/repository/userprovider"
 	"github.com/fgb-andu/hustl-api/pkg/service/chat"
+	"github.com/fgb-andu/hustl-api/pkg/service/retry"
+	"github.com/fgb-andu/hustl-api/pkg/service/session"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
-	"sync"
+	"time"
 )
 
-// Updated request structure to include user ID
+// ChatRequest is sent by the signed-in user; the access token says who
+// that is.
 type ChatRequest struct {
-	UserID   string   `json:"user_id"`
 	Messages []string `json:"messages"`
+
+	// When ConversationID is set the history is loaded from storage and
+	// Messages is ignored; Message carries the new user turn instead.
+	ConversationID string `json:"conversation_id,omitempty"`
+	Message        string `json:"message,omitempty"`
+
+	// PersonaID selects the coaching style; empty means the default persona.
+	PersonaID string `json:"persona_id,omitempty"`
+
+	// Summary shapes the reply of the summarize endpoint.
+	Summary chat.SummaryOptions `json:"summary,omitempty"`
 }
 
 type ChatResponse struct {
 	Result string `json:"result"`
-	Error  string `json:"error,omitempty"`
+	// Data holds Result as a JSON value when JSON output was requested.
+	Data            json.RawMessage `json:"data,omitempty"`
+	Persona         string          `json:"persona,omitempty"`
+	PromptVersionID string          `json:"prompt_version_id,omitempty"`
+	Error           string          `json:"error,omitempty"`
+	// Code identifies Error for clients; Error itself is translated.
+	Code string `json:"code,omitempty"`
+
+	// Fallback is set when Result is a canned message because generation
+	// failed. Such replies are not charged against the quota.
+	Fallback       bool   `json:"fallback,omitempty"`
+	FallbackReason string `json:"fallback_reason,omitempty"`
+
+	// Moderation is set when a moderation policy flagged or replaced the
+	// exchange.
+	Moderation *chat.ModerationOutcome `json:"moderation,omitempty"`
 }
 
+// AuthResponse answers /guest and /auth, both for a user that was found (200)
+// and for one that was created (201). Clients of /guest take note: a newly
+// created guest used to come back as a bare User, and now comes wrapped like
+// every other sign-in, together with the session's tokens.
 type AuthResponse struct {
-	User  *domain.User `json:"user"`
-	Error *string      `json:"error,omitempty"`
+	User *domain.User `json:"user"`
+	// Tokens authenticate the user's further requests.
+	Tokens *TokenResponse `json:"tokens,omitempty"`
+	Error  *string        `json:"error,omitempty"`
 }
 
 type Handler struct {
-	service  chat.Service
-	userProv *userprovider.UserProvider
+	service chat.Service
+	// gpt is the service behind any decorators, for status and admin
+	// updates
+	gpt *chat.GPTService
+	// planner generates action plans, moderated like replies
+	planner chat.ActionPlanner
+	// cache is nil when results are not cached
+	cache       *chat.CachedService
+	userProv    *userprovider.UserProvider
+	convProv    *conversationprovider.ConversationProvider
+	eventProv   *eventprovider.EventProvider
+	personaProv *personaprovider.PersonaProvider
+	promptProv  *promptprovider.PromptProvider
+	configProv  *configprovider.ConfigProvider
+
+	experimentProv *experimentprovider.ExperimentProvider
+	planProv       *planprovider.PlanProvider
+	goalProv       *goalprovider.GoalProvider
+	nudgeProv      *nudgeprovider.NudgeProvider
+	fallbackProv   *fallbackprovider.FallbackProvider
+
+	auth AuthConfig
+}
+
+// AuthConfig holds the verifiers for each identity provider's ID tokens, and
+// the manager of the sessions we issue once a user has signed in. A nil
+// verifier disables sign-in with that provider.
+type AuthConfig struct {
+	Apple  *jwtdecode.Verifier
+	Google *jwtdecode.Verifier
+
+	Sessions *session.Manager
+
+	// AdminKey authorizes the admin routes, sent in the X-Admin-Key header.
+	// Without one, the admin routes reject every request.
+	AdminKey string
+}
+
+func (c AuthConfig) verifier(provider domain.AuthProvider) *jwtdecode.Verifier {
+	switch provider {
+	case domain.AuthProviderGoogle:
+		return c.Google
+	case domain.AuthProviderApple:
+		return c.Apple
+	default:
+		return nil
+	}
 }
 
-func NewHandler(service chat.Service, userProv *userprovider.UserProvider) *Handler {
+func NewHandler(service chat.Service, userProv *userprovider.UserProvider, convProv *conversationprovider.ConversationProvider, eventProv *eventprovider.EventProvider, personaProv *personaprovider.PersonaProvider, promptProv *promptprovider.PromptProvider, configProv *configprovider.ConfigProvider, experimentProv *experimentprovider.ExperimentProvider, planProv *planprovider.PlanProvider, goalProv *goalprovider.GoalProvider, nudgeProv *nudgeprovider.NudgeProvider, fallbackProv *fallbackprovider.FallbackProvider, auth AuthConfig) *Handler {
 	return &Handler{
-		service:  service,
-		userProv: userProv,
+		service:     service,
+		gpt:         chat.Base(service),
+		planner:     chat.Planner(service),
+		cache:       chat.Cache(service),
+		userProv:    userProv,
+		convProv:    convProv,
+		eventProv:   eventProv,
+		personaProv: personaProv,
+		promptProv:  promptProv,
+		configProv:  configProv,
+
+		experimentProv: experimentProv,
+		planProv:       planProv,
+		goalProv:       goalProv,
+		nudgeProv:      nudgeProv,
+		fallbackProv:   fallbackProv,
+
+		auth: auth,
 	}
 }
 
@@ -52,19 +159,124 @@ func (h *Handler) Router() chi.Router {
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
+	r.Use(negotiateLocaleMiddleware)
 	// Routes
 	r.Route("/api/v1", func(r chi.Router) {
 		// Auth endpoint
 		r.Post("/guest", h.HandleGuestAuth)
 		r.Post("/auth", h.HandleAuth)
+		r.Post("/token/refresh", h.HandleRefreshToken)
+
+		// User endpoints act for the user the access token was issued to
+		r.Group(func(r chi.Router) {
+			r.Use(h.authenticate)
+
+			r.Post("/summarize", h.HandleSummarize)
+			r.Post("/next-message", h.HandleNextMessage)
+			r.Post("/next-message/stream", h.HandleNextMessageStream)
+			r.Post("/set-locale", h.HandleSetLocale)
+			r.Post("/feedback", h.HandleFeedback)
+			r.Post("/action-plan", h.HandleCreateActionPlan)
+			r.Get("/action-plans", h.HandleListActionPlans)
+			r.Get("/action-plans/{planID}", h.HandleGetActionPlan)
+
+			// Conversations
+			r.Route("/conversations", func(r chi.Router) {
+				r.Post("/", h.HandleCreateConversation)
+				r.Get("/", h.HandleListConversations)
+				r.Get("/{conversationID}", h.HandleGetConversation)
+				r.Delete("/{conversationID}", h.HandleDeleteConversation)
+			})
+
+			// Goals
+			r.Route("/goals", func(r chi.Router) {
+				r.Post("/", h.HandleCreateGoal)
+				r.Get("/", h.HandleListGoals)
+				r.Get("/{goalID}", h.HandleGetGoal)
+				r.Patch("/{goalID}", h.HandleUpdateGoal)
+				r.Delete("/{goalID}", h.HandleDeleteGoal)
+				r.Post("/{goalID}/check-ins", h.HandleCheckIn)
+				r.Get("/{goalID}/check-ins", h.HandleListCheckIns)
+			})
+
+			// Nudge inbox
+			r.Route("/inbox", func(r chi.Router) {
+				r.Get("/", h.HandleInbox)
+				r.Get("/settings", h.HandleGetNudgeSettings)
+				r.Put("/settings", h.HandleUpdateNudgeSettings)
+				r.Post("/{nudgeID}/read", h.HandleMarkNudgeRead)
+			})
+		})
+
+		r.Get("/config", h.GetConfig)
+		r.Get("/stats/fallbacks", h.HandleFallbackStats)
+		r.Get("/stats/cache", h.HandleCacheStats)
+		r.Get("/status", h.HandleStatus)
+
+		// Admin endpoints change what every user gets, so they need the
+		// admin key
+		r.Group(func(r chi.Router) {
+			r.Use(h.authenticateAdmin)
+
+			r.Post("/update-config", h.UpdateConfig)
+			r.Patch("/config", h.UpdateConfig)
+			r.Post("/update-prompt", h.UpdatePrompt)
+			r.Get("/admin/moderation", h.HandleModerationEvents)
+
+			// Entitlements are granted server-side, once a purchase is verified
+			r.Put("/admin/users/{userID}/entitlements", h.HandleSetEntitlements)
+
+			// Personas
+			r.Route("/admin/personas", func(r chi.Router) {
+				r.Post("/", h.HandleCreatePersona)
+				r.Get("/", h.HandleListPersonas)
+				r.Get("/{personaID}", h.HandleGetPersona)
+				r.Put("/{personaID}", h.HandleUpdatePersona)
+				r.Delete("/{personaID}", h.HandleDeletePersona)
+			})
+
+			// Prompt versions
+			r.Route("/admin/prompts", func(r chi.Router) {
+				r.Post("/", h.HandleCreatePromptVersion)
+				r.Get("/", h.HandleListPromptVersions)
+				r.Get("/diff", h.HandleDiffPromptVersions)
+				r.Post("/rollback", h.HandleRollbackPromptVersion)
+				r.Get("/{versionID}", h.HandleGetPromptVersion)
+				r.Post("/{versionID}/activate", h.HandleActivatePromptVersion)
+			})
+
+			// Experiments
+			r.Route("/admin/experiments", func(r chi.Router) {
+				r.Post("/", h.HandleCreateExperiment)
+				r.Get("/", h.HandleListExperiments)
+				r.Get("/{experimentID}", h.HandleGetExperiment)
+				r.Post("/{experimentID}/start", h.HandleStartExperiment)
+				r.Post("/{experimentID}/stop", h.HandleStopExperiment)
+				r.Get("/{experimentID}/report", h.HandleExperimentReport)
+			})
+
+			// Fallback messages
+			r.Route("/admin/fallbacks", func(r chi.Router) {
+				r.Post("/", h.HandleCreateFallbackMessage)
+				r.Get("/", h.HandleListFallbackMessages)
+				r.Get("/{messageID}", h.HandleGetFallbackMessage)
+				r.Put("/{messageID}", h.HandleUpdateFallbackMessage)
+				r.Delete("/{messageID}", h.HandleDeleteFallbackMessage)
+			})
+		})
+
+	})
 
-		// Existing endpoints
-		r.Post("/summarize", h.HandleSummarize)
-		r.Post("/next-message", h.HandleNextMessage)
-		r.Post("/set-entitlements", h.HandleSetEntitlements)
-		r.Post("/update-config", h.UpdateConfig)
-		r.Post("/update-prompt", h.UpdatePrompt)
+	// Keys to verify our access tokens with
+	r.Get("/.well-known/jwks.json", h.HandleJWKS)
 
+	// v2 takes role-tagged messages instead of relying on their position
+	r.Route("/api/v2", func(r chi.Router) {
+		r.Use(h.authenticate)
+
+		r.Post("/summarize", h.HandleSummarizeV2)
+		r.Post("/next-message", h.HandleNextMessageV2)
+		r.Post("/next-message/stream", h.HandleNextMessageStreamV2)
 	})
 
 	return r
@@ -77,22 +289,38 @@ func (h *Handler) HandleSummarize(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check message limits
-	if _, err := h.userProv.GetUser(req.UserID); err != nil {
-		switch err {
-		case userprovider.ErrUserNotFound:
-			respondWithError(w, http.StatusNotFound, "User not found")
-		case userprovider.ErrDailyLimitReached:
-			respondWithError(w, http.StatusForbidden, "Daily message limit reached")
-		default:
-			respondWithError(w, http.StatusInternalServerError, "Internal server error")
+	h.summarize(w, r, req.toV2())
+}
+
+func (h *Handler) summarize(w http.ResponseWriter, r *http.Request, req ChatRequestV2) {
+	user := requestUser(r)
+
+	messages := req.Messages
+	if req.ConversationID != "" {
+		conversation, ok := h.authorizeConversation(w, req.ConversationID, user.ID)
+		if !ok {
+			return
+		}
+		var err error
+		if messages, err = h.conversationHistory(conversation.ID); err != nil {
+			log.Println(err.Error())
+			respondWithError(w, http.StatusInternalServerError, "Failed to load conversation")
+			return
 		}
-		return
 	}
 
-	result := h.service.Summarize(req.Messages)
+	// Summaries follow the user's language unless the client picked one
+	if locale := useLocale(w, user.Locale); req.Summary.Language == "" && locale != domain.DefaultLocale {
+		req.Summary.Language = localeNames[locale]
+	}
+	result, err := h.service.Summarize(r.Context(), messages, req.Summary)
+	if err != nil {
+		respondWithChatError(w, err)
+		return
+	}
 	respondWithJSON(w, http.StatusOK, ChatResponse{
-		Result: result,
+		Result: result.Content,
+		Data:   result.Data,
 	})
 }
 
@@ -103,22 +331,197 @@ func (h *Handler) HandleNextMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check message limits
-	if err := h.userProv.CheckAndIncrementMessageCount(req.UserID); err != nil {
-		switch err {
-		case userprovider.ErrUserNotFound:
-			respondWithError(w, http.StatusNotFound, "User not found")
-		case userprovider.ErrDailyLimitReached:
-			respondWithError(w, http.StatusForbidden, "Daily message limit reached")
-		default:
-			respondWithError(w, http.StatusInternalServerError, "Internal server error")
-		}
+	h.nextMessage(w, r, req.toV2())
+}
+
+func (h *Handler) nextMessage(w http.ResponseWriter, r *http.Request, req ChatRequestV2) {
+	user := requestUser(r)
+	conversation, ok := h.prepareConversation(w, user, req)
+	if !ok {
+		return
+	}
+
+	// Check message limits; the message is only charged once a real
+	// completion arrives
+	reservation, err := h.userProv.ReserveMessage(user.ID)
+	if err != nil {
+		respondWithUserError(w, err)
 		return
 	}
 
-	result := h.service.GetNextMessage(req.Messages)
+	messages := req.Messages
+	if conversation != nil {
+		if messages, err = h.appendUserMessage(conversation.ID, req.Message); err != nil {
+			h.releaseReservation(reservation)
+			log.Println(err.Error())
+			respondWithError(w, http.StatusInternalServerError, "Failed to store message")
+			return
+		}
+	}
+
+	result, err := h.service.GetNextMessage(r.Context(), chat.NextMessageRequest{
+		UserID:         user.ID,
+		ConversationID: req.ConversationID,
+		PersonaID:      req.PersonaID,
+		Messages:       messages,
+		Now:            h.userNow(user.ID),
+		Locale:         useLocale(w, user.Locale),
+	})
+	if err != nil {
+		h.releaseReservation(reservation)
+		respondWithChatError(w, err)
+		return
+	}
+	h.settleReservation(reservation, req.ConversationID, result)
+	if conversation != nil {
+		if _, err := h.convProv.AddMessage(conversation.ID, domain.MessageRoleAssistant, result.Content, result.PromptVersionID); err != nil {
+			log.Println(err.Error())
+		}
+	}
 	respondWithJSON(w, http.StatusOK, ChatResponse{
-		Result: result,
+		Result:          result.Content,
+		Persona:         result.Persona,
+		PromptVersionID: result.PromptVersionID,
+		Fallback:        result.Fallback,
+		FallbackReason:  result.FallbackReason,
+		Moderation:      result.Moderation,
+	})
+}
+
+// settleReservation charges the reserved message for a real completion and
+// records its usage. Cached replies cost nothing to serve, so their message
+// is given back. Canned fallback replies are given back and recorded
+// instead.
+func (h *Handler) settleReservation(reservation *userprovider.Reservation, conversationID string, result chat.Result) {
+	if !result.Fallback {
+		if result.Cached {
+			h.releaseReservation(reservation)
+		} else if err := h.userProv.CommitReservation(reservation); err != nil {
+			log.Println(err.Error())
+		}
+		err := h.eventProv.RecordUsage(eventprovider.UsageEvent{
+			UserID:           reservation.UserID,
+			ConversationID:   conversationID,
+			PromptVersionID:  result.PromptVersionID,
+			Persona:          result.Persona,
+			ExperimentID:     result.ExperimentID,
+			VariantID:        result.VariantID,
+			Model:            result.Model,
+			PromptTokens:     result.Usage.PromptTokens,
+			CompletionTokens: result.Usage.CompletionTokens,
+		})
+		if err != nil {
+			log.Println(err.Error())
+		}
+		return
+	}
+
+	h.releaseReservation(reservation)
+	if err := h.eventProv.RecordFallback(reservation.UserID, conversationID, result.FallbackReason); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+func (h *Handler) releaseReservation(reservation *userprovider.Reservation) {
+	if err := h.userProv.ReleaseReservation(reservation); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+func (h *Handler) HandleFallbackStats(w http.ResponseWriter, r *http.Request) {
+	since := time.Now().Add(-24 * time.Hour)
+	if v := r.URL.Query().Get("since"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "since must be an RFC 3339 timestamp")
+			return
+		}
+		since = parsed
+	}
+
+	stats, err := h.eventProv.GetFallbackStats(since)
+	if err != nil {
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Failed to load fallback stats")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, stats)
+}
+
+type CacheStatsResponse struct {
+	Enabled bool `json:"enabled"`
+	chat.CacheStats
+}
+
+// HandleCacheStats reports result cache hits and misses since startup.
+func (h *Handler) HandleCacheStats(w http.ResponseWriter, r *http.Request) {
+	if h.cache == nil {
+		respondWithJSON(w, http.StatusOK, CacheStatsResponse{})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, CacheStatsResponse{
+		Enabled:    true,
+		CacheStats: h.cache.Stats(),
+	})
+}
+
+type ModerationEventsResponse struct {
+	Events []domain.ModerationEvent `json:"events"`
+}
+
+// HandleModerationEvents lists recent moderation decisions, newest first.
+// Decisions that allowed content are left out unless all=true.
+func (h *Handler) HandleModerationEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	since := time.Now().Add(-24 * time.Hour)
+	if v := query.Get("since"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "since must be an RFC 3339 timestamp")
+			return
+		}
+		since = parsed
+	}
+	limit := 100
+	if v := query.Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 {
+			respondWithError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(parsed, 1000)
+	}
+
+	events, err := h.eventProv.ListModerationEvents(since, query.Get("all") != "true", limit)
+	if err != nil {
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Failed to load moderation events")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, ModerationEventsResponse{Events: events})
+}
+
+type StatusResponse struct {
+	Status string             `json:"status"`
+	Chat   chat.ServiceStatus `json:"chat"`
+}
+
+// HandleStatus reports whether generation is healthy. It answers 200 even
+// when degraded so monitors can read the breaker state.
+func (h *Handler) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	chatStatus := h.gpt.Status()
+
+	status := "ok"
+	if chatStatus.Breaker.State != retry.StateClosed {
+		status = "degraded"
+	}
+
+	respondWithJSON(w, http.StatusOK, StatusResponse{
+		Status: status,
+		Chat:   chatStatus,
 	})
 }
 
@@ -135,17 +538,59 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Write(response)
 }
 
+// respondWithError translates message into the response's locale and adds
+// its stable code.
 func respondWithError(w http.ResponseWriter, code int, message string) {
+	errorCode, message := localizeError(responseLocale(w), code, message)
 	respondWithJSON(w, code, ChatResponse{
 		Error: message,
+		Code:  errorCode,
 	})
 }
 
+// chatErrorStatus maps errors from chat.Service to an HTTP status and message.
+func chatErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, chat.ErrUnknownPersona):
+		return http.StatusBadRequest, "Unknown persona"
+	case errors.Is(err, chat.ErrInvalidSummaryOptions):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, chat.ErrSchemaViolation):
+		return http.StatusBadGateway, "The assistant did not produce the requested format"
+	case errors.Is(err, chat.ErrRateLimited):
+		return http.StatusTooManyRequests, "Too many requests, please try again shortly"
+	case errors.Is(err, chat.ErrContentBlocked):
+		return http.StatusUnprocessableEntity, "Message was blocked by the content filter"
+	case errors.Is(err, chat.ErrTimeout):
+		return http.StatusGatewayTimeout, "The assistant took too long to respond"
+	case errors.Is(err, chat.ErrUpstreamUnavailable), errors.Is(err, chat.ErrEmptyCompletion):
+		return http.StatusServiceUnavailable, "The assistant is temporarily unavailable"
+	case errors.Is(err, chat.ErrInvalidRequest):
+		return http.StatusBadGateway, "The assistant could not process this conversation"
+	default:
+		return http.StatusInternalServerError, "Internal server error"
+	}
+}
+
+func respondWithChatError(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.Canceled) {
+		// The client is gone; there is nobody to respond to
+		log.Println("Request cancelled: " + err.Error())
+		return
+	}
+
+	log.Println(err.Error())
+	code, message := chatErrorStatus(err)
+	respondWithError(w, code, message)
+}
+
+// AuthRequest starts a session. For /auth the user's identity comes from
+// the ID token in the Authorization header, not from the request.
 type AuthRequest struct {
-	Provider *domain.AuthProvider `json:"provider,omitempty"` // Optional: google/apple
-	Username *string              `json:"username,omitempty"` // Required for google/apple
-	Email    *string              `json:"email,omitempty"`    // Required for google/apple
+	Provider *domain.AuthProvider `json:"provider,omitempty"` // Required for /auth: google/apple
 	DeviceID *string              `json:"device_id"`          // Required for all requests
+	// Nonce is the raw nonce the client requested the ID token with.
+	Nonce string `json:"nonce,omitempty"`
 }
 
 func (h *Handler) HandleGuestAuth(w http.ResponseWriter, r *http.Request) {
@@ -161,11 +606,16 @@ func (h *Handler) HandleGuestAuth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Handle anonymous session
+	// Handle anonymous session. A device ID must not open the account of
+	// a user who signed in with a provider.
 	user, err := h.userProv.GetUserByUsername(*req.DeviceID)
+	if err == nil && user.AuthProvider != domain.AuthProviderGuest {
+		respondWithError(w, http.StatusConflict, "Username already in use")
+		return
+	}
 	if err == nil {
 		// Anonymous user exists, return it
-		respondWithJSON(w, http.StatusOK, AuthResponse{User: user})
+		h.startSession(w, r, http.StatusOK, user)
 		return
 	}
 
@@ -175,7 +625,7 @@ func (h *Handler) HandleGuestAuth(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, "Failed to create user")
 		return
 	}
-	respondWithJSON(w, http.StatusCreated, user)
+	h.startSession(w, r, http.StatusCreated, user)
 }
 
 func (h *Handler) HandleAuth(w http.ResponseWriter, r *http.Request) {
@@ -184,112 +634,103 @@ func (h *Handler) HandleAuth(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+
+	// Validate request
+	if req.Provider == nil || *req.Provider == "" {
+		respondWithError(w, http.StatusBadRequest, "provider is required")
+		return
+	}
+	if req.DeviceID == nil || *req.DeviceID == "" {
+		respondWithError(w, http.StatusBadRequest, "device_id is required")
+		return
+	}
+	verifier := h.auth.verifier(*req.Provider)
+	if verifier == nil {
+		respondWithError(w, http.StatusBadRequest, "Unsupported provider")
+		return
+	}
+
 	authHeader := r.Header.Get("Authorization")
 	if !strings.HasPrefix(authHeader, "Bearer ") {
 		respondWithError(w, http.StatusUnauthorized, "Authorization header missing or invalid")
 		return
 	}
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	// Parse the token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Verify the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, jwt.NewValidationError("unexpected signing method", jwt.ValidationErrorSignatureInvalid)
-		}
-		// Fetch the public key based on provider
-		switch *req.Provider {
-		// case domain.AuthProviderGoogle:
-		// Get Google's public key
-		//return GetGooglePublicKey(token)
-		case domain.AuthProviderApple:
-			// Get Apple's public key
-			return GetApplePublicKey(token, false)
-		default:
-			return nil, jwt.NewValidationError("unknown provider", jwt.ValidationErrorUnverifiable)
-		}
-	})
-	if err != nil || !token.Valid {
-		token, err = jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Verify the signing method
-			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-				return nil, jwt.NewValidationError("unexpected signing method", jwt.ValidationErrorSignatureInvalid)
-			}
-			// Fetch the public key based on provider
-			switch *req.Provider {
-			// case domain.AuthProviderGoogle:
-			// Get Google's public key
-			//return GetGooglePublicKey(token)
-			case domain.AuthProviderApple:
-				// Get Apple's public key
-				return GetApplePublicKey(token, true)
-			default:
-				return nil, jwt.NewValidationError("unknown provider", jwt.ValidationErrorUnverifiable)
-			}
-		})
-		if err != nil || !token.Valid {
-			respondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
-			return
-		}
-	}
-
-	// Extract claims
-	_, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
-		respondWithError(w, http.StatusUnauthorized, "Invalid token claims")
+	// Verify the signature and claims. A key ID the cached key set does not
+	// know makes the key set refresh, so rotated provider keys are picked up.
+	identity, err := verifier.Verify(r.Context(), tokenString, req.Nonce)
+	if err != nil {
+		log.Printf("Rejected %s identity token: %v", *req.Provider, err)
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
 		return
 	}
 
-	// Validate request
-	if req.DeviceID == nil || *req.DeviceID == "" {
-		respondWithError(w, http.StatusBadRequest, "device_id is required")
+	// Look up the user the provider knows by sub
+	user, err := h.userProv.GetUserBySubject(*req.Provider, identity.Subject)
+	if err == nil {
+		// User exists, return it
+		h.startSession(w, r, http.StatusOK, user)
 		return
 	}
-
-	// Handle authenticated session (Apple/Google)
-	if req.Email == nil || *req.Email == "" {
-		respondWithError(w, http.StatusBadRequest, "email is required for authenticated sessions")
+	if !errors.Is(err, userprovider.ErrUserNotFound) {
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch user")
 		return
 	}
 
-	// Look up user by email
-	user, err := h.userProv.GetUserByUsername(*req.Username)
+	// Users who signed up before subjects were recorded are linked on their
+	// first verified sign-in
+	user, err = h.userProv.LinkLegacyUser(*req.Provider, identity.Subject, identity.Email, identity.EmailVerified)
 	if err == nil {
-		// User exists, return it
-		respondWithJSON(w, http.StatusOK, AuthResponse{User: user})
+		h.startSession(w, r, http.StatusOK, user)
+		return
+	}
+	if errors.Is(err, userprovider.ErrSubjectTaken) {
+		h.signInLinkedUser(w, r, *req.Provider, identity.Subject)
+		return
+	}
+	if !errors.Is(err, userprovider.ErrUserNotFound) {
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch user")
 		return
 	}
 
 	// Create new authenticated user
-	user, err = h.userProv.CreateUser(*req.Provider, *req.Username, *req.Email)
+	user, err = h.userProv.CreateUserWithSubject(*req.Provider, identity.Subject, identity.Email)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to create user")
+		switch {
+		case errors.Is(err, userprovider.ErrSubjectTaken):
+			h.signInLinkedUser(w, r, *req.Provider, identity.Subject)
+		case errors.Is(err, userprovider.ErrUsernameTaken):
+			respondWithError(w, http.StatusConflict, "Username already in use")
+		default:
+			log.Println(err.Error())
+			respondWithError(w, http.StatusInternalServerError, "Failed to create user")
+		}
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, AuthResponse{User: user})
-	return
-}
-
-var (
-	publicKeyCache     = make(map[string]*rsa.PublicKey)
-	publicKeyCacheLock = sync.RWMutex{}
-)
-
-// Fetch Google's public key
-func GetGooglePublicKey(token *jwt.Token, forceRefresh bool) (interface{}, error) {
-	return jwtdecode.FetchPublicKeyFromURL("https://www.googleapis.com/oauth2/v3/certs", token, forceRefresh)
+	h.startSession(w, r, http.StatusCreated, user)
 }
 
-// Fetch Apple's public key
-func GetApplePublicKey(token *jwt.Token, forceRefresh bool) (interface{}, error) {
-	return jwtdecode.FetchPublicKeyFromURL("https://appleid.apple.com/auth/keys", token, forceRefresh)
+// signInLinkedUser signs in the user a concurrent sign-in with the same
+// subject created or linked first.
+func (h *Handler) signInLinkedUser(w http.ResponseWriter, r *http.Request, provider domain.AuthProvider, subject string) {
+	user, err := h.userProv.GetUserBySubject(provider, subject)
+	if err != nil {
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch user")
+		return
+	}
+	h.startSession(w, r, http.StatusOK, user)
 }
 
 type SetEntitlementsRequest struct {
-	Username     string              `json:"username"`
 	Subscription domain.Subscription `json:"subscription,omitempty"`
 }
 
+// HandleSetEntitlements sets the subscription of the user in the path. It is
+// an admin endpoint: clients cannot vouch for their own purchases.
 func (h *Handler) HandleSetEntitlements(w http.ResponseWriter, r *http.Request) {
 	var req SetEntitlementsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -297,23 +738,15 @@ func (h *Handler) HandleSetEntitlements(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Validate User ID
-	if req.Username == "" {
-		respondWithError(w, http.StatusBadRequest, "user_id is required")
+	user, err := h.userProv.GetUser(chi.URLParam(r, "userID"))
+	if errors.Is(err, userprovider.ErrUserNotFound) {
+		respondWithError(w, http.StatusNotFound, "User not found")
 		return
 	}
-
-	// Fetch existing user
-	user, err := h.userProv.GetUserByUsername(req.Username)
 	if err != nil {
-		switch err {
-		case userprovider.ErrUserNotFound:
-			respondWithError(w, http.StatusNotFound, "User not found")
-			return
-		default:
-			respondWithError(w, http.StatusInternalServerError, "Failed to fetch user")
-			return
-		}
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch user")
+		return
 	}
 
 	// Update entitlements
@@ -325,14 +758,14 @@ func (h *Handler) HandleSetEntitlements(w http.ResponseWriter, r *http.Request)
 	}
 	newEntitlements.Subscription = req.Subscription
 
-	if user.Entitlements.Subscription.Type == domain.SubscriptionTypePremium {
+	if req.Subscription.Type == domain.SubscriptionTypePremium {
 		newEntitlements.DailyMessageLimit = 10000
 		newEntitlements.MessagesUsed = 0
-	} else if user.Entitlements.Subscription.Type == domain.SubscriptionTypeFree {
+	} else if req.Subscription.Type == domain.SubscriptionTypeFree {
 		newEntitlements.DailyMessageLimit = userprovider.FREE_USER_MESSAGE_LIMIT
 	}
 
-	if err := h.userProv.SetEntitlements(req.Username, newEntitlements); err != nil {
+	if err := h.userProv.SetEntitlements(user.ID, newEntitlements); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to update entitlements")
 		return
 	}
@@ -340,12 +773,54 @@ func (h *Handler) HandleSetEntitlements(w http.ResponseWriter, r *http.Request)
 	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Entitlements updated successfully"})
 }
 
+// UpdateConfigRequest is a partial update: omitted fields keep their current
+// value. ContextBudgets, when present, replaces the whole map.
 type UpdateConfigRequest struct {
-	Model            string  `json:"model"`
-	MaxTokens        int     `json:"max_tokens"`
-	Temperature      float32 `json:"temperature"`
-	PresencePenalty  float32 `json:"presence_penalty"`
-	FrequencyPenalty float32 `json:"frequency_penalty"`
+	Model            *string        `json:"model"`
+	MaxTokens        *int           `json:"max_tokens"`
+	Temperature      *float32       `json:"temperature"`
+	PresencePenalty  *float32       `json:"presence_penalty"`
+	FrequencyPenalty *float32       `json:"frequency_penalty"`
+	ContextBudgets   map[string]int `json:"context_budgets,omitempty"`
+
+	// DryRun validates the result and sends a test completion with it, but
+	// neither applies nor stores it.
+	DryRun bool `json:"dry_run"`
+}
+
+// apply returns config with the request's fields overlaid.
+func (req UpdateConfigRequest) apply(config chat.Config) chat.Config {
+	if req.Model != nil {
+		config.Model = *req.Model
+	}
+	if req.MaxTokens != nil {
+		config.MaxTokens = *req.MaxTokens
+	}
+	if req.Temperature != nil {
+		config.Temperature = *req.Temperature
+	}
+	if req.PresencePenalty != nil {
+		config.PresencePenalty = *req.PresencePenalty
+	}
+	if req.FrequencyPenalty != nil {
+		config.FrequencyPenalty = *req.FrequencyPenalty
+	}
+	if req.ContextBudgets != nil {
+		config.ContextBudgets = req.ContextBudgets
+	}
+	return config
+}
+
+type ConfigResponse struct {
+	Config domain.ModelConfig `json:"config"`
+	DryRun bool               `json:"dry_run,omitempty"`
+	// Test is the reply to the dry run's test completion.
+	Test *chat.Result `json:"test,omitempty"`
+}
+
+func (h *Handler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	config := h.gpt.Config()
+	respondWithJSON(w, http.StatusOK, ConfigResponse{Config: config.ToModel()})
 }
 
 func (h *Handler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
@@ -355,29 +830,66 @@ func (h *Handler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newConfig := chat.Config{
-		Model:            req.Model,
-		MaxTokens:        req.MaxTokens,
-		Temperature:      req.Temperature,
-		PresencePenalty:  req.PresencePenalty,
-		FrequencyPenalty: req.FrequencyPenalty,
+	service := h.gpt
+	newConfig := req.apply(service.Config())
+	if err := service.ValidateConfig(r.Context(), newConfig); err != nil {
+		respondWithConfigError(w, err)
+		return
+	}
+
+	if req.DryRun {
+		result, err := service.TestConfig(r.Context(), newConfig)
+		if err != nil {
+			respondWithConfigError(w, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, ConfigResponse{
+			Config: newConfig.ToModel(),
+			DryRun: true,
+			Test:   &result,
+		})
+		return
 	}
 
-	h.service.(*chat.GPTService).UpdateConfig(newConfig)
-	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Config updated successfully"})
+	stored, err := h.configProv.SaveModelConfig(newConfig.ToModel())
+	if err != nil {
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Failed to save config")
+		return
+	}
+	service.UpdateConfig(newConfig)
+	respondWithJSON(w, http.StatusOK, ConfigResponse{Config: *stored})
+}
+
+func respondWithConfigError(w http.ResponseWriter, err error) {
+	if errors.Is(err, chat.ErrInvalidConfig) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondWithChatError(w, err)
 }
 
 type UpdatePromptRequest struct {
 	Prompt string `json:"prompt"`
+	Author string `json:"author"`
+	Note   string `json:"note"`
 }
 
+// UpdatePrompt stores the prompt as a new version and activates it.
 func (h *Handler) UpdatePrompt(w http.ResponseWriter, r *http.Request) {
 	var req UpdatePromptRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	if req.Author == "" {
+		req.Author = "update-prompt"
+	}
 
-	h.service.(*chat.GPTService).UpdateInitialPrompt(req.Prompt)
-	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Prompt updated successfully"})
+	version, err := h.promptProv.CreatePromptVersion(req.Prompt, req.Author, req.Note)
+	if err != nil {
+		respondWithPromptError(w, err)
+		return
+	}
+	h.activatePromptVersion(w, version.ID)
 }
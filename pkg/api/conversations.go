@@ -0,0 +1,190 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/fgb-andu/hustl-api/pkg/repository/conversationprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/userprovider"
+	"github.com/fgb-andu/hustl-api/pkg/service/chat"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultConversationPageSize = 20
+	maxConversationPageSize     = 100
+)
+
+type CreateConversationRequest struct {
+	Title string `json:"title"`
+}
+
+type ConversationListResponse struct {
+	Conversations []domain.Conversation `json:"conversations"`
+	Total         int                   `json:"total"`
+	Limit         int                   `json:"limit"`
+	Offset        int                   `json:"offset"`
+}
+
+func (h *Handler) HandleCreateConversation(w http.ResponseWriter, r *http.Request) {
+	var req CreateConversationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	conversation, err := h.convProv.CreateConversation(requestUser(r).ID, req.Title)
+	if err != nil {
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Failed to create conversation")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, conversation)
+}
+
+func (h *Handler) HandleListConversations(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := parsePagination(r)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	conversations, total, err := h.convProv.ListConversations(requestUser(r).ID, limit, offset)
+	if err != nil {
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Failed to list conversations")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, ConversationListResponse{
+		Conversations: conversations,
+		Total:         total,
+		Limit:         limit,
+		Offset:        offset,
+	})
+}
+
+func (h *Handler) HandleGetConversation(w http.ResponseWriter, r *http.Request) {
+	conversation, ok := h.authorizeConversation(w, chi.URLParam(r, "conversationID"), requestUser(r).ID)
+	if !ok {
+		return
+	}
+
+	var err error
+	conversation.Messages, err = h.convProv.GetMessages(conversation.ID)
+	if err != nil {
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Failed to load messages")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, conversation)
+}
+
+func (h *Handler) HandleDeleteConversation(w http.ResponseWriter, r *http.Request) {
+	conversation, ok := h.authorizeConversation(w, chi.URLParam(r, "conversationID"), requestUser(r).ID)
+	if !ok {
+		return
+	}
+
+	if err := h.convProv.DeleteConversation(conversation.ID); err != nil {
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete conversation")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Conversation deleted successfully"})
+}
+
+// authorizeConversation loads the conversation and checks that it belongs to
+// the user. It writes the error response itself and reports whether the
+// caller may continue. Conversations owned by someone else are reported as
+// not found so their IDs cannot be probed.
+func (h *Handler) authorizeConversation(w http.ResponseWriter, conversationID string, userID string) (*domain.Conversation, bool) {
+	conversation, err := h.convProv.GetConversation(conversationID)
+	if err == conversationprovider.ErrConversationNotFound || (err == nil && conversation.UserID != userID) {
+		respondWithError(w, http.StatusNotFound, "Conversation not found")
+		return nil, false
+	}
+	if err != nil {
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Failed to load conversation")
+		return nil, false
+	}
+
+	return conversation, true
+}
+
+// prepareConversation resolves the conversation referenced by a next-message
+// request. It returns a nil conversation when the request carries its own
+// history.
+func (h *Handler) prepareConversation(w http.ResponseWriter, user *domain.User, req ChatRequestV2) (*domain.Conversation, bool) {
+	if req.ConversationID == "" {
+		return nil, true
+	}
+
+	if req.Message == "" {
+		respondWithError(w, http.StatusBadRequest, "message is required when conversation_id is set")
+		return nil, false
+	}
+
+	return h.authorizeConversation(w, req.ConversationID, user.ID)
+}
+
+// appendUserMessage stores the new user turn and returns the full history.
+func (h *Handler) appendUserMessage(conversationID string, message string) ([]chat.Message, error) {
+	if _, err := h.convProv.AddMessage(conversationID, domain.MessageRoleUser, message, ""); err != nil {
+		return nil, err
+	}
+	return h.conversationHistory(conversationID)
+}
+
+// conversationHistory converts the stored messages into the format expected
+// by chat.Service.
+func (h *Handler) conversationHistory(conversationID string) ([]chat.Message, error) {
+	messages, err := h.convProv.GetMessages(conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]chat.Message, 0, len(messages))
+	for _, message := range messages {
+		history = append(history, chat.Message{
+			Role:      chat.Role(message.Role),
+			Content:   message.Content,
+			CreatedAt: message.CreatedAt,
+		})
+	}
+	return history, nil
+}
+
+func parsePagination(r *http.Request) (int, int, bool) {
+	limit, offset := defaultConversationPageSize, 0
+	var err error
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			return 0, 0, false
+		}
+		limit = min(limit, maxConversationPageSize)
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return 0, 0, false
+		}
+	}
+	return limit, offset, true
+}
+
+func respondWithUserError(w http.ResponseWriter, err error) {
+	switch err {
+	case userprovider.ErrUserNotFound:
+		respondWithError(w, http.StatusNotFound, "User not found")
+	case userprovider.ErrDailyLimitReached:
+		respondWithError(w, http.StatusForbidden, "Daily message limit reached")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
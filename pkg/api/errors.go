@@ -0,0 +1,291 @@
+package api
+
+import (
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"net/http"
+)
+
+// apiError is the catalog entry for an error message. Code is stable for
+// clients to branch on; the message is for people and is translated into the
+// response's locale where a translation exists. Admin-only errors have a
+// code but stay in English.
+type apiError struct {
+	Code         string
+	Translations map[domain.Locale]string
+}
+
+// errorCatalog is keyed by the English message handlers respond with,
+// including the messages of provider errors passed through as err.Error().
+// Change the key and the handler together; the code must never change.
+var errorCatalog = map[string]apiError{
+	// Requests
+	"Invalid request body": {"invalid_request_body", map[domain.Locale]string{
+		domain.LocaleGerman:  "Ungültiger Anfrageinhalt",
+		domain.LocaleSpanish: "El cuerpo de la solicitud no es válido",
+	}},
+	"Invalid pagination parameters": {"invalid_pagination", map[domain.Locale]string{
+		domain.LocaleGerman:  "Ungültige Paginierungsparameter",
+		domain.LocaleSpanish: "Parámetros de paginación no válidos",
+	}},
+	"Internal server error": {"internal_error", map[domain.Locale]string{
+		domain.LocaleGerman:  "Interner Serverfehler",
+		domain.LocaleSpanish: "Error interno del servidor",
+	}},
+	"Streaming unsupported": {"streaming_unsupported", map[domain.Locale]string{
+		domain.LocaleGerman:  "Streaming wird nicht unterstützt",
+		domain.LocaleSpanish: "El streaming no es compatible",
+	}},
+
+	// Users and auth
+	"User not found": {"user_not_found", map[domain.Locale]string{
+		domain.LocaleGerman:  "Nutzer nicht gefunden",
+		domain.LocaleSpanish: "Usuario no encontrado",
+	}},
+	"provider is required": {"provider_required", map[domain.Locale]string{
+		domain.LocaleGerman:  "provider ist erforderlich",
+		domain.LocaleSpanish: "provider es obligatorio",
+	}},
+	"Unsupported provider": {"unsupported_provider", map[domain.Locale]string{
+		domain.LocaleGerman:  "Nicht unterstützter Anbieter",
+		domain.LocaleSpanish: "Proveedor no compatible",
+	}},
+	"Username already in use": {"username_taken", map[domain.Locale]string{
+		domain.LocaleGerman:  "Der Nutzername ist bereits vergeben",
+		domain.LocaleSpanish: "El nombre de usuario ya está en uso",
+	}},
+	"device_id is required": {"device_id_required", map[domain.Locale]string{
+		domain.LocaleGerman:  "device_id ist erforderlich",
+		domain.LocaleSpanish: "device_id es obligatorio",
+	}},
+	"Authorization header missing or invalid": {"authorization_missing", map[domain.Locale]string{
+		domain.LocaleGerman:  "Authorization-Header fehlt oder ist ungültig",
+		domain.LocaleSpanish: "Falta el encabezado Authorization o no es válido",
+	}},
+	"Invalid or expired token": {"invalid_token", map[domain.Locale]string{
+		domain.LocaleGerman:  "Ungültiges oder abgelaufenes Token",
+		domain.LocaleSpanish: "Token no válido o caducado",
+	}},
+	"refresh_token is required": {"refresh_token_required", map[domain.Locale]string{
+		domain.LocaleGerman:  "refresh_token ist erforderlich",
+		domain.LocaleSpanish: "refresh_token es obligatorio",
+	}},
+	"Invalid or expired refresh token": {"invalid_refresh_token", map[domain.Locale]string{
+		domain.LocaleGerman:  "Ungültiges oder abgelaufenes Refresh-Token",
+		domain.LocaleSpanish: "Token de actualización no válido o caducado",
+	}},
+	"Failed to start session": {"session_start_failed", map[domain.Locale]string{
+		domain.LocaleGerman:  "Sitzung konnte nicht gestartet werden",
+		domain.LocaleSpanish: "No se pudo iniciar la sesión",
+	}},
+	"Failed to refresh session": {"session_refresh_failed", map[domain.Locale]string{
+		domain.LocaleGerman:  "Sitzung konnte nicht erneuert werden",
+		domain.LocaleSpanish: "No se pudo renovar la sesión",
+	}},
+	"Failed to create user": {"user_create_failed", map[domain.Locale]string{
+		domain.LocaleGerman:  "Nutzer konnte nicht angelegt werden",
+		domain.LocaleSpanish: "No se pudo crear el usuario",
+	}},
+	"Failed to fetch user": {"user_fetch_failed", map[domain.Locale]string{
+		domain.LocaleGerman:  "Nutzer konnte nicht geladen werden",
+		domain.LocaleSpanish: "No se pudo cargar el usuario",
+	}},
+	"Failed to update entitlements": {"entitlements_update_failed", map[domain.Locale]string{
+		domain.LocaleGerman:  "Berechtigungen konnten nicht aktualisiert werden",
+		domain.LocaleSpanish: "No se pudieron actualizar los derechos",
+	}},
+	"Daily message limit reached": {"daily_limit_reached", map[domain.Locale]string{
+		domain.LocaleGerman:  "Tägliches Nachrichtenlimit erreicht",
+		domain.LocaleSpanish: "Has alcanzado el límite diario de mensajes",
+	}},
+	"locale must be one of en, de or es": {"unsupported_locale", map[domain.Locale]string{
+		domain.LocaleGerman:  "Die Sprache muss en, de oder es sein",
+		domain.LocaleSpanish: "El idioma debe ser en, de o es",
+	}},
+
+	// Conversations and feedback
+	"Conversation not found": {"conversation_not_found", map[domain.Locale]string{
+		domain.LocaleGerman:  "Unterhaltung nicht gefunden",
+		domain.LocaleSpanish: "Conversación no encontrada",
+	}},
+	"message is required when conversation_id is set": {"message_required", map[domain.Locale]string{
+		domain.LocaleGerman:  "message ist erforderlich, wenn conversation_id gesetzt ist",
+		domain.LocaleSpanish: "message es obligatorio cuando se indica conversation_id",
+	}},
+	"Failed to create conversation": {"conversation_create_failed", map[domain.Locale]string{
+		domain.LocaleGerman:  "Unterhaltung konnte nicht angelegt werden",
+		domain.LocaleSpanish: "No se pudo crear la conversación",
+	}},
+	"Failed to list conversations": {"conversation_list_failed", map[domain.Locale]string{
+		domain.LocaleGerman:  "Unterhaltungen konnten nicht geladen werden",
+		domain.LocaleSpanish: "No se pudieron cargar las conversaciones",
+	}},
+	"Failed to load conversation": {"conversation_load_failed", map[domain.Locale]string{
+		domain.LocaleGerman:  "Unterhaltung konnte nicht geladen werden",
+		domain.LocaleSpanish: "No se pudo cargar la conversación",
+	}},
+	"Failed to store message": {"message_store_failed", map[domain.Locale]string{
+		domain.LocaleGerman:  "Nachricht konnte nicht gespeichert werden",
+		domain.LocaleSpanish: "No se pudo guardar el mensaje",
+	}},
+	"Failed to load messages": {"messages_load_failed", map[domain.Locale]string{
+		domain.LocaleGerman:  "Nachrichten konnten nicht geladen werden",
+		domain.LocaleSpanish: "No se pudieron cargar los mensajes",
+	}},
+	"Failed to delete conversation": {"conversation_delete_failed", map[domain.Locale]string{
+		domain.LocaleGerman:  "Unterhaltung konnte nicht gelöscht werden",
+		domain.LocaleSpanish: "No se pudo eliminar la conversación",
+	}},
+	"rating must be 1 or -1": {"invalid_rating", map[domain.Locale]string{
+		domain.LocaleGerman:  "rating muss 1 oder -1 sein",
+		domain.LocaleSpanish: "rating debe ser 1 o -1",
+	}},
+	"Failed to store feedback": {"feedback_store_failed", map[domain.Locale]string{
+		domain.LocaleGerman:  "Feedback konnte nicht gespeichert werden",
+		domain.LocaleSpanish: "No se pudo guardar la valoración",
+	}},
+
+	// Generation
+	"Unknown persona": {"unknown_persona", map[domain.Locale]string{
+		domain.LocaleGerman:  "Unbekannte Persona",
+		domain.LocaleSpanish: "Persona desconocida",
+	}},
+	"The assistant did not produce the requested format": {"output_format_failed", map[domain.Locale]string{
+		domain.LocaleGerman:  "Der Assistent hat nicht das gewünschte Format geliefert",
+		domain.LocaleSpanish: "El asistente no generó el formato solicitado",
+	}},
+	"Too many requests, please try again shortly": {"rate_limited", map[domain.Locale]string{
+		domain.LocaleGerman:  "Zu viele Anfragen, bitte versuche es gleich noch einmal",
+		domain.LocaleSpanish: "Demasiadas solicitudes, inténtalo de nuevo en breve",
+	}},
+	"Message was blocked by the content filter": {"content_blocked", map[domain.Locale]string{
+		domain.LocaleGerman:  "Die Nachricht wurde vom Inhaltsfilter blockiert",
+		domain.LocaleSpanish: "El filtro de contenido bloqueó el mensaje",
+	}},
+	"The assistant took too long to respond": {"assistant_timeout", map[domain.Locale]string{
+		domain.LocaleGerman:  "Der Assistent hat zu lange für eine Antwort gebraucht",
+		domain.LocaleSpanish: "El asistente tardó demasiado en responder",
+	}},
+	"The assistant is temporarily unavailable": {"assistant_unavailable", map[domain.Locale]string{
+		domain.LocaleGerman:  "Der Assistent ist vorübergehend nicht erreichbar",
+		domain.LocaleSpanish: "El asistente no está disponible temporalmente",
+	}},
+	"The assistant could not process this conversation": {"assistant_rejected", map[domain.Locale]string{
+		domain.LocaleGerman:  "Der Assistent konnte diese Unterhaltung nicht verarbeiten",
+		domain.LocaleSpanish: "El asistente no pudo procesar esta conversación",
+	}},
+
+	// Action plans
+	"The conversation has no messages to plan from": {"conversation_empty", map[domain.Locale]string{
+		domain.LocaleGerman:  "Die Unterhaltung enthält keine Nachrichten für einen Plan",
+		domain.LocaleSpanish: "La conversación no tiene mensajes con los que hacer un plan",
+	}},
+	"Action plan not found": {"action_plan_not_found", map[domain.Locale]string{
+		domain.LocaleGerman:  "Aktionsplan nicht gefunden",
+		domain.LocaleSpanish: "Plan de acción no encontrado",
+	}},
+	"Failed to store action plan": {"action_plan_store_failed", map[domain.Locale]string{
+		domain.LocaleGerman:  "Aktionsplan konnte nicht gespeichert werden",
+		domain.LocaleSpanish: "No se pudo guardar el plan de acción",
+	}},
+	"Failed to list action plans": {"action_plan_list_failed", map[domain.Locale]string{
+		domain.LocaleGerman:  "Aktionspläne konnten nicht geladen werden",
+		domain.LocaleSpanish: "No se pudieron cargar los planes de acción",
+	}},
+	"Failed to load action plan": {"action_plan_load_failed", map[domain.Locale]string{
+		domain.LocaleGerman:  "Aktionsplan konnte nicht geladen werden",
+		domain.LocaleSpanish: "No se pudo cargar el plan de acción",
+	}},
+
+	// Goals
+	"Goal not found": {"goal_not_found", map[domain.Locale]string{
+		domain.LocaleGerman:  "Ziel nicht gefunden",
+		domain.LocaleSpanish: "Objetivo no encontrado",
+	}},
+	"goal title is required": {"goal_title_required", map[domain.Locale]string{
+		domain.LocaleGerman:  "Das Ziel braucht einen Titel",
+		domain.LocaleSpanish: "El objetivo necesita un título",
+	}},
+	"goal title must be at most 200 characters": {"goal_title_too_long", map[domain.Locale]string{
+		domain.LocaleGerman:  "Der Titel darf höchstens 200 Zeichen lang sein",
+		domain.LocaleSpanish: "El título puede tener como máximo 200 caracteres",
+	}},
+	"target_date must be a date in YYYY-MM-DD form": {"invalid_target_date", map[domain.Locale]string{
+		domain.LocaleGerman:  "target_date muss ein Datum im Format JJJJ-MM-TT sein",
+		domain.LocaleSpanish: "target_date debe ser una fecha con el formato AAAA-MM-DD",
+	}},
+	"status must be active, completed or abandoned": {"invalid_goal_status", map[domain.Locale]string{
+		domain.LocaleGerman:  "status muss active, completed oder abandoned sein",
+		domain.LocaleSpanish: "status debe ser active, completed o abandoned",
+	}},
+	"only active goals accept check-ins": {"goal_not_active", map[domain.Locale]string{
+		domain.LocaleGerman:  "Check-ins sind nur für aktive Ziele möglich",
+		domain.LocaleSpanish: "Solo los objetivos activos admiten registros de progreso",
+	}},
+
+	// Nudges
+	"Nudge not found": {"nudge_not_found", map[domain.Locale]string{
+		domain.LocaleGerman:  "Nachricht nicht gefunden",
+		domain.LocaleSpanish: "Mensaje no encontrado",
+	}},
+	"timezone must be an IANA time zone such as Europe/Berlin": {"invalid_timezone", map[domain.Locale]string{
+		domain.LocaleGerman:  "timezone muss eine IANA-Zeitzone wie Europe/Berlin sein",
+		domain.LocaleSpanish: "timezone debe ser una zona horaria IANA como Europe/Madrid",
+	}},
+	"send_at, quiet_start and quiet_end must be times in HH:MM form": {"invalid_time_of_day", map[domain.Locale]string{
+		domain.LocaleGerman:  "send_at, quiet_start und quiet_end müssen Uhrzeiten im Format HH:MM sein",
+		domain.LocaleSpanish: "send_at, quiet_start y quiet_end deben ser horas con el formato HH:MM",
+	}},
+	"quiet_start and quiet_end must both be set or both be empty": {"invalid_quiet_hours", map[domain.Locale]string{
+		domain.LocaleGerman:  "quiet_start und quiet_end müssen beide gesetzt oder beide leer sein",
+		domain.LocaleSpanish: "quiet_start y quiet_end deben indicarse los dos o ninguno",
+	}},
+
+	// Admin
+	"Admin key missing or invalid":                        {"admin_unauthorized", nil},
+	"Persona not found":                                   {"persona_not_found", nil},
+	"Prompt version not found":                            {"prompt_version_not_found", nil},
+	"Experiment not found":                                {"experiment_not_found", nil},
+	"Fallback message not found":                          {"fallback_message_not_found", nil},
+	"category must be one of error, quota or maintenance": {"invalid_fallback_category", nil},
+	"content is required":                                 {"content_required", nil},
+	"weight must be a positive integer":                   {"invalid_weight", nil},
+	"from is required":                                    {"from_required", nil},
+	"Failed to save config":                               {"config_save_failed", nil},
+	"since must be an RFC 3339 timestamp":                 {"invalid_since", nil},
+	"limit must be a positive integer":                    {"invalid_limit", nil},
+	"Failed to load fallback stats":                       {"fallback_stats_failed", nil},
+	"Failed to load moderation events":                    {"moderation_events_failed", nil},
+}
+
+// statusErrorCodes cover messages that are not in the catalog, such as
+// validation errors that name the offending field.
+var statusErrorCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusUnauthorized:        "unauthorized",
+	http.StatusForbidden:           "forbidden",
+	http.StatusNotFound:            "not_found",
+	http.StatusConflict:            "conflict",
+	http.StatusUnprocessableEntity: "unprocessable",
+	http.StatusTooManyRequests:     "rate_limited",
+	http.StatusInternalServerError: "internal_error",
+	http.StatusBadGateway:          "bad_gateway",
+	http.StatusServiceUnavailable:  "unavailable",
+	http.StatusGatewayTimeout:      "timeout",
+}
+
+// localizeError returns the stable code for message and the message in
+// locale, falling back to the English message.
+func localizeError(locale domain.Locale, status int, message string) (string, string) {
+	entry, ok := errorCatalog[message]
+	if !ok {
+		code := statusErrorCodes[status]
+		if code == "" {
+			code = "error"
+		}
+		return code, message
+	}
+	if translated, ok := entry.Translations[locale]; ok {
+		message = translated
+	}
+	return entry.Code, message
+}
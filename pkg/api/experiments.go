@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/fgb-andu/hustl-api/pkg/repository/eventprovider"
+	"github.com/fgb-andu/hustl-api/pkg/repository/experimentprovider"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+)
+
+type CreateExperimentRequest struct {
+	Name     string           `json:"name"`
+	Variants []domain.Variant `json:"variants"`
+}
+
+type ExperimentListResponse struct {
+	Experiments []domain.Experiment `json:"experiments"`
+}
+
+func (h *Handler) HandleCreateExperiment(w http.ResponseWriter, r *http.Request) {
+	var req CreateExperimentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// A bad variant would send its share of users to the fallback path
+	for _, variant := range req.Variants {
+		if err := h.gpt.ValidateOverrides(r.Context(), variant.Overrides); err != nil {
+			respondWithConfigError(w, fmt.Errorf("variant %s: %w", variant.Name, err))
+			return
+		}
+	}
+
+	experiment, err := h.experimentProv.CreateExperiment(req.Name, req.Variants)
+	if err != nil {
+		respondWithExperimentError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, experiment)
+}
+
+func (h *Handler) HandleListExperiments(w http.ResponseWriter, r *http.Request) {
+	experiments, err := h.experimentProv.ListExperiments()
+	if err != nil {
+		respondWithExperimentError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, ExperimentListResponse{Experiments: experiments})
+}
+
+func (h *Handler) HandleGetExperiment(w http.ResponseWriter, r *http.Request) {
+	experiment, err := h.experimentProv.GetExperiment(chi.URLParam(r, "experimentID"))
+	if err != nil {
+		respondWithExperimentError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, experiment)
+}
+
+func (h *Handler) HandleStartExperiment(w http.ResponseWriter, r *http.Request) {
+	experiment, err := h.experimentProv.StartExperiment(chi.URLParam(r, "experimentID"))
+	if err != nil {
+		respondWithExperimentError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, experiment)
+}
+
+func (h *Handler) HandleStopExperiment(w http.ResponseWriter, r *http.Request) {
+	experiment, err := h.experimentProv.StopExperiment(chi.URLParam(r, "experimentID"))
+	if err != nil {
+		respondWithExperimentError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, experiment)
+}
+
+func (h *Handler) HandleExperimentReport(w http.ResponseWriter, r *http.Request) {
+	report, err := h.experimentProv.GetReport(chi.URLParam(r, "experimentID"))
+	if err != nil {
+		respondWithExperimentError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+func respondWithExperimentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, experimentprovider.ErrExperimentNotFound):
+		respondWithError(w, http.StatusNotFound, "Experiment not found")
+	case errors.Is(err, experimentprovider.ErrExperimentNameTaken),
+		errors.Is(err, experimentprovider.ErrExperimentRunning),
+		errors.Is(err, experimentprovider.ErrInvalidTransition):
+		respondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, experimentprovider.ErrInvalidExperiment):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+type FeedbackRequest struct {
+	ConversationID string                `json:"conversation_id,omitempty"`
+	MessageID      string                `json:"message_id,omitempty"`
+	Rating         domain.FeedbackRating `json:"rating"`
+	Comment        string                `json:"comment,omitempty"`
+}
+
+// HandleFeedback stores a thumbs up (1) or down (-1) for a reply.
+func (h *Handler) HandleFeedback(w http.ResponseWriter, r *http.Request) {
+	var req FeedbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Rating != domain.FeedbackPositive && req.Rating != domain.FeedbackNegative {
+		respondWithError(w, http.StatusBadRequest, "rating must be 1 or -1")
+		return
+	}
+
+	user := requestUser(r)
+	if req.ConversationID != "" {
+		if _, ok := h.authorizeConversation(w, req.ConversationID, user.ID); !ok {
+			return
+		}
+	}
+
+	err := h.eventProv.RecordFeedback(eventprovider.Feedback{
+		UserID:         user.ID,
+		ConversationID: req.ConversationID,
+		MessageID:      req.MessageID,
+		Rating:         req.Rating,
+		Comment:        req.Comment,
+	})
+	if err != nil {
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Failed to store feedback")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, map[string]string{"message": "Feedback recorded"})
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/fgb-andu/hustl-api/pkg/repository/fallbackprovider"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+)
+
+// FallbackMessageRequest holds the editable fields of a fallback message.
+// Weight defaults to 1.
+type FallbackMessageRequest struct {
+	Category domain.FallbackCategory `json:"category"`
+	Locale   domain.Locale           `json:"locale"`
+	Content  string                  `json:"content"`
+	Weight   *int                    `json:"weight"`
+	Enabled  *bool                   `json:"enabled"`
+}
+
+func (req FallbackMessageRequest) toMessage(id string) domain.FallbackMessage {
+	// New messages are enabled unless stated otherwise
+	enabled := req.Enabled == nil || *req.Enabled
+	weight := 1
+	if req.Weight != nil {
+		weight = *req.Weight
+	}
+	return domain.FallbackMessage{
+		ID:       id,
+		Category: req.Category,
+		Locale:   req.Locale,
+		Content:  req.Content,
+		Weight:   weight,
+		Enabled:  enabled,
+	}
+}
+
+type FallbackMessageListResponse struct {
+	Messages []domain.FallbackMessage `json:"messages"`
+}
+
+func (h *Handler) HandleCreateFallbackMessage(w http.ResponseWriter, r *http.Request) {
+	var req FallbackMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	message, err := h.fallbackProv.CreateFallbackMessage(req.toMessage(""))
+	if err != nil {
+		respondWithFallbackError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, message)
+}
+
+// HandleListFallbackMessages can be narrowed with the category and locale
+// query parameters.
+func (h *Handler) HandleListFallbackMessages(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	messages, err := h.fallbackProv.ListFallbackMessages(domain.FallbackCategory(query.Get("category")), domain.Locale(query.Get("locale")))
+	if err != nil {
+		respondWithFallbackError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, FallbackMessageListResponse{Messages: messages})
+}
+
+func (h *Handler) HandleGetFallbackMessage(w http.ResponseWriter, r *http.Request) {
+	message, err := h.fallbackProv.GetFallbackMessage(chi.URLParam(r, "messageID"))
+	if err != nil {
+		respondWithFallbackError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, message)
+}
+
+func (h *Handler) HandleUpdateFallbackMessage(w http.ResponseWriter, r *http.Request) {
+	var req FallbackMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	message, err := h.fallbackProv.UpdateFallbackMessage(req.toMessage(chi.URLParam(r, "messageID")))
+	if err != nil {
+		respondWithFallbackError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, message)
+}
+
+func (h *Handler) HandleDeleteFallbackMessage(w http.ResponseWriter, r *http.Request) {
+	if err := h.fallbackProv.DeleteFallbackMessage(chi.URLParam(r, "messageID")); err != nil {
+		respondWithFallbackError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Fallback message deleted successfully"})
+}
+
+func respondWithFallbackError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fallbackprovider.ErrFallbackMessageNotFound):
+		respondWithError(w, http.StatusNotFound, "Fallback message not found")
+	case errors.Is(err, fallbackprovider.ErrInvalidCategory),
+		errors.Is(err, fallbackprovider.ErrUnsupportedLocale),
+		errors.Is(err, fallbackprovider.ErrContentRequired),
+		errors.Is(err, fallbackprovider.ErrInvalidWeight):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
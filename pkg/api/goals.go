@@ -0,0 +1,247 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/fgb-andu/hustl-api/pkg/repository/goalprovider"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+)
+
+type CreateGoalRequest struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	TargetDate  string `json:"target_date"`
+}
+
+// UpdateGoalRequest changes only the fields that are set. An empty
+// target_date clears it.
+type UpdateGoalRequest struct {
+	Title       *string            `json:"title"`
+	Description *string            `json:"description"`
+	TargetDate  *string            `json:"target_date"`
+	Status      *domain.GoalStatus `json:"status"`
+}
+
+type CheckInRequest struct {
+	Note string `json:"note"`
+}
+
+type GoalListResponse struct {
+	Goals []domain.Goal `json:"goals"`
+}
+
+type GoalResponse struct {
+	domain.Goal
+	CheckIns []domain.GoalCheckIn `json:"check_ins"`
+}
+
+type CheckInResponse struct {
+	CheckIn domain.GoalCheckIn `json:"check_in"`
+	Streak  *domain.GoalStreak `json:"streak"`
+}
+
+type CheckInListResponse struct {
+	CheckIns []domain.GoalCheckIn `json:"check_ins"`
+}
+
+// recentCheckIns is how many check-ins come with a single goal.
+const recentCheckIns = 10
+
+func (h *Handler) HandleCreateGoal(w http.ResponseWriter, r *http.Request) {
+	var req CreateGoalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	goal, err := h.goalProv.CreateGoal(domain.Goal{
+		UserID:      requestUser(r).ID,
+		Title:       req.Title,
+		Description: req.Description,
+		TargetDate:  req.TargetDate,
+	})
+	if err != nil {
+		respondWithGoalError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, goal)
+}
+
+// HandleListGoals lists the user's goals with their streaks, optionally
+// filtered by status.
+func (h *Handler) HandleListGoals(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+
+	goals, err := h.goalProv.ListGoals(user.ID, domain.GoalStatus(r.URL.Query().Get("status")))
+	if err != nil {
+		respondWithGoalError(w, err)
+		return
+	}
+	now := h.userNow(user.ID)
+	for i := range goals {
+		if goals[i].Streak, err = h.goalProv.GetStreak(goals[i].ID, now); err != nil {
+			respondWithGoalError(w, err)
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, GoalListResponse{Goals: goals})
+}
+
+func (h *Handler) HandleGetGoal(w http.ResponseWriter, r *http.Request) {
+	goal, ok := h.authorizeGoal(w, chi.URLParam(r, "goalID"), requestUser(r).ID)
+	if !ok {
+		return
+	}
+
+	var err error
+	if goal.Streak, err = h.goalProv.GetStreak(goal.ID, h.userNow(goal.UserID)); err != nil {
+		respondWithGoalError(w, err)
+		return
+	}
+	checkIns, err := h.goalProv.ListCheckIns(goal.ID, recentCheckIns)
+	if err != nil {
+		respondWithGoalError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, GoalResponse{Goal: *goal, CheckIns: checkIns})
+}
+
+func (h *Handler) HandleUpdateGoal(w http.ResponseWriter, r *http.Request) {
+	var req UpdateGoalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	goal, ok := h.authorizeGoal(w, chi.URLParam(r, "goalID"), requestUser(r).ID)
+	if !ok {
+		return
+	}
+
+	if req.Title != nil {
+		goal.Title = *req.Title
+	}
+	if req.Description != nil {
+		goal.Description = *req.Description
+	}
+	if req.TargetDate != nil {
+		goal.TargetDate = *req.TargetDate
+	}
+	if req.Status != nil {
+		if *req.Status == "" {
+			respondWithGoalError(w, goalprovider.ErrInvalidStatus)
+			return
+		}
+		goal.Status = *req.Status
+	}
+
+	updated, err := h.goalProv.UpdateGoal(*goal)
+	if err != nil {
+		respondWithGoalError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+func (h *Handler) HandleDeleteGoal(w http.ResponseWriter, r *http.Request) {
+	goal, ok := h.authorizeGoal(w, chi.URLParam(r, "goalID"), requestUser(r).ID)
+	if !ok {
+		return
+	}
+
+	if err := h.goalProv.DeleteGoal(goal.ID); err != nil {
+		respondWithGoalError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Goal deleted successfully"})
+}
+
+// HandleCheckIn records progress on a goal and returns the updated streak.
+func (h *Handler) HandleCheckIn(w http.ResponseWriter, r *http.Request) {
+	var req CheckInRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	goal, ok := h.authorizeGoal(w, chi.URLParam(r, "goalID"), requestUser(r).ID)
+	if !ok {
+		return
+	}
+
+	now := h.userNow(goal.UserID)
+	checkIn, err := h.goalProv.CheckIn(goal.ID, req.Note, now)
+	if err != nil {
+		respondWithGoalError(w, err)
+		return
+	}
+	streak, err := h.goalProv.GetStreak(goal.ID, now)
+	if err != nil {
+		respondWithGoalError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, CheckInResponse{CheckIn: *checkIn, Streak: streak})
+}
+
+func (h *Handler) HandleListCheckIns(w http.ResponseWriter, r *http.Request) {
+	goal, ok := h.authorizeGoal(w, chi.URLParam(r, "goalID"), requestUser(r).ID)
+	if !ok {
+		return
+	}
+
+	limit, _, ok := parsePagination(r)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	checkIns, err := h.goalProv.ListCheckIns(goal.ID, limit)
+	if err != nil {
+		respondWithGoalError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, CheckInListResponse{CheckIns: checkIns})
+}
+
+// authorizeGoal loads the goal and checks that it belongs to the user. Like
+// authorizeConversation it writes the error response itself and hides other
+// users' goals behind a 404.
+func (h *Handler) authorizeGoal(w http.ResponseWriter, goalID string, userID string) (*domain.Goal, bool) {
+	goal, err := h.goalProv.GetGoal(goalID)
+	if err == nil && goal.UserID != userID {
+		err = goalprovider.ErrGoalNotFound
+	}
+	if err != nil {
+		respondWithGoalError(w, err)
+		return nil, false
+	}
+
+	return goal, true
+}
+
+func respondWithGoalError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, goalprovider.ErrGoalNotFound):
+		respondWithError(w, http.StatusNotFound, "Goal not found")
+	case errors.Is(err, goalprovider.ErrGoalNotActive):
+		respondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, goalprovider.ErrTitleRequired),
+		errors.Is(err, goalprovider.ErrTitleTooLong),
+		errors.Is(err, goalprovider.ErrInvalidTargetDate),
+		errors.Is(err, goalprovider.ErrInvalidStatus):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
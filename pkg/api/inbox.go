@@ -0,0 +1,143 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/fgb-andu/hustl-api/pkg/repository/nudgeprovider"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"time"
+)
+
+type InboxResponse struct {
+	Nudges []domain.Nudge `json:"nudges"`
+	Unread int            `json:"unread"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+}
+
+// NudgeSettingsRequest replaces the user's settings. Empty timezone and
+// send_at fall back to UTC and 09:00.
+type NudgeSettingsRequest struct {
+	Enabled    bool   `json:"enabled"`
+	Timezone   string `json:"timezone"`
+	SendAt     string `json:"send_at"`
+	QuietStart string `json:"quiet_start"`
+	QuietEnd   string `json:"quiet_end"`
+}
+
+// HandleInbox lists the user's nudges, newest first. unread=true leaves out
+// the ones already read.
+func (h *Handler) HandleInbox(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+
+	limit, offset, ok := parsePagination(r)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	nudges, err := h.nudgeProv.ListNudges(user.ID, r.URL.Query().Get("unread") == "true", limit, offset)
+	if err != nil {
+		respondWithNudgeError(w, err)
+		return
+	}
+	unread, err := h.nudgeProv.CountUnreadNudges(user.ID)
+	if err != nil {
+		respondWithNudgeError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, InboxResponse{
+		Nudges: nudges,
+		Unread: unread,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// HandleMarkNudgeRead reports nudges owned by someone else as not found.
+func (h *Handler) HandleMarkNudgeRead(w http.ResponseWriter, r *http.Request) {
+	nudge, err := h.nudgeProv.GetNudge(chi.URLParam(r, "nudgeID"))
+	if err == nil && nudge.UserID != requestUser(r).ID {
+		err = nudgeprovider.ErrNudgeNotFound
+	}
+	if err == nil {
+		err = h.nudgeProv.MarkNudgeRead(nudge.ID, time.Now())
+	}
+	if err == nil {
+		nudge, err = h.nudgeProv.GetNudge(nudge.ID)
+	}
+	if err != nil {
+		respondWithNudgeError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, nudge)
+}
+
+func (h *Handler) HandleGetNudgeSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.nudgeProv.GetNudgeSettings(requestUser(r).ID)
+	if err != nil {
+		respondWithNudgeError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, settings)
+}
+
+func (h *Handler) HandleUpdateNudgeSettings(w http.ResponseWriter, r *http.Request) {
+	var req NudgeSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	settings, err := h.nudgeProv.SaveNudgeSettings(domain.NudgeSettings{
+		UserID:     requestUser(r).ID,
+		Enabled:    req.Enabled,
+		Timezone:   req.Timezone,
+		SendAt:     req.SendAt,
+		QuietStart: req.QuietStart,
+		QuietEnd:   req.QuietEnd,
+	})
+	if err != nil {
+		respondWithNudgeError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, settings)
+}
+
+// userNow returns the current time in the timezone from the user's nudge
+// settings, so calendar days match the user's. It falls back to the server's
+// time.
+func (h *Handler) userNow(userID string) time.Time {
+	now := time.Now()
+	settings, err := h.nudgeProv.GetNudgeSettings(userID)
+	if err != nil {
+		log.Println(err.Error())
+		return now
+	}
+	location, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		return now
+	}
+	return now.In(location)
+}
+
+func respondWithNudgeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, nudgeprovider.ErrNudgeNotFound):
+		respondWithError(w, http.StatusNotFound, "Nudge not found")
+	case errors.Is(err, nudgeprovider.ErrInvalidTimezone),
+		errors.Is(err, nudgeprovider.ErrInvalidClock),
+		errors.Is(err, nudgeprovider.ErrQuietHours):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
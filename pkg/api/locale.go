@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/fgb-andu/hustl-api/pkg/repository/userprovider"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type SetLocaleRequest struct {
+	// Locale is a language tag such as "de" or "es-MX"; empty clears the
+	// stored locale.
+	Locale string `json:"locale"`
+}
+
+// localeNames are the languages summaries are written in.
+var localeNames = map[domain.Locale]string{
+	domain.LocaleEnglish: "English",
+	domain.LocaleGerman:  "German",
+	domain.LocaleSpanish: "Spanish",
+}
+
+// parseLocale maps a language tag such as "de-AT" or "es_419" to a supported
+// locale by its primary subtag.
+func parseLocale(tag string) (domain.Locale, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	locale := domain.Locale(tag)
+	return locale, locale.Supported()
+}
+
+// negotiateLocale picks the supported locale the Accept-Language header
+// prefers most. Ties keep the header's order. ok is false when the header
+// names no supported locale.
+func negotiateLocale(header string) (domain.Locale, bool) {
+	type candidate struct {
+		locale domain.Locale
+		q      float64
+	}
+
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if locale, ok := parseLocale(tag); ok && q > 0 {
+			candidates = append(candidates, candidate{locale: locale, q: q})
+		}
+	}
+	if len(candidates) == 0 {
+		return domain.DefaultLocale, false
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	return candidates[0].locale, true
+}
+
+// negotiateLocaleMiddleware answers every request in the language its
+// Accept-Language header prefers. Handlers that know the user switch to the
+// user's stored locale with useLocale.
+func negotiateLocaleMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale, _ := negotiateLocale(r.Header.Get("Accept-Language"))
+		w.Header().Set("Content-Language", string(locale))
+		w.Header().Add("Vary", "Accept-Language")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// responseLocale is the locale the response is being written in.
+func responseLocale(w http.ResponseWriter) domain.Locale {
+	if locale := domain.Locale(w.Header().Get("Content-Language")); locale.Supported() {
+		return locale
+	}
+	return domain.DefaultLocale
+}
+
+// useLocale answers in the user's stored locale, when they have one, rather
+// than the negotiated one, and returns the locale in use.
+func useLocale(w http.ResponseWriter, stored domain.Locale) domain.Locale {
+	if stored.Supported() {
+		w.Header().Set("Content-Language", string(stored))
+	}
+	return responseLocale(w)
+}
+
+// adoptLocale stores the negotiated locale for a user who has none yet, so
+// later requests without Accept-Language, and nudges, use it too.
+func (h *Handler) adoptLocale(r *http.Request, user *domain.User) {
+	if user.Locale != "" {
+		return
+	}
+	locale, ok := negotiateLocale(r.Header.Get("Accept-Language"))
+	if !ok {
+		return
+	}
+	if err := h.userProv.SetLocale(user.ID, locale); err != nil {
+		log.Println(err.Error())
+		return
+	}
+	user.Locale = locale
+}
+
+// HandleSetLocale stores the locale the user picked in the app.
+func (h *Handler) HandleSetLocale(w http.ResponseWriter, r *http.Request) {
+	var req SetLocaleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	locale := domain.Locale("")
+	if req.Locale != "" {
+		var ok bool
+		if locale, ok = parseLocale(req.Locale); !ok {
+			respondWithError(w, http.StatusBadRequest, userprovider.ErrUnsupportedLocale.Error())
+			return
+		}
+	}
+
+	user := requestUser(r)
+	if err := h.userProv.SetLocale(user.ID, locale); err != nil {
+		respondWithUserError(w, err)
+		return
+	}
+	user.Locale = locale
+
+	useLocale(w, user.Locale)
+	respondWithJSON(w, http.StatusOK, user)
+}
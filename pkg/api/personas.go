@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/fgb-andu/hustl-api/pkg/repository/personaprovider"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+)
+
+// PersonaRequest holds the editable fields of a persona. Empty or omitted
+// settings inherit the global prompt and config.
+type PersonaRequest struct {
+	Name string `json:"name"`
+	domain.Overrides
+	Enabled   *bool `json:"enabled"`
+	IsDefault bool  `json:"is_default"`
+}
+
+func (req PersonaRequest) toPersona(id string) domain.Persona {
+	// New personas are enabled unless stated otherwise
+	enabled := req.Enabled == nil || *req.Enabled
+	return domain.Persona{
+		ID:        id,
+		Name:      req.Name,
+		Overrides: req.Overrides,
+		Enabled:   enabled,
+		IsDefault: req.IsDefault,
+	}
+}
+
+type PersonaListResponse struct {
+	Personas []domain.Persona `json:"personas"`
+}
+
+func (h *Handler) HandleCreatePersona(w http.ResponseWriter, r *http.Request) {
+	var req PersonaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.gpt.ValidateOverrides(r.Context(), req.Overrides); err != nil {
+		respondWithConfigError(w, err)
+		return
+	}
+
+	persona, err := h.personaProv.CreatePersona(req.toPersona(""))
+	if err != nil {
+		respondWithPersonaError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, persona)
+}
+
+func (h *Handler) HandleListPersonas(w http.ResponseWriter, r *http.Request) {
+	personas, err := h.personaProv.ListPersonas()
+	if err != nil {
+		respondWithPersonaError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, PersonaListResponse{Personas: personas})
+}
+
+func (h *Handler) HandleGetPersona(w http.ResponseWriter, r *http.Request) {
+	persona, err := h.personaProv.GetPersona(chi.URLParam(r, "personaID"))
+	if err != nil {
+		respondWithPersonaError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, persona)
+}
+
+func (h *Handler) HandleUpdatePersona(w http.ResponseWriter, r *http.Request) {
+	var req PersonaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.gpt.ValidateOverrides(r.Context(), req.Overrides); err != nil {
+		respondWithConfigError(w, err)
+		return
+	}
+
+	persona, err := h.personaProv.UpdatePersona(req.toPersona(chi.URLParam(r, "personaID")))
+	if err != nil {
+		respondWithPersonaError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, persona)
+}
+
+func (h *Handler) HandleDeletePersona(w http.ResponseWriter, r *http.Request) {
+	if err := h.personaProv.DeletePersona(chi.URLParam(r, "personaID")); err != nil {
+		respondWithPersonaError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Persona deleted successfully"})
+}
+
+func respondWithPersonaError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, personaprovider.ErrPersonaNotFound):
+		respondWithError(w, http.StatusNotFound, "Persona not found")
+	case errors.Is(err, personaprovider.ErrPersonaNameTaken):
+		respondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, personaprovider.ErrPersonaNameRequired), errors.Is(err, personaprovider.ErrDefaultPersona):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/fgb-andu/hustl-api/pkg/repository/planprovider"
+	"github.com/fgb-andu/hustl-api/pkg/service/chat"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+)
+
+// ActionPlanRequest takes either a stored conversation or role-tagged
+// messages, like the v2 chat endpoints.
+type ActionPlanRequest struct {
+	ConversationID string         `json:"conversation_id,omitempty"`
+	Messages       []chat.Message `json:"messages,omitempty"`
+}
+
+type ActionPlanListResponse struct {
+	Plans  []domain.ActionPlan `json:"plans"`
+	Limit  int                 `json:"limit"`
+	Offset int                 `json:"offset"`
+}
+
+// HandleCreateActionPlan turns a conversation into a structured plan and
+// stores it for the user.
+func (h *Handler) HandleCreateActionPlan(w http.ResponseWriter, r *http.Request) {
+	var req ActionPlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	user := requestUser(r)
+	messages := req.Messages
+	if req.ConversationID != "" {
+		conversation, ok := h.authorizeConversation(w, req.ConversationID, user.ID)
+		if !ok {
+			return
+		}
+		var err error
+		if messages, err = h.conversationHistory(conversation.ID); err != nil {
+			log.Println(err.Error())
+			respondWithError(w, http.StatusInternalServerError, "Failed to load conversation")
+			return
+		}
+	} else if err := chat.ValidateClientMessages(messages); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(messages) == 0 {
+		respondWithError(w, http.StatusBadRequest, "The conversation has no messages to plan from")
+		return
+	}
+
+	// A plan costs a message, like a reply
+	reservation, err := h.userProv.ReserveMessage(user.ID)
+	if err != nil {
+		respondWithUserError(w, err)
+		return
+	}
+
+	plan, result, err := h.planner.GenerateActionPlan(r.Context(), chat.ActionPlanRequest{
+		UserID:         user.ID,
+		ConversationID: req.ConversationID,
+		Messages:       messages,
+		Now:            h.userNow(user.ID),
+	})
+	if err != nil {
+		h.releaseReservation(reservation)
+		respondWithChatError(w, err)
+		return
+	}
+	h.settleReservation(reservation, req.ConversationID, result)
+
+	plan.UserID = user.ID
+	plan.ConversationID = req.ConversationID
+	stored, err := h.planProv.CreateActionPlan(plan)
+	if err != nil {
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Failed to store action plan")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, stored)
+}
+
+func (h *Handler) HandleListActionPlans(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := parsePagination(r)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	plans, err := h.planProv.ListActionPlans(requestUser(r).ID, limit, offset)
+	if err != nil {
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Failed to list action plans")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, ActionPlanListResponse{
+		Plans:  plans,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// HandleGetActionPlan reports plans owned by someone else as not found, like
+// conversations.
+func (h *Handler) HandleGetActionPlan(w http.ResponseWriter, r *http.Request) {
+	plan, err := h.planProv.GetActionPlan(chi.URLParam(r, "planID"))
+	if err == planprovider.ErrActionPlanNotFound || (err == nil && plan.UserID != requestUser(r).ID) {
+		respondWithError(w, http.StatusNotFound, "Action plan not found")
+		return
+	}
+	if err != nil {
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Failed to load action plan")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, plan)
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/fgb-andu/hustl-api/pkg/repository/promptprovider"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"strings"
+)
+
+type CreatePromptVersionRequest struct {
+	Content string `json:"content"`
+	Author  string `json:"author"`
+	Note    string `json:"note"`
+	// Activate switches to the new version right away.
+	Activate bool `json:"activate"`
+}
+
+type PromptVersionListResponse struct {
+	Versions []domain.PromptVersion `json:"versions"`
+}
+
+// DiffLine is one line of a prompt diff. Op is "=" for unchanged lines, "-"
+// for lines only in From and "+" for lines only in To.
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+type PromptDiffResponse struct {
+	From  domain.PromptVersion `json:"from"`
+	To    domain.PromptVersion `json:"to"`
+	Lines []DiffLine           `json:"lines"`
+}
+
+func (h *Handler) HandleCreatePromptVersion(w http.ResponseWriter, r *http.Request) {
+	var req CreatePromptVersionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	version, err := h.promptProv.CreatePromptVersion(req.Content, req.Author, req.Note)
+	if err != nil {
+		respondWithPromptError(w, err)
+		return
+	}
+	if req.Activate {
+		h.activatePromptVersion(w, version.ID)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, version)
+}
+
+func (h *Handler) HandleListPromptVersions(w http.ResponseWriter, r *http.Request) {
+	versions, err := h.promptProv.ListPromptVersions()
+	if err != nil {
+		respondWithPromptError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, PromptVersionListResponse{Versions: versions})
+}
+
+func (h *Handler) HandleGetPromptVersion(w http.ResponseWriter, r *http.Request) {
+	version, err := h.promptProv.GetPromptVersion(chi.URLParam(r, "versionID"))
+	if err != nil {
+		respondWithPromptError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, version)
+}
+
+// HandleDiffPromptVersions compares two versions line by line. Both from and
+// to accept a version ID or number; to defaults to the active version.
+func (h *Handler) HandleDiffPromptVersions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("from") == "" {
+		respondWithError(w, http.StatusBadRequest, "from is required")
+		return
+	}
+
+	from, err := h.promptProv.GetPromptVersion(query.Get("from"))
+	if err != nil {
+		respondWithPromptError(w, err)
+		return
+	}
+	var to *domain.PromptVersion
+	if query.Get("to") == "" {
+		to, err = h.promptProv.GetActivePromptVersion()
+	} else {
+		to, err = h.promptProv.GetPromptVersion(query.Get("to"))
+	}
+	if err != nil {
+		respondWithPromptError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, PromptDiffResponse{
+		From:  *from,
+		To:    *to,
+		Lines: diffLines(from.Content, to.Content),
+	})
+}
+
+func (h *Handler) HandleActivatePromptVersion(w http.ResponseWriter, r *http.Request) {
+	h.activatePromptVersion(w, chi.URLParam(r, "versionID"))
+}
+
+// HandleRollbackPromptVersion reactivates the version that was active before
+// the current one.
+func (h *Handler) HandleRollbackPromptVersion(w http.ResponseWriter, r *http.Request) {
+	version, err := h.promptProv.RollbackPromptVersion()
+	if err != nil {
+		respondWithPromptError(w, err)
+		return
+	}
+
+	h.gpt.SetPromptVersion(version.ID, version.Content)
+	respondWithJSON(w, http.StatusOK, version)
+}
+
+// activatePromptVersion stores the activation and then switches the running
+// service over, so a restart comes back with the same prompt.
+func (h *Handler) activatePromptVersion(w http.ResponseWriter, id string) {
+	version, err := h.promptProv.ActivatePromptVersion(id)
+	if err != nil {
+		respondWithPromptError(w, err)
+		return
+	}
+
+	h.gpt.SetPromptVersion(version.ID, version.Content)
+	respondWithJSON(w, http.StatusOK, version)
+}
+
+func respondWithPromptError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, promptprovider.ErrPromptVersionNotFound):
+		respondWithError(w, http.StatusNotFound, "Prompt version not found")
+	case errors.Is(err, promptprovider.ErrNoActivePrompt), errors.Is(err, promptprovider.ErrNoPreviousVersion):
+		respondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, promptprovider.ErrPromptRequired), errors.Is(err, promptprovider.ErrAuthorRequired):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+// diffLines computes a line diff from the longest common subsequence.
+// Prompts are short, so the quadratic table is fine.
+func diffLines(from string, to string) []DiffLine {
+	a := strings.Split(from, "\n")
+	b := strings.Split(to, "\n")
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := []DiffLine{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, DiffLine{Op: "=", Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, DiffLine{Op: "-", Text: a[i]})
+			i++
+		default:
+			lines = append(lines, DiffLine{Op: "+", Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, DiffLine{Op: "-", Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, DiffLine{Op: "+", Text: b[j]})
+	}
+	return lines
+}
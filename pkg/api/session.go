@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/fgb-andu/hustl-api/pkg/repository/userprovider"
+	"github.com/fgb-andu/hustl-api/pkg/service/session"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// TokenResponse carries a session's tokens, shaped like an OAuth 2.0 token
+// response. The access token goes in the Authorization header as a bearer
+// token; the refresh token buys new tokens once, from /token/refresh.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func newTokenResponse(tokens *session.Tokens) *TokenResponse {
+	return &TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(tokens.AccessTTL.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+	}
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// startSession signs the user in: it responds with the user and the tokens
+// of a new session.
+func (h *Handler) startSession(w http.ResponseWriter, r *http.Request, code int, user *domain.User) {
+	tokens, err := h.auth.Sessions.Issue(user.ID)
+	if err != nil {
+		log.Println(err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Failed to start session")
+		return
+	}
+
+	h.adoptLocale(r, user)
+	respondWithJSON(w, code, AuthResponse{
+		User:   user,
+		Tokens: newTokenResponse(tokens),
+	})
+}
+
+// HandleRefreshToken exchanges a refresh token for new tokens. Each refresh
+// token works once; the response carries its replacement.
+func (h *Handler) HandleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.RefreshToken == "" {
+		respondWithError(w, http.StatusBadRequest, "refresh_token is required")
+		return
+	}
+
+	tokens, err := h.auth.Sessions.Refresh(req.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, session.ErrInvalidRefreshToken), errors.Is(err, session.ErrRefreshTokenReused):
+			respondWithError(w, http.StatusUnauthorized, "Invalid or expired refresh token")
+		default:
+			log.Println(err.Error())
+			respondWithError(w, http.StatusInternalServerError, "Failed to refresh session")
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newTokenResponse(tokens))
+}
+
+// HandleJWKS publishes the keys our access tokens are signed with, including
+// retired keys that are still configured for verification.
+func (h *Handler) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	respondWithJSON(w, http.StatusOK, h.auth.Sessions.Keys())
+}
+
+// userContextKey keys the signed-in user in a request's context.
+type userContextKey struct{}
+
+// authenticate lets a request through only with a valid access token in the
+// Authorization header. It loads the user the token was issued to and puts
+// them in the request context, where handlers get them with requestUser.
+func (h *Handler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			respondWithError(w, http.StatusUnauthorized, "Authorization header missing or invalid")
+			return
+		}
+
+		userID, err := h.auth.Sessions.Verify(strings.TrimPrefix(authHeader, "Bearer "))
+		if err != nil {
+			log.Println(err.Error())
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			respondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
+			return
+		}
+
+		// The user may have been deleted since the token was issued
+		user, err := h.userProv.GetUser(userID)
+		if errors.Is(err, userprovider.ErrUserNotFound) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			respondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
+			return
+		}
+		if err != nil {
+			log.Println(err.Error())
+			respondWithError(w, http.StatusInternalServerError, "Failed to fetch user")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, user)))
+	})
+}
+
+// authenticateAdmin lets a request through only with the configured admin
+// key in the X-Admin-Key header. Without a configured key, no request gets
+// through.
+func (h *Handler) authenticateAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-Admin-Key")
+		if h.auth.AdminKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(h.auth.AdminKey)) != 1 {
+			respondWithError(w, http.StatusUnauthorized, "Admin key missing or invalid")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestUser is the user authenticate loaded for the request. It is nil on
+// routes authenticate does not protect.
+func requestUser(r *http.Request) *domain.User {
+	user, _ := r.Context().Value(userContextKey{}).(*domain.User)
+	return user
+}
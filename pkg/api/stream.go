@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/fgb-andu/hustl-api/pkg/service/chat"
+	"log"
+	"net/http"
+)
+
+type StreamTokenEvent struct {
+	Content string `json:"content"`
+}
+
+type StreamErrorEvent struct {
+	// Status is the HTTP status the request would have failed with had the
+	// stream not already started.
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+	Code   string `json:"code"`
+}
+
+type QuotaInfo struct {
+	DailyMessageLimit int `json:"daily_message_limit"`
+	MessagesUsed      int `json:"messages_used"`
+	MessagesRemaining int `json:"messages_remaining"`
+}
+
+type StreamDoneEvent struct {
+	Result          string                  `json:"result"`
+	Persona         string                  `json:"persona,omitempty"`
+	PromptVersionID string                  `json:"prompt_version_id,omitempty"`
+	FinishReason    string                  `json:"finish_reason,omitempty"`
+	Usage           chat.Usage              `json:"usage"`
+	Quota           *QuotaInfo              `json:"quota,omitempty"`
+	Moderation      *chat.ModerationOutcome `json:"moderation,omitempty"`
+}
+
+// HandleNextMessageStream works like HandleNextMessage but sends the reply as
+// Server-Sent Events: one "token" event per delta, then a single "done" event
+// carrying usage and quota, or an "error" event if generation fails midway.
+func (h *Handler) HandleNextMessageStream(w http.ResponseWriter, r *http.Request) {
+	var req ChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	h.streamNextMessage(w, r, req.toV2())
+}
+
+func (h *Handler) streamNextMessage(w http.ResponseWriter, r *http.Request, req ChatRequestV2) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Streaming unsupported")
+		return
+	}
+
+	user := requestUser(r)
+	conversation, ok := h.prepareConversation(w, user, req)
+	if !ok {
+		return
+	}
+
+	// Check message limits; a stream is charged once, when it completes
+	reservation, err := h.userProv.ReserveMessage(user.ID)
+	if err != nil {
+		respondWithUserError(w, err)
+		return
+	}
+
+	messages := req.Messages
+	if conversation != nil {
+		if messages, err = h.appendUserMessage(conversation.ID, req.Message); err != nil {
+			h.releaseReservation(reservation)
+			log.Println(err.Error())
+			respondWithError(w, http.StatusInternalServerError, "Failed to store message")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// The request context is cancelled when the client goes away, which
+	// aborts the upstream completion as well.
+	nextReq := chat.NextMessageRequest{
+		UserID:         user.ID,
+		ConversationID: req.ConversationID,
+		PersonaID:      req.PersonaID,
+		Messages:       messages,
+		Now:            h.userNow(user.ID),
+		Locale:         useLocale(w, user.Locale),
+	}
+	result, err := h.service.StreamNextMessage(r.Context(), nextReq, func(delta string) error {
+		return writeSSE(w, flusher, "token", StreamTokenEvent{Content: delta})
+	})
+	if err != nil {
+		h.releaseReservation(reservation)
+		if r.Context().Err() != nil {
+			log.Println("Client disconnected during stream.")
+			return
+		}
+		log.Println(err.Error())
+		status, message := chatErrorStatus(err)
+		code, message := localizeError(responseLocale(w), status, message)
+		writeSSE(w, flusher, "error", StreamErrorEvent{Status: status, Error: message, Code: code})
+		return
+	}
+
+	h.settleReservation(reservation, req.ConversationID, result)
+
+	if conversation != nil {
+		if _, err := h.convProv.AddMessage(conversation.ID, domain.MessageRoleAssistant, result.Content, result.PromptVersionID); err != nil {
+			log.Println(err.Error())
+		}
+	}
+
+	done := StreamDoneEvent{
+		Result:          result.Content,
+		Persona:         result.Persona,
+		PromptVersionID: result.PromptVersionID,
+		FinishReason:    result.FinishReason,
+		Usage:           result.Usage,
+		Moderation:      result.Moderation,
+	}
+	// The quota has changed since the user was loaded
+	if user, err := h.userProv.GetUser(user.ID); err == nil {
+		done.Quota = &QuotaInfo{
+			DailyMessageLimit: user.Entitlements.DailyMessageLimit,
+			MessagesUsed:      user.Entitlements.MessagesUsed,
+			MessagesRemaining: max(user.Entitlements.DailyMessageLimit-user.Entitlements.MessagesUsed, 0),
+		}
+	}
+	writeSSE(w, flusher, "done", done)
+}
+
+// writeSSE writes a single named event with a JSON payload and flushes it.
+func writeSSE(w http.ResponseWriter, flusher http.Flusher, event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/fgb-andu/hustl-api/pkg/service/chat"
+	"net/http"
+)
+
+// ChatRequestV2 carries explicit roles for every message. System messages
+// are reserved for the server and rejected. Like every user endpoint it acts
+// for the user the access token was issued to.
+type ChatRequestV2 struct {
+	Messages []chat.Message `json:"messages"`
+
+	// When ConversationID is set the history is loaded from storage and
+	// Messages is ignored; Message carries the new user turn instead.
+	ConversationID string `json:"conversation_id,omitempty"`
+	Message        string `json:"message,omitempty"`
+
+	PersonaID string `json:"persona_id,omitempty"`
+
+	Summary chat.SummaryOptions `json:"summary,omitempty"`
+}
+
+// toV2 adapts a v1 request, whose roles are implied by position.
+func (req ChatRequest) toV2() ChatRequestV2 {
+	return ChatRequestV2{
+		Messages:       chat.FromLegacyMessages(req.Messages),
+		ConversationID: req.ConversationID,
+		Message:        req.Message,
+		PersonaID:      req.PersonaID,
+		Summary:        req.Summary,
+	}
+}
+
+// decodeChatRequestV2 decodes and validates a v2 request, writing the error
+// response itself when the request is unusable.
+func decodeChatRequestV2(w http.ResponseWriter, r *http.Request) (ChatRequestV2, bool) {
+	var req ChatRequestV2
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return req, false
+	}
+
+	if err := chat.ValidateClientMessages(req.Messages); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return req, false
+	}
+
+	return req, true
+}
+
+func (h *Handler) HandleSummarizeV2(w http.ResponseWriter, r *http.Request) {
+	if req, ok := decodeChatRequestV2(w, r); ok {
+		h.summarize(w, r, req)
+	}
+}
+
+func (h *Handler) HandleNextMessageV2(w http.ResponseWriter, r *http.Request) {
+	if req, ok := decodeChatRequestV2(w, r); ok {
+		h.nextMessage(w, r, req)
+	}
+}
+
+func (h *Handler) HandleNextMessageStreamV2(w http.ResponseWriter, r *http.Request) {
+	if req, ok := decodeChatRequestV2(w, r); ok {
+		h.streamNextMessage(w, r, req)
+	}
+}
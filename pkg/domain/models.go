@@ -12,6 +12,34 @@ const (
 	AuthProviderGuest  AuthProvider = "guest"
 )
 
+// Locale is a language the app is offered in, as a BCP 47 primary
+// language subtag.
+type Locale string
+
+const (
+	LocaleEnglish Locale = "en"
+	LocaleGerman  Locale = "de"
+	LocaleSpanish Locale = "es"
+)
+
+// DefaultLocale is used when neither the user nor the request names a
+// supported locale.
+const DefaultLocale = LocaleEnglish
+
+// SupportedLocales lists every locale with prompts, fallbacks and error
+// messages.
+var SupportedLocales = []Locale{LocaleEnglish, LocaleGerman, LocaleSpanish}
+
+// Supported reports whether l is one of SupportedLocales.
+func (l Locale) Supported() bool {
+	for _, supported := range SupportedLocales {
+		if l == supported {
+			return true
+		}
+	}
+	return false
+}
+
 type SubscriptionType string
 
 const (
@@ -47,7 +75,288 @@ type User struct {
 	AuthProvider AuthProvider `json:"auth_provider" db:"auth_provider"`
 	Username     string       `json:"username" db:"username"`
 	Email        string       `json:"email" db:"email"`
+	// Locale is empty until the user picks one or a request negotiates it
+	Locale       Locale       `json:"locale,omitempty" db:"locale"`
 	CreatedAt    time.Time    `json:"created_at" db:"created_at"`
 	LastActive   time.Time    `json:"last_active" db:"last_active"`
 	Entitlements Entitlements `json:"entitlements" db:"entitlements"`
 }
+
+type MessageRole string
+
+const (
+	MessageRoleUser      MessageRole = "user"
+	MessageRoleAssistant MessageRole = "assistant"
+)
+
+type Message struct {
+	ID             string      `json:"id" db:"id"`
+	ConversationID string      `json:"conversation_id" db:"conversation_id"`
+	Role           MessageRole `json:"role" db:"role"`
+	Content        string      `json:"content" db:"content"`
+	CreatedAt      time.Time   `json:"created_at" db:"created_at"`
+
+	// PromptVersionID is the prompt that produced an assistant reply. It is
+	// empty for user turns, canned fallbacks and persona-specific prompts.
+	PromptVersionID string `json:"prompt_version_id,omitempty" db:"prompt_version_id"`
+}
+
+type Conversation struct {
+	ID        string    `json:"id" db:"id"`
+	UserID    string    `json:"user_id" db:"user_id"`
+	Title     string    `json:"title" db:"title"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	Messages  []Message `json:"messages,omitempty"`
+}
+
+// Overrides replace parts of the global prompt and model configuration.
+// Empty or nil fields inherit the global value.
+type Overrides struct {
+	SystemPrompt     string   `json:"system_prompt" db:"system_prompt"`
+	Model            string   `json:"model" db:"model"`
+	MaxTokens        *int     `json:"max_tokens,omitempty" db:"max_tokens"`
+	Temperature      *float32 `json:"temperature,omitempty" db:"temperature"`
+	PresencePenalty  *float32 `json:"presence_penalty,omitempty" db:"presence_penalty"`
+	FrequencyPenalty *float32 `json:"frequency_penalty,omitempty" db:"frequency_penalty"`
+}
+
+// Persona is a coaching style.
+type Persona struct {
+	ID   string `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+	Overrides
+	Enabled   bool      `json:"enabled" db:"enabled"`
+	IsDefault bool      `json:"is_default" db:"is_default"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// PromptVersion is a stored revision of the global system prompt. Exactly
+// one version is active at a time.
+type PromptVersion struct {
+	ID          string     `json:"id" db:"id"`
+	Version     int        `json:"version" db:"version"`
+	Content     string     `json:"content" db:"content"`
+	Author      string     `json:"author" db:"author"`
+	Note        string     `json:"note" db:"note"`
+	Active      bool       `json:"active" db:"active"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	ActivatedAt *time.Time `json:"activated_at,omitempty" db:"activated_at"`
+}
+
+// ModelConfig is the stored generation configuration.
+type ModelConfig struct {
+	Model            string         `json:"model" db:"model"`
+	MaxTokens        int            `json:"max_tokens" db:"max_tokens"`
+	Temperature      float32        `json:"temperature" db:"temperature"`
+	PresencePenalty  float32        `json:"presence_penalty" db:"presence_penalty"`
+	FrequencyPenalty float32        `json:"frequency_penalty" db:"frequency_penalty"`
+	ContextBudgets   map[string]int `json:"context_budgets,omitempty" db:"context_budgets"`
+	UpdatedAt        time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+type ExperimentStatus string
+
+const (
+	ExperimentStatusDraft   ExperimentStatus = "draft"
+	ExperimentStatusRunning ExperimentStatus = "running"
+	ExperimentStatusStopped ExperimentStatus = "stopped"
+)
+
+// Experiment splits users between variants of the prompt and model config.
+// At most one experiment runs at a time.
+type Experiment struct {
+	ID        string           `json:"id" db:"id"`
+	Name      string           `json:"name" db:"name"`
+	Status    ExperimentStatus `json:"status" db:"status"`
+	Variants  []Variant        `json:"variants"`
+	CreatedAt time.Time        `json:"created_at" db:"created_at"`
+	StartedAt *time.Time       `json:"started_at,omitempty" db:"started_at"`
+	StoppedAt *time.Time       `json:"stopped_at,omitempty" db:"stopped_at"`
+}
+
+// Variant is one arm of an experiment. Weight sets its share of users
+// relative to the other variants.
+type Variant struct {
+	ID           string `json:"id" db:"id"`
+	ExperimentID string `json:"experiment_id" db:"experiment_id"`
+	Name         string `json:"name" db:"name"`
+	Weight       int    `json:"weight" db:"weight"`
+	Overrides
+}
+
+type FeedbackRating int
+
+const (
+	FeedbackNegative FeedbackRating = -1
+	FeedbackPositive FeedbackRating = 1
+)
+
+// ModerationEvent records one moderator's decision about a message.
+type ModerationEvent struct {
+	ID             string    `json:"id" db:"id"`
+	Stage          string    `json:"stage" db:"stage"`
+	Moderator      string    `json:"moderator" db:"moderator"`
+	Action         string    `json:"action" db:"action"`
+	Categories     []string  `json:"categories,omitempty" db:"categories"`
+	Excerpt        string    `json:"excerpt,omitempty" db:"excerpt"`
+	UserID         string    `json:"user_id,omitempty" db:"user_id"`
+	ConversationID string    `json:"conversation_id,omitempty" db:"conversation_id"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+type PlanPriority string
+
+const (
+	PlanPriorityHigh   PlanPriority = "high"
+	PlanPriorityMedium PlanPriority = "medium"
+	PlanPriorityLow    PlanPriority = "low"
+)
+
+// ActionPlan is a structured plan extracted from a conversation.
+type ActionPlan struct {
+	ID             string     `json:"id" db:"id"`
+	UserID         string     `json:"user_id" db:"user_id"`
+	ConversationID string     `json:"conversation_id,omitempty" db:"conversation_id"`
+	Summary        string     `json:"summary"`
+	Goals          []PlanGoal `json:"goals"`
+	Model          string     `json:"model" db:"model"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
+
+type PlanGoal struct {
+	Title    string       `json:"title"`
+	Priority PlanPriority `json:"priority"`
+	Tasks    []PlanTask   `json:"tasks"`
+}
+
+// PlanTask is a single step. Deadline is a date in 2006-01-02 form, or empty
+// when the conversation gave no reason to pick one.
+type PlanTask struct {
+	Title    string       `json:"title"`
+	Deadline string       `json:"deadline,omitempty"`
+	Priority PlanPriority `json:"priority"`
+}
+
+type GoalStatus string
+
+const (
+	GoalStatusActive    GoalStatus = "active"
+	GoalStatusCompleted GoalStatus = "completed"
+	GoalStatusAbandoned GoalStatus = "abandoned"
+)
+
+// Goal is something a user committed to. TargetDate is a date in 2006-01-02
+// form, or empty for open-ended goals.
+type Goal struct {
+	ID          string      `json:"id" db:"id"`
+	UserID      string      `json:"user_id" db:"user_id"`
+	Title       string      `json:"title" db:"title"`
+	Description string      `json:"description,omitempty" db:"description"`
+	TargetDate  string      `json:"target_date,omitempty" db:"target_date"`
+	Status      GoalStatus  `json:"status" db:"status"`
+	Streak      *GoalStreak `json:"streak,omitempty"`
+	CreatedAt   time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at" db:"updated_at"`
+	CompletedAt *time.Time  `json:"completed_at,omitempty" db:"completed_at"`
+}
+
+// GoalCheckIn records progress on a goal. Day is the calendar date it counts
+// towards.
+type GoalCheckIn struct {
+	ID        string    `json:"id" db:"id"`
+	GoalID    string    `json:"goal_id" db:"goal_id"`
+	UserID    string    `json:"user_id" db:"user_id"`
+	Note      string    `json:"note,omitempty" db:"note"`
+	Day       string    `json:"day" db:"day"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// GoalStreak counts consecutive days with at least one check-in. The current
+// streak survives until a full day passes without one.
+type GoalStreak struct {
+	Current        int    `json:"current"`
+	Longest        int    `json:"longest"`
+	TotalDays      int    `json:"total_days"`
+	LastCheckIn    string `json:"last_check_in,omitempty"`
+	CheckedInToday bool   `json:"checked_in_today"`
+}
+
+// NudgeSettings is a user's opt-in to a daily proactive nudge. Timezone is an
+// IANA name; SendAt, QuietStart and QuietEnd are HH:MM in that zone. Quiet
+// hours may wrap past midnight and are off when either end is empty.
+type NudgeSettings struct {
+	UserID     string    `json:"user_id" db:"user_id"`
+	Enabled    bool      `json:"enabled" db:"enabled"`
+	Timezone   string    `json:"timezone" db:"timezone"`
+	SendAt     string    `json:"send_at" db:"send_at"`
+	QuietStart string    `json:"quiet_start,omitempty" db:"quiet_start"`
+	QuietEnd   string    `json:"quiet_end,omitempty" db:"quiet_end"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Nudge is a message the coach sent without being asked. Day is the user's
+// local date it was generated for.
+type Nudge struct {
+	ID          string     `json:"id" db:"id"`
+	UserID      string     `json:"user_id" db:"user_id"`
+	Day         string     `json:"day" db:"day"`
+	Content     string     `json:"content" db:"content"`
+	Model       string     `json:"model" db:"model"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty" db:"delivered_at"`
+	ReadAt      *time.Time `json:"read_at,omitempty" db:"read_at"`
+}
+
+// FallbackCategory groups fallback messages by the kind of failure they are
+// sent for.
+type FallbackCategory string
+
+const (
+	// FallbackCategoryError covers failures without a better match, such as
+	// timeouts and empty completions.
+	FallbackCategoryError FallbackCategory = "error"
+	// FallbackCategoryQuota is for the provider rate limiting us.
+	FallbackCategoryQuota FallbackCategory = "quota"
+	// FallbackCategoryMaintenance is for outages, including while the
+	// circuit breaker is open.
+	FallbackCategoryMaintenance FallbackCategory = "maintenance"
+)
+
+// Valid reports whether c is one of the categories above.
+func (c FallbackCategory) Valid() bool {
+	switch c {
+	case FallbackCategoryError, FallbackCategoryQuota, FallbackCategoryMaintenance:
+		return true
+	}
+	return false
+}
+
+// FallbackMessage is a canned reply sent when generation fails. Weight sets
+// how often it is picked relative to the other enabled messages of its
+// category and locale.
+type FallbackMessage struct {
+	ID        string           `json:"id" db:"id"`
+	Category  FallbackCategory `json:"category" db:"category"`
+	Locale    Locale           `json:"locale" db:"locale"`
+	Content   string           `json:"content" db:"content"`
+	Weight    int              `json:"weight" db:"weight"`
+	Enabled   bool             `json:"enabled" db:"enabled"`
+	CreatedAt time.Time        `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at" db:"updated_at"`
+}
+
+// RefreshToken is a stored refresh token. Only the SHA-256 of the token is
+// kept. Each refresh replaces the token with a new one of the same family,
+// so a replaced token showing up again means the family was stolen.
+type RefreshToken struct {
+	ID        string     `json:"id" db:"id"`
+	UserID    string     `json:"user_id" db:"user_id"`
+	FamilyID  string     `json:"family_id" db:"family_id"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty" db:"rotated_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
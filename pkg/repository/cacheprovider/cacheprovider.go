@@ -0,0 +1,72 @@
+package cacheprovider
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CacheProvider is the SQLite tier of the result cache. It satisfies
+// chat.ResultStore.
+type CacheProvider struct {
+	db *sql.DB
+}
+
+func NewCacheProvider(db *sql.DB) *CacheProvider {
+	return &CacheProvider{db: db}
+}
+
+// GetResult returns the stored value for key unless it has expired.
+func (p *CacheProvider) GetResult(key string) ([]byte, bool, error) {
+	var value []byte
+	err := p.db.QueryRow(`
+        SELECT value FROM result_cache WHERE key = ? AND expires_at > ?`,
+		key, time.Now(),
+	).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read cached result: %w", err)
+	}
+
+	return value, true, nil
+}
+
+func (p *CacheProvider) PutResult(key string, value []byte, ttl time.Duration) error {
+	now := time.Now()
+	_, err := p.db.Exec(`
+        INSERT INTO result_cache (key, value, created_at, expires_at)
+        VALUES (?, ?, ?, ?)
+        ON CONFLICT (key) DO UPDATE SET
+            value = excluded.value,
+            created_at = excluded.created_at,
+            expires_at = excluded.expires_at`,
+		key, value, now, now.Add(ttl),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to cache result: %w", err)
+	}
+
+	return nil
+}
+
+// PurgeResults deletes every cached result.
+func (p *CacheProvider) PurgeResults() error {
+	if _, err := p.db.Exec(`DELETE FROM result_cache`); err != nil {
+		return fmt.Errorf("failed to purge result cache: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredResults removes entries past their TTL and reports how many
+// there were.
+func (p *CacheProvider) DeleteExpiredResults() (int64, error) {
+	res, err := p.db.Exec(`DELETE FROM result_cache WHERE expires_at <= ?`, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired results: %w", err)
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,79 @@
+package configprovider
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"log"
+	"time"
+)
+
+var ErrConfigNotFound = errors.New("no model config stored")
+
+type ConfigProvider struct {
+	db *sql.DB
+}
+
+func NewConfigProvider(db *sql.DB) *ConfigProvider {
+	return &ConfigProvider{db: db}
+}
+
+func (p *ConfigProvider) GetModelConfig() (*domain.ModelConfig, error) {
+	var config domain.ModelConfig
+	var budgets string
+
+	err := p.db.QueryRow(`
+        SELECT model, max_tokens, temperature, presence_penalty, frequency_penalty, context_budgets, updated_at
+        FROM model_config WHERE id = 1`).Scan(
+		&config.Model, &config.MaxTokens, &config.Temperature, &config.PresencePenalty,
+		&config.FrequencyPenalty, &budgets, &config.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrConfigNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(budgets), &config.ContextBudgets); err != nil {
+		return nil, fmt.Errorf("failed to decode context budgets: %w", err)
+	}
+	return &config, nil
+}
+
+// SaveModelConfig stores the config, replacing the previous one.
+func (p *ConfigProvider) SaveModelConfig(config domain.ModelConfig) (*domain.ModelConfig, error) {
+	log.Println("Saving model config: " + config.Model)
+
+	if config.ContextBudgets == nil {
+		config.ContextBudgets = map[string]int{}
+	}
+	budgets, err := json.Marshal(config.ContextBudgets)
+	if err != nil {
+		return nil, err
+	}
+
+	config.UpdatedAt = time.Now()
+	_, err = p.db.Exec(`
+        INSERT INTO model_config (
+            id, model, max_tokens, temperature, presence_penalty, frequency_penalty, context_budgets, updated_at
+        ) VALUES (1, ?, ?, ?, ?, ?, ?, ?)
+        ON CONFLICT (id) DO UPDATE SET
+            model = excluded.model,
+            max_tokens = excluded.max_tokens,
+            temperature = excluded.temperature,
+            presence_penalty = excluded.presence_penalty,
+            frequency_penalty = excluded.frequency_penalty,
+            context_budgets = excluded.context_budgets,
+            updated_at = excluded.updated_at`,
+		config.Model, config.MaxTokens, config.Temperature, config.PresencePenalty,
+		config.FrequencyPenalty, string(budgets), config.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save model config: %w", err)
+	}
+
+	return &config, nil
+}
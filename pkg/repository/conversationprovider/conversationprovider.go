@@ -0,0 +1,196 @@
+package conversationprovider
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+var (
+	ErrConversationNotFound = errors.New("conversation not found")
+)
+
+type ConversationProvider struct {
+	db *sql.DB
+}
+
+func NewConversationProvider(db *sql.DB) *ConversationProvider {
+	return &ConversationProvider{db: db}
+}
+
+func (p *ConversationProvider) CreateConversation(userID string, title string) (*domain.Conversation, error) {
+	log.Println("Creating conversation for user: " + userID)
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	_, err = p.db.Exec(`
+        INSERT INTO conversations (id, user_id, title, created_at, updated_at)
+        VALUES (?, ?, ?, ?, ?)`,
+		id.String(), userID, title, now, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create conversation: %w", err)
+	}
+
+	return &domain.Conversation{
+		ID:        id.String(),
+		UserID:    userID,
+		Title:     title,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// GetConversation returns the conversation without its messages.
+func (p *ConversationProvider) GetConversation(id string) (*domain.Conversation, error) {
+	var conversation domain.Conversation
+	err := p.db.QueryRow(`
+        SELECT id, user_id, title, created_at, updated_at
+        FROM conversations WHERE id = ?`, id).Scan(
+		&conversation.ID, &conversation.UserID, &conversation.Title,
+		&conversation.CreatedAt, &conversation.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &conversation, nil
+}
+
+// ListConversations returns a page of the user's conversations, most recently
+// updated first, along with the total number of conversations.
+func (p *ConversationProvider) ListConversations(userID string, limit int, offset int) ([]domain.Conversation, int, error) {
+	var total int
+	if err := p.db.QueryRow(`SELECT COUNT(*) FROM conversations WHERE user_id = ?`, userID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := p.db.Query(`
+        SELECT id, user_id, title, created_at, updated_at
+        FROM conversations WHERE user_id = ?
+        ORDER BY updated_at DESC
+        LIMIT ? OFFSET ?`, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	conversations := []domain.Conversation{}
+	for rows.Next() {
+		var conversation domain.Conversation
+		if err := rows.Scan(
+			&conversation.ID, &conversation.UserID, &conversation.Title,
+			&conversation.CreatedAt, &conversation.UpdatedAt,
+		); err != nil {
+			return nil, 0, err
+		}
+		conversations = append(conversations, conversation)
+	}
+
+	return conversations, total, rows.Err()
+}
+
+func (p *ConversationProvider) DeleteConversation(id string) error {
+	log.Println("Deleting conversation: " + id)
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM messages WHERE conversation_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete messages: %w", err)
+	}
+
+	res, err := tx.Exec(`DELETE FROM conversations WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete conversation: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrConversationNotFound
+	}
+
+	return tx.Commit()
+}
+
+// GetMessages returns every message in the conversation in the order it was added.
+func (p *ConversationProvider) GetMessages(conversationID string) ([]domain.Message, error) {
+	rows, err := p.db.Query(`
+        SELECT id, conversation_id, role, content, created_at, prompt_version_id
+        FROM messages WHERE conversation_id = ?
+        ORDER BY created_at, rowid`, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []domain.Message{}
+	for rows.Next() {
+		var message domain.Message
+		var promptVersionID sql.NullString
+		if err := rows.Scan(
+			&message.ID, &message.ConversationID, &message.Role,
+			&message.Content, &message.CreatedAt, &promptVersionID,
+		); err != nil {
+			return nil, err
+		}
+		message.PromptVersionID = promptVersionID.String
+		messages = append(messages, message)
+	}
+
+	return messages, rows.Err()
+}
+
+// AddMessage appends a message to the conversation and bumps its updated_at.
+// promptVersionID may be empty.
+func (p *ConversationProvider) AddMessage(conversationID string, role domain.MessageRole, content string, promptVersionID string) (*domain.Message, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.Exec(`
+        INSERT INTO messages (id, conversation_id, role, content, created_at, prompt_version_id)
+        VALUES (?, ?, ?, ?, ?, ?)`,
+		id.String(), conversationID, role, content, now,
+		sql.NullString{String: promptVersionID, Valid: promptVersionID != ""},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add message: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE conversations SET updated_at = ? WHERE id = ?`, now, conversationID); err != nil {
+		return nil, fmt.Errorf("failed to update conversation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &domain.Message{
+		ID:              id.String(),
+		ConversationID:  conversationID,
+		Role:            role,
+		Content:         content,
+		CreatedAt:       now,
+		PromptVersionID: promptVersionID,
+	}, nil
+}
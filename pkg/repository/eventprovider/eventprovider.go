@@ -0,0 +1,222 @@
+package eventprovider
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/google/uuid"
+	"log"
+	"strings"
+	"time"
+)
+
+type EventProvider struct {
+	db *sql.DB
+}
+
+func NewEventProvider(db *sql.DB) *EventProvider {
+	return &EventProvider{db: db}
+}
+
+// RecordFallback stores that a user was sent a canned reply instead of a
+// generated one.
+func (p *EventProvider) RecordFallback(userID string, conversationID string, reason string) error {
+	log.Println("Recording fallback for user " + userID + ": " + reason)
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.Exec(`
+        INSERT INTO fallback_events (id, user_id, conversation_id, reason, created_at)
+        VALUES (?, ?, ?, ?, ?)`,
+		id.String(), userID, sql.NullString{String: conversationID, Valid: conversationID != ""}, reason, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record fallback event: %w", err)
+	}
+
+	return nil
+}
+
+type FallbackStats struct {
+	Total    int            `json:"total"`
+	ByReason map[string]int `json:"by_reason"`
+	Since    time.Time      `json:"since"`
+}
+
+// GetFallbackStats counts fallback events since the given time.
+func (p *EventProvider) GetFallbackStats(since time.Time) (*FallbackStats, error) {
+	rows, err := p.db.Query(`
+        SELECT reason, COUNT(*)
+        FROM fallback_events WHERE created_at >= ?
+        GROUP BY reason`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := &FallbackStats{
+		ByReason: make(map[string]int),
+		Since:    since,
+	}
+	for rows.Next() {
+		var reason string
+		var count int
+		if err := rows.Scan(&reason, &count); err != nil {
+			return nil, err
+		}
+		stats.ByReason[reason] = count
+		stats.Total += count
+	}
+
+	return stats, rows.Err()
+}
+
+// UsageEvent describes one generated reply and what produced it.
+type UsageEvent struct {
+	UserID           string
+	ConversationID   string
+	PromptVersionID  string
+	Persona          string
+	ExperimentID     string
+	VariantID        string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// RecordUsage stores a generated reply so output can be traced back to the
+// prompt and model that produced it.
+func (p *EventProvider) RecordUsage(event UsageEvent) error {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.Exec(`
+        INSERT INTO usage_events (
+            id, user_id, conversation_id, prompt_version_id, persona, experiment_id, variant_id,
+            model, prompt_tokens, completion_tokens, created_at
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id.String(), event.UserID,
+		sql.NullString{String: event.ConversationID, Valid: event.ConversationID != ""},
+		sql.NullString{String: event.PromptVersionID, Valid: event.PromptVersionID != ""},
+		event.Persona,
+		sql.NullString{String: event.ExperimentID, Valid: event.ExperimentID != ""},
+		sql.NullString{String: event.VariantID, Valid: event.VariantID != ""},
+		event.Model, event.PromptTokens, event.CompletionTokens, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record usage event: %w", err)
+	}
+
+	return nil
+}
+
+// RecordNudgeUsage stores a generated nudge like a reply. Nudges belong to
+// no conversation.
+func (p *EventProvider) RecordNudgeUsage(userID string, promptVersionID string, model string, promptTokens int, completionTokens int) error {
+	return p.RecordUsage(UsageEvent{
+		UserID:           userID,
+		PromptVersionID:  promptVersionID,
+		Model:            model,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+	})
+}
+
+// Feedback is a user's rating of a reply.
+type Feedback struct {
+	UserID         string
+	ConversationID string
+	MessageID      string
+	Rating         domain.FeedbackRating
+	Comment        string
+}
+
+func (p *EventProvider) RecordFeedback(feedback Feedback) error {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.Exec(`
+        INSERT INTO message_feedback (id, user_id, conversation_id, message_id, rating, comment, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		id.String(), feedback.UserID,
+		sql.NullString{String: feedback.ConversationID, Valid: feedback.ConversationID != ""},
+		sql.NullString{String: feedback.MessageID, Valid: feedback.MessageID != ""},
+		feedback.Rating, feedback.Comment, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record feedback: %w", err)
+	}
+
+	return nil
+}
+
+// RecordModeration stores one moderator's decision. It satisfies
+// chat.ModerationAuditor.
+func (p *EventProvider) RecordModeration(event domain.ModerationEvent) error {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.Exec(`
+        INSERT INTO moderation_events (
+            id, stage, moderator, action, categories, excerpt, user_id, conversation_id, created_at
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id.String(), event.Stage, event.Moderator, event.Action,
+		strings.Join(event.Categories, ","), event.Excerpt,
+		sql.NullString{String: event.UserID, Valid: event.UserID != ""},
+		sql.NullString{String: event.ConversationID, Valid: event.ConversationID != ""},
+		time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record moderation event: %w", err)
+	}
+
+	return nil
+}
+
+// ListModerationEvents returns the newest decisions since the given time.
+// When flaggedOnly is set, content that was allowed is left out.
+func (p *EventProvider) ListModerationEvents(since time.Time, flaggedOnly bool, limit int) ([]domain.ModerationEvent, error) {
+	query := `
+        SELECT id, stage, moderator, action, categories, excerpt, user_id, conversation_id, created_at
+        FROM moderation_events WHERE created_at >= ?`
+	if flaggedOnly {
+		query += ` AND action != 'allow'`
+	}
+	query += ` ORDER BY created_at DESC LIMIT ?`
+
+	rows, err := p.db.Query(query, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []domain.ModerationEvent{}
+	for rows.Next() {
+		var event domain.ModerationEvent
+		var categories string
+		var userID, conversationID sql.NullString
+		err := rows.Scan(
+			&event.ID, &event.Stage, &event.Moderator, &event.Action, &categories, &event.Excerpt,
+			&userID, &conversationID, &event.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if categories != "" {
+			event.Categories = strings.Split(categories, ",")
+		}
+		event.UserID = userID.String
+		event.ConversationID = conversationID.String
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,389 @@
+package experimentprovider
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/fgb-andu/hustl-api/pkg/repository/sqliteerr"
+	"github.com/google/uuid"
+	"log"
+	"strings"
+	"time"
+)
+
+var (
+	ErrExperimentNotFound  = errors.New("experiment not found")
+	ErrExperimentNameTaken = errors.New("experiment name already in use")
+	ErrExperimentRunning   = errors.New("another experiment is already running")
+	ErrInvalidTransition   = errors.New("experiment cannot move to that status")
+	ErrInvalidExperiment   = errors.New("invalid experiment")
+)
+
+type ExperimentProvider struct {
+	db *sql.DB
+}
+
+func NewExperimentProvider(db *sql.DB) *ExperimentProvider {
+	return &ExperimentProvider{db: db}
+}
+
+// CreateExperiment stores a draft experiment. It needs at least two variants
+// with distinct names and positive weights.
+func (p *ExperimentProvider) CreateExperiment(name string, variants []domain.Variant) (*domain.Experiment, error) {
+	log.Println("Creating experiment: " + name)
+	if err := validateExperiment(name, variants); err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	experiment := &domain.Experiment{
+		ID:        id.String(),
+		Name:      name,
+		Status:    domain.ExperimentStatusDraft,
+		CreatedAt: time.Now(),
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+        INSERT INTO experiments (id, name, status, created_at)
+        VALUES (?, ?, ?, ?)`,
+		experiment.ID, experiment.Name, experiment.Status, experiment.CreatedAt,
+	)
+	if err != nil {
+		if sqliteerr.IsUniqueViolation(err, "experiments.name") {
+			return nil, ErrExperimentNameTaken
+		}
+		return nil, fmt.Errorf("failed to create experiment: %w", err)
+	}
+
+	for _, variant := range variants {
+		variantID, err := uuid.NewRandom()
+		if err != nil {
+			return nil, err
+		}
+		variant.ID = variantID.String()
+		variant.ExperimentID = experiment.ID
+
+		_, err = tx.Exec(`
+            INSERT INTO experiment_variants (
+                id, experiment_id, name, weight, system_prompt, model,
+                max_tokens, temperature, presence_penalty, frequency_penalty
+            ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			variant.ID, variant.ExperimentID, variant.Name, variant.Weight, variant.SystemPrompt, variant.Model,
+			variant.MaxTokens, variant.Temperature, variant.PresencePenalty, variant.FrequencyPenalty,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create variant: %w", err)
+		}
+		experiment.Variants = append(experiment.Variants, variant)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return experiment, nil
+}
+
+func validateExperiment(name string, variants []domain.Variant) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidExperiment)
+	}
+	if len(variants) < 2 {
+		return fmt.Errorf("%w: at least two variants are required", ErrInvalidExperiment)
+	}
+
+	names := make(map[string]bool)
+	for _, variant := range variants {
+		if strings.TrimSpace(variant.Name) == "" {
+			return fmt.Errorf("%w: every variant needs a name", ErrInvalidExperiment)
+		}
+		if names[variant.Name] {
+			return fmt.Errorf("%w: duplicate variant %s", ErrInvalidExperiment, variant.Name)
+		}
+		if variant.Weight <= 0 {
+			return fmt.Errorf("%w: variant %s needs a positive weight", ErrInvalidExperiment, variant.Name)
+		}
+		names[variant.Name] = true
+	}
+	return nil
+}
+
+func (p *ExperimentProvider) GetExperiment(id string) (*domain.Experiment, error) {
+	experiment, err := scanExperiment(p.db.QueryRow(`
+        SELECT id, name, status, created_at, started_at, stopped_at
+        FROM experiments WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+
+	if experiment.Variants, err = p.getVariants(experiment.ID); err != nil {
+		return nil, err
+	}
+	return experiment, nil
+}
+
+// ListExperiments returns every experiment, newest first.
+func (p *ExperimentProvider) ListExperiments() ([]domain.Experiment, error) {
+	rows, err := p.db.Query(`
+        SELECT id, name, status, created_at, started_at, stopped_at
+        FROM experiments ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	experiments := []domain.Experiment{}
+	for rows.Next() {
+		experiment, err := scanExperiment(rows)
+		if err != nil {
+			return nil, err
+		}
+		experiments = append(experiments, *experiment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range experiments {
+		if experiments[i].Variants, err = p.getVariants(experiments[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return experiments, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanExperiment(row rowScanner) (*domain.Experiment, error) {
+	var experiment domain.Experiment
+	var startedAt, stoppedAt sql.NullTime
+
+	err := row.Scan(
+		&experiment.ID, &experiment.Name, &experiment.Status,
+		&experiment.CreatedAt, &startedAt, &stoppedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrExperimentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if startedAt.Valid {
+		experiment.StartedAt = &startedAt.Time
+	}
+	if stoppedAt.Valid {
+		experiment.StoppedAt = &stoppedAt.Time
+	}
+	return &experiment, nil
+}
+
+// getVariants returns the experiment's variants in creation order, which is
+// the order assignment buckets are laid out in.
+func (p *ExperimentProvider) getVariants(experimentID string) ([]domain.Variant, error) {
+	rows, err := p.db.Query(`
+        SELECT id, experiment_id, name, weight, system_prompt, model,
+               max_tokens, temperature, presence_penalty, frequency_penalty
+        FROM experiment_variants WHERE experiment_id = ?
+        ORDER BY rowid`, experimentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := []domain.Variant{}
+	for rows.Next() {
+		var variant domain.Variant
+		var maxTokens sql.NullInt64
+		var temperature, presencePenalty, frequencyPenalty sql.NullFloat64
+		if err := rows.Scan(
+			&variant.ID, &variant.ExperimentID, &variant.Name, &variant.Weight,
+			&variant.SystemPrompt, &variant.Model,
+			&maxTokens, &temperature, &presencePenalty, &frequencyPenalty,
+		); err != nil {
+			return nil, err
+		}
+
+		// Handle nullable fields
+		if maxTokens.Valid {
+			v := int(maxTokens.Int64)
+			variant.MaxTokens = &v
+		}
+		variant.Temperature = nullFloat32(temperature)
+		variant.PresencePenalty = nullFloat32(presencePenalty)
+		variant.FrequencyPenalty = nullFloat32(frequencyPenalty)
+
+		variants = append(variants, variant)
+	}
+
+	return variants, rows.Err()
+}
+
+func nullFloat32(v sql.NullFloat64) *float32 {
+	if !v.Valid {
+		return nil
+	}
+	f := float32(v.Float64)
+	return &f
+}
+
+// StartExperiment starts a draft experiment. Only one experiment may run at
+// a time, since two would compete for the same prompt.
+func (p *ExperimentProvider) StartExperiment(id string) (*domain.Experiment, error) {
+	log.Println("Starting experiment: " + id)
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var running int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM experiments WHERE status = ?`, domain.ExperimentStatusRunning).Scan(&running); err != nil {
+		return nil, err
+	}
+	if running > 0 {
+		return nil, ErrExperimentRunning
+	}
+
+	if err := transition(tx, id, domain.ExperimentStatusDraft, domain.ExperimentStatusRunning, "started_at"); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return p.GetExperiment(id)
+}
+
+// StopExperiment ends a running experiment. Its users go back to the global
+// prompt and config; their assignments are kept for the report.
+func (p *ExperimentProvider) StopExperiment(id string) (*domain.Experiment, error) {
+	log.Println("Stopping experiment: " + id)
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := transition(tx, id, domain.ExperimentStatusRunning, domain.ExperimentStatusStopped, "stopped_at"); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return p.GetExperiment(id)
+}
+
+// transition moves an experiment from one status to the next and stamps the
+// given column.
+func transition(tx *sql.Tx, id string, from domain.ExperimentStatus, to domain.ExperimentStatus, column string) error {
+	var status domain.ExperimentStatus
+	err := tx.QueryRow(`SELECT status FROM experiments WHERE id = ?`, id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return ErrExperimentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if status != from {
+		return fmt.Errorf("%w: %s is %s", ErrInvalidTransition, id, status)
+	}
+
+	_, err = tx.Exec(`UPDATE experiments SET status = ?, `+column+` = ? WHERE id = ?`, to, time.Now(), id)
+	return err
+}
+
+// GetVariant returns the user's variant in the running experiment, or nil
+// when none is running. A user is assigned on first sight by hashing their
+// ID and keeps that variant for the rest of the experiment.
+func (p *ExperimentProvider) GetVariant(userID string) (*domain.Variant, error) {
+	var experimentID string
+	err := p.db.QueryRow(`SELECT id FROM experiments WHERE status = ?`, domain.ExperimentStatusRunning).Scan(&experimentID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	variants, err := p.getVariants(experimentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var variantID string
+	err = p.db.QueryRow(`
+        SELECT variant_id FROM experiment_assignments
+        WHERE experiment_id = ? AND user_id = ?`, experimentID, userID).Scan(&variantID)
+	if err == sql.ErrNoRows {
+		variantID, err = p.assign(experimentID, userID, variants)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, variant := range variants {
+		if variant.ID == variantID {
+			return &variant, nil
+		}
+	}
+	return nil, fmt.Errorf("assigned variant %s no longer exists", variantID)
+}
+
+// assign records the user's variant. Concurrent first requests compute the
+// same variant, so the insert can safely be ignored when it loses the race.
+func (p *ExperimentProvider) assign(experimentID string, userID string, variants []domain.Variant) (string, error) {
+	variant := pickVariant(experimentID, userID, variants)
+
+	var subscription sql.NullString
+	err := p.db.QueryRow(`SELECT subscription_type FROM users WHERE id = ?`, userID).Scan(&subscription)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	wasPremium := subscription.String == string(domain.SubscriptionTypePremium)
+
+	_, err = p.db.Exec(`
+        INSERT OR IGNORE INTO experiment_assignments (experiment_id, user_id, variant_id, was_premium, assigned_at)
+        VALUES (?, ?, ?, ?, ?)`,
+		experimentID, userID, variant.ID, wasPremium, time.Now(),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to assign variant: %w", err)
+	}
+
+	return variant.ID, nil
+}
+
+// pickVariant hashes the user into one of the weighted buckets. The
+// experiment ID is part of the hash so users do not land in the same arm of
+// every experiment.
+func pickVariant(experimentID string, userID string, variants []domain.Variant) domain.Variant {
+	sum := sha256.Sum256([]byte(experimentID + ":" + userID))
+	total := 0
+	for _, variant := range variants {
+		total += variant.Weight
+	}
+
+	bucket := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for _, variant := range variants {
+		if bucket < variant.Weight {
+			return variant
+		}
+		bucket -= variant.Weight
+	}
+	return variants[len(variants)-1]
+}
@@ -0,0 +1,161 @@
+package experimentprovider
+
+import (
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"time"
+)
+
+// SessionGap is the idle time after which a user's next message starts a
+// new session.
+const SessionGap = 30 * time.Minute
+
+type VariantReport struct {
+	VariantID string `json:"variant_id"`
+	Name      string `json:"name"`
+	Users     int    `json:"users"`
+
+	Messages        int     `json:"messages"`
+	MessagesPerUser float64 `json:"messages_per_user"`
+
+	Sessions              int     `json:"sessions"`
+	MessagesPerSession    float64 `json:"messages_per_session"`
+	SessionMinutesAvg     float64 `json:"session_minutes_avg"`
+	PositiveFeedback      int     `json:"positive_feedback"`
+	NegativeFeedback      int     `json:"negative_feedback"`
+	PositiveFeedbackRate  float64 `json:"positive_feedback_rate"`
+	EligibleForConversion int     `json:"eligible_for_conversion"`
+	ConvertedToPremium    int     `json:"converted_to_premium"`
+	PremiumConversionRate float64 `json:"premium_conversion_rate"`
+}
+
+type ExperimentReport struct {
+	Experiment domain.Experiment `json:"experiment"`
+	Variants   []VariantReport   `json:"variants"`
+}
+
+// GetReport compares the experiment's variants. Feedback counts from
+// assignment until the experiment stopped. Conversion counts users who were
+// not premium when assigned and are premium now.
+func (p *ExperimentProvider) GetReport(id string) (*ExperimentReport, error) {
+	experiment, err := p.GetExperiment(id)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ExperimentReport{
+		Experiment: *experiment,
+		Variants:   make([]VariantReport, 0, len(experiment.Variants)),
+	}
+	for _, variant := range experiment.Variants {
+		variantReport := VariantReport{
+			VariantID: variant.ID,
+			Name:      variant.Name,
+		}
+		if err := p.countUsers(experiment, &variantReport); err != nil {
+			return nil, err
+		}
+		if err := p.countSessions(&variantReport); err != nil {
+			return nil, err
+		}
+		if err := p.countFeedback(experiment, &variantReport); err != nil {
+			return nil, err
+		}
+		report.Variants = append(report.Variants, variantReport)
+	}
+
+	return report, nil
+}
+
+func (p *ExperimentProvider) countUsers(experiment *domain.Experiment, report *VariantReport) error {
+	err := p.db.QueryRow(`
+        SELECT COUNT(*),
+               COALESCE(SUM(CASE WHEN a.was_premium = 0 THEN 1 ELSE 0 END), 0),
+               COALESCE(SUM(CASE WHEN a.was_premium = 0 AND u.subscription_type = ? THEN 1 ELSE 0 END), 0)
+        FROM experiment_assignments a LEFT JOIN users u ON u.id = a.user_id
+        WHERE a.experiment_id = ? AND a.variant_id = ?`,
+		domain.SubscriptionTypePremium, experiment.ID, report.VariantID,
+	).Scan(&report.Users, &report.EligibleForConversion, &report.ConvertedToPremium)
+	if err != nil {
+		return err
+	}
+
+	report.PremiumConversionRate = ratio(report.ConvertedToPremium, report.EligibleForConversion)
+	return nil
+}
+
+// countSessions walks the variant's usage events per user and splits them
+// into sessions at gaps longer than SessionGap.
+func (p *ExperimentProvider) countSessions(report *VariantReport) error {
+	rows, err := p.db.Query(`
+        SELECT user_id, created_at FROM usage_events
+        WHERE variant_id = ?
+        ORDER BY user_id, created_at`, report.VariantID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var lastUser string
+	var sessionStart, lastEvent time.Time
+	var totalDuration time.Duration
+	for rows.Next() {
+		var userID string
+		var createdAt time.Time
+		if err := rows.Scan(&userID, &createdAt); err != nil {
+			return err
+		}
+
+		report.Messages++
+		if userID != lastUser || createdAt.Sub(lastEvent) > SessionGap {
+			if report.Sessions > 0 {
+				totalDuration += lastEvent.Sub(sessionStart)
+			}
+			report.Sessions++
+			sessionStart = createdAt
+		}
+		lastUser = userID
+		lastEvent = createdAt
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if report.Sessions > 0 {
+		totalDuration += lastEvent.Sub(sessionStart)
+	}
+
+	report.MessagesPerUser = ratio(report.Messages, report.Users)
+	report.MessagesPerSession = ratio(report.Messages, report.Sessions)
+	if report.Sessions > 0 {
+		report.SessionMinutesAvg = totalDuration.Minutes() / float64(report.Sessions)
+	}
+	return nil
+}
+
+func (p *ExperimentProvider) countFeedback(experiment *domain.Experiment, report *VariantReport) error {
+	until := time.Now()
+	if experiment.StoppedAt != nil {
+		until = *experiment.StoppedAt
+	}
+
+	err := p.db.QueryRow(`
+        SELECT COALESCE(SUM(CASE WHEN f.rating > 0 THEN 1 ELSE 0 END), 0),
+               COALESCE(SUM(CASE WHEN f.rating < 0 THEN 1 ELSE 0 END), 0)
+        FROM message_feedback f
+        JOIN experiment_assignments a ON a.user_id = f.user_id AND a.experiment_id = ?
+        WHERE a.variant_id = ? AND f.created_at >= a.assigned_at AND f.created_at <= ?`,
+		experiment.ID, report.VariantID, until,
+	).Scan(&report.PositiveFeedback, &report.NegativeFeedback)
+	if err != nil {
+		return err
+	}
+
+	report.PositiveFeedbackRate = ratio(report.PositiveFeedback, report.PositiveFeedback+report.NegativeFeedback)
+	return nil
+}
+
+func ratio(part int, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole)
+}
@@ -0,0 +1,180 @@
+package fallbackprovider
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/google/uuid"
+	"log"
+	"strings"
+	"time"
+)
+
+var (
+	ErrFallbackMessageNotFound = errors.New("fallback message not found")
+	ErrInvalidCategory         = errors.New("category must be one of error, quota or maintenance")
+	ErrUnsupportedLocale       = errors.New("locale must be one of en, de or es")
+	ErrContentRequired         = errors.New("content is required")
+	ErrInvalidWeight           = errors.New("weight must be a positive integer")
+)
+
+type FallbackProvider struct {
+	db *sql.DB
+}
+
+func NewFallbackProvider(db *sql.DB) *FallbackProvider {
+	return &FallbackProvider{db: db}
+}
+
+const messageColumns = `id, category, locale, content, weight, enabled, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMessage(row rowScanner) (*domain.FallbackMessage, error) {
+	var message domain.FallbackMessage
+	err := row.Scan(
+		&message.ID, &message.Category, &message.Locale, &message.Content,
+		&message.Weight, &message.Enabled, &message.CreatedAt, &message.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrFallbackMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+func validateMessage(message *domain.FallbackMessage) error {
+	message.Content = strings.TrimSpace(message.Content)
+	switch {
+	case !message.Category.Valid():
+		return ErrInvalidCategory
+	case !message.Locale.Supported():
+		return ErrUnsupportedLocale
+	case message.Content == "":
+		return ErrContentRequired
+	case message.Weight <= 0:
+		return ErrInvalidWeight
+	}
+	return nil
+}
+
+func (p *FallbackProvider) GetFallbackMessage(id string) (*domain.FallbackMessage, error) {
+	return scanMessage(p.db.QueryRow(`SELECT `+messageColumns+` FROM fallback_messages WHERE id = ?`, id))
+}
+
+// ListFallbackMessages returns every message, enabled or not, optionally
+// narrowed to one category and locale. Empty filters match everything.
+func (p *FallbackProvider) ListFallbackMessages(category domain.FallbackCategory, locale domain.Locale) ([]domain.FallbackMessage, error) {
+	query := `SELECT ` + messageColumns + ` FROM fallback_messages WHERE 1 = 1`
+	var args []interface{}
+	if category != "" {
+		query += ` AND category = ?`
+		args = append(args, category)
+	}
+	if locale != "" {
+		query += ` AND locale = ?`
+		args = append(args, locale)
+	}
+	query += ` ORDER BY category, locale, created_at`
+
+	return p.list(query, args...)
+}
+
+// EnabledFallbackMessages returns the messages that may be sent for a
+// failure of the category in the locale.
+func (p *FallbackProvider) EnabledFallbackMessages(category domain.FallbackCategory, locale domain.Locale) ([]domain.FallbackMessage, error) {
+	return p.list(`SELECT `+messageColumns+` FROM fallback_messages
+        WHERE category = ? AND locale = ? AND enabled = 1`, category, locale)
+}
+
+func (p *FallbackProvider) list(query string, args ...interface{}) ([]domain.FallbackMessage, error) {
+	rows, err := p.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []domain.FallbackMessage{}
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *message)
+	}
+
+	return messages, rows.Err()
+}
+
+func (p *FallbackProvider) CreateFallbackMessage(message domain.FallbackMessage) (*domain.FallbackMessage, error) {
+	log.Println("Creating fallback message in category: " + string(message.Category))
+	if err := validateMessage(&message); err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	message.ID = id.String()
+	message.CreatedAt = time.Now()
+	message.UpdatedAt = message.CreatedAt
+
+	_, err = p.db.Exec(`
+        INSERT INTO fallback_messages (`+messageColumns+`)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		message.ID, message.Category, message.Locale, message.Content,
+		message.Weight, message.Enabled, message.CreatedAt, message.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fallback message: %w", err)
+	}
+
+	return &message, nil
+}
+
+// UpdateFallbackMessage replaces every editable field of the message.
+func (p *FallbackProvider) UpdateFallbackMessage(message domain.FallbackMessage) (*domain.FallbackMessage, error) {
+	log.Println("Updating fallback message: " + message.ID)
+	if err := validateMessage(&message); err != nil {
+		return nil, err
+	}
+
+	existing, err := p.GetFallbackMessage(message.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	message.CreatedAt = existing.CreatedAt
+	message.UpdatedAt = time.Now()
+	_, err = p.db.Exec(`
+        UPDATE fallback_messages
+        SET category = ?, locale = ?, content = ?, weight = ?, enabled = ?, updated_at = ?
+        WHERE id = ?`,
+		message.Category, message.Locale, message.Content, message.Weight, message.Enabled, message.UpdatedAt,
+		message.ID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update fallback message: %w", err)
+	}
+
+	return &message, nil
+}
+
+func (p *FallbackProvider) DeleteFallbackMessage(id string) error {
+	log.Println("Deleting fallback message: " + id)
+
+	res, err := p.db.Exec(`DELETE FROM fallback_messages WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete fallback message: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrFallbackMessageNotFound
+	}
+	return nil
+}
@@ -0,0 +1,349 @@
+package goalprovider
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/google/uuid"
+	"log"
+	"strings"
+	"time"
+)
+
+var (
+	ErrGoalNotFound      = errors.New("goal not found")
+	ErrTitleRequired     = errors.New("goal title is required")
+	ErrTitleTooLong      = errors.New("goal title must be at most 200 characters")
+	ErrInvalidTargetDate = errors.New("target_date must be a date in YYYY-MM-DD form")
+	ErrInvalidStatus     = errors.New("status must be active, completed or abandoned")
+	ErrGoalNotActive     = errors.New("only active goals accept check-ins")
+)
+
+// maxTitleLength keeps titles short enough to quote in the system prompt.
+// Keep ErrTitleTooLong in sync.
+const maxTitleLength = 200
+
+type GoalProvider struct {
+	db *sql.DB
+}
+
+func NewGoalProvider(db *sql.DB) *GoalProvider {
+	return &GoalProvider{db: db}
+}
+
+const goalColumns = `id, user_id, title, description, target_date, status, created_at, updated_at, completed_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanGoal(row rowScanner) (*domain.Goal, error) {
+	var goal domain.Goal
+	var targetDate sql.NullString
+	var completedAt sql.NullTime
+
+	err := row.Scan(
+		&goal.ID, &goal.UserID, &goal.Title, &goal.Description, &targetDate, &goal.Status,
+		&goal.CreatedAt, &goal.UpdatedAt, &completedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrGoalNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	goal.TargetDate = targetDate.String
+	if completedAt.Valid {
+		goal.CompletedAt = &completedAt.Time
+	}
+	return &goal, nil
+}
+
+func validateGoal(goal *domain.Goal) error {
+	goal.Title = strings.TrimSpace(goal.Title)
+	if goal.Title == "" {
+		return ErrTitleRequired
+	}
+	if len([]rune(goal.Title)) > maxTitleLength {
+		return ErrTitleTooLong
+	}
+	if goal.TargetDate != "" {
+		if _, err := time.Parse(time.DateOnly, goal.TargetDate); err != nil {
+			return ErrInvalidTargetDate
+		}
+	}
+	switch goal.Status {
+	case "":
+		goal.Status = domain.GoalStatusActive
+	case domain.GoalStatusActive, domain.GoalStatusCompleted, domain.GoalStatusAbandoned:
+	default:
+		return ErrInvalidStatus
+	}
+	return nil
+}
+
+func (p *GoalProvider) CreateGoal(goal domain.Goal) (*domain.Goal, error) {
+	log.Println("Creating goal for user: " + goal.UserID)
+	if err := validateGoal(&goal); err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	goal.ID = id.String()
+	goal.CreatedAt = time.Now()
+	goal.UpdatedAt = goal.CreatedAt
+	goal.CompletedAt = nil
+	if goal.Status == domain.GoalStatusCompleted {
+		goal.CompletedAt = &goal.CreatedAt
+	}
+
+	_, err = p.db.Exec(`
+        INSERT INTO goals (`+goalColumns+`)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		goal.ID, goal.UserID, goal.Title, goal.Description,
+		sql.NullString{String: goal.TargetDate, Valid: goal.TargetDate != ""},
+		goal.Status, goal.CreatedAt, goal.UpdatedAt, goal.CompletedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create goal: %w", err)
+	}
+
+	return &goal, nil
+}
+
+func (p *GoalProvider) GetGoal(id string) (*domain.Goal, error) {
+	return scanGoal(p.db.QueryRow(`SELECT `+goalColumns+` FROM goals WHERE id = ?`, id))
+}
+
+// ListGoals returns the user's goals, newest first. An empty status lists
+// every goal.
+func (p *GoalProvider) ListGoals(userID string, status domain.GoalStatus) ([]domain.Goal, error) {
+	query := `SELECT ` + goalColumns + ` FROM goals WHERE user_id = ?`
+	args := []interface{}{userID}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := p.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	goals := []domain.Goal{}
+	for rows.Next() {
+		goal, err := scanGoal(rows)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, *goal)
+	}
+
+	return goals, rows.Err()
+}
+
+// ActiveGoals returns the user's active goals with their streaks as of now.
+func (p *GoalProvider) ActiveGoals(userID string, now time.Time) ([]domain.Goal, error) {
+	goals, err := p.ListGoals(userID, domain.GoalStatusActive)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range goals {
+		if goals[i].Streak, err = p.GetStreak(goals[i].ID, now); err != nil {
+			return nil, err
+		}
+	}
+	return goals, nil
+}
+
+// UpdateGoal replaces the editable fields: title, description, target date
+// and status. Completing a goal stamps completed_at; reopening clears it.
+func (p *GoalProvider) UpdateGoal(goal domain.Goal) (*domain.Goal, error) {
+	log.Println("Updating goal: " + goal.ID)
+	if err := validateGoal(&goal); err != nil {
+		return nil, err
+	}
+
+	existing, err := p.GetGoal(goal.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	goal.UserID = existing.UserID
+	goal.CreatedAt = existing.CreatedAt
+	goal.UpdatedAt = time.Now()
+	goal.CompletedAt = existing.CompletedAt
+	switch {
+	case goal.Status != domain.GoalStatusCompleted:
+		goal.CompletedAt = nil
+	case existing.Status != domain.GoalStatusCompleted:
+		goal.CompletedAt = &goal.UpdatedAt
+	}
+
+	_, err = p.db.Exec(`
+        UPDATE goals
+        SET title = ?, description = ?, target_date = ?, status = ?, updated_at = ?, completed_at = ?
+        WHERE id = ?`,
+		goal.Title, goal.Description,
+		sql.NullString{String: goal.TargetDate, Valid: goal.TargetDate != ""},
+		goal.Status, goal.UpdatedAt, goal.CompletedAt, goal.ID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update goal: %w", err)
+	}
+
+	return &goal, nil
+}
+
+// DeleteGoal removes the goal and its check-ins.
+func (p *GoalProvider) DeleteGoal(id string) error {
+	log.Println("Deleting goal: " + id)
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM goal_check_ins WHERE goal_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete check-ins: %w", err)
+	}
+
+	res, err := tx.Exec(`DELETE FROM goals WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete goal: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrGoalNotFound
+	}
+
+	return tx.Commit()
+}
+
+// CheckIn records progress on an active goal. It counts towards the
+// calendar day of now, so callers decide the time zone by passing now in
+// the user's location.
+func (p *GoalProvider) CheckIn(goalID string, note string, now time.Time) (*domain.GoalCheckIn, error) {
+	goal, err := p.GetGoal(goalID)
+	if err != nil {
+		return nil, err
+	}
+	if goal.Status != domain.GoalStatusActive {
+		return nil, ErrGoalNotActive
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	checkIn := domain.GoalCheckIn{
+		ID:        id.String(),
+		GoalID:    goal.ID,
+		UserID:    goal.UserID,
+		Note:      strings.TrimSpace(note),
+		Day:       now.Format(time.DateOnly),
+		CreatedAt: time.Now(),
+	}
+
+	_, err = p.db.Exec(`
+        INSERT INTO goal_check_ins (id, goal_id, user_id, note, day, created_at)
+        VALUES (?, ?, ?, ?, ?, ?)`,
+		checkIn.ID, checkIn.GoalID, checkIn.UserID, checkIn.Note, checkIn.Day, checkIn.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record check-in: %w", err)
+	}
+
+	return &checkIn, nil
+}
+
+// ListCheckIns returns the goal's newest check-ins first.
+func (p *GoalProvider) ListCheckIns(goalID string, limit int) ([]domain.GoalCheckIn, error) {
+	rows, err := p.db.Query(`
+        SELECT id, goal_id, user_id, note, day, created_at
+        FROM goal_check_ins WHERE goal_id = ?
+        ORDER BY created_at DESC LIMIT ?`, goalID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checkIns := []domain.GoalCheckIn{}
+	for rows.Next() {
+		var checkIn domain.GoalCheckIn
+		err := rows.Scan(&checkIn.ID, &checkIn.GoalID, &checkIn.UserID, &checkIn.Note, &checkIn.Day, &checkIn.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		checkIns = append(checkIns, checkIn)
+	}
+
+	return checkIns, rows.Err()
+}
+
+// GetStreak computes the goal's streaks from the days it was checked in on.
+// now decides what today is.
+func (p *GoalProvider) GetStreak(goalID string, now time.Time) (*domain.GoalStreak, error) {
+	rows, err := p.db.Query(`
+        SELECT DISTINCT day FROM goal_check_ins WHERE goal_id = ? ORDER BY day`, goalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []string
+	for rows.Next() {
+		var day string
+		if err := rows.Scan(&day); err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return streak(days, now), nil
+}
+
+// streak walks the sorted, distinct check-in days. The current run stays
+// alive while its last day is today or yesterday.
+func streak(days []string, now time.Time) *domain.GoalStreak {
+	result := &domain.GoalStreak{TotalDays: len(days)}
+	if len(days) == 0 {
+		return result
+	}
+
+	run := 0
+	var previous time.Time
+	for _, day := range days {
+		date, err := time.Parse(time.DateOnly, day)
+		if err != nil {
+			continue
+		}
+		if run > 0 && date.Equal(previous.AddDate(0, 0, 1)) {
+			run++
+		} else {
+			run = 1
+		}
+		result.Longest = max(result.Longest, run)
+		previous = date
+	}
+
+	today := now.Format(time.DateOnly)
+	yesterday := now.AddDate(0, 0, -1).Format(time.DateOnly)
+	result.LastCheckIn = days[len(days)-1]
+	result.CheckedInToday = result.LastCheckIn == today
+	if result.LastCheckIn == today || result.LastCheckIn == yesterday {
+		result.Current = run
+	}
+	return result
+}
@@ -0,0 +1,262 @@
+package nudgeprovider
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/google/uuid"
+	"log"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNudgeNotFound   = errors.New("nudge not found")
+	ErrNudgeExists     = errors.New("user already has a nudge for that day")
+	ErrInvalidTimezone = errors.New("timezone must be an IANA time zone such as Europe/Berlin")
+	ErrInvalidClock    = errors.New("send_at, quiet_start and quiet_end must be times in HH:MM form")
+	ErrQuietHours      = errors.New("quiet_start and quiet_end must both be set or both be empty")
+)
+
+const (
+	DefaultTimezone = "UTC"
+	DefaultSendAt   = "09:00"
+)
+
+// clockLayout is the HH:MM form of send_at and the quiet hours.
+const clockLayout = "15:04"
+
+type NudgeProvider struct {
+	db *sql.DB
+}
+
+func NewNudgeProvider(db *sql.DB) *NudgeProvider {
+	return &NudgeProvider{db: db}
+}
+
+const settingsColumns = `user_id, enabled, timezone, send_at, quiet_start, quiet_end, updated_at`
+
+const nudgeColumns = `id, user_id, day, content, model, created_at, delivered_at, read_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSettings(row rowScanner) (*domain.NudgeSettings, error) {
+	var settings domain.NudgeSettings
+	err := row.Scan(
+		&settings.UserID, &settings.Enabled, &settings.Timezone, &settings.SendAt,
+		&settings.QuietStart, &settings.QuietEnd, &settings.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+func scanNudge(row rowScanner) (*domain.Nudge, error) {
+	var nudge domain.Nudge
+	var deliveredAt, readAt sql.NullTime
+
+	err := row.Scan(
+		&nudge.ID, &nudge.UserID, &nudge.Day, &nudge.Content, &nudge.Model,
+		&nudge.CreatedAt, &deliveredAt, &readAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNudgeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if deliveredAt.Valid {
+		nudge.DeliveredAt = &deliveredAt.Time
+	}
+	if readAt.Valid {
+		nudge.ReadAt = &readAt.Time
+	}
+	return &nudge, nil
+}
+
+func validateSettings(settings *domain.NudgeSettings) error {
+	settings.Timezone = strings.TrimSpace(settings.Timezone)
+	if settings.Timezone == "" {
+		settings.Timezone = DefaultTimezone
+	}
+	if _, err := time.LoadLocation(settings.Timezone); err != nil {
+		return ErrInvalidTimezone
+	}
+
+	if settings.SendAt == "" {
+		settings.SendAt = DefaultSendAt
+	}
+	for _, clock := range []string{settings.SendAt, settings.QuietStart, settings.QuietEnd} {
+		if _, err := time.Parse(clockLayout, clock); clock != "" && err != nil {
+			return ErrInvalidClock
+		}
+	}
+	if (settings.QuietStart == "") != (settings.QuietEnd == "") {
+		return ErrQuietHours
+	}
+	return nil
+}
+
+// GetNudgeSettings returns the user's settings, or disabled defaults for a
+// user who never saved any.
+func (p *NudgeProvider) GetNudgeSettings(userID string) (*domain.NudgeSettings, error) {
+	settings, err := scanSettings(p.db.QueryRow(`SELECT `+settingsColumns+` FROM nudge_settings WHERE user_id = ?`, userID))
+	if err == sql.ErrNoRows {
+		return &domain.NudgeSettings{
+			UserID:   userID,
+			Timezone: DefaultTimezone,
+			SendAt:   DefaultSendAt,
+		}, nil
+	}
+	return settings, err
+}
+
+// SaveNudgeSettings validates the settings, fills in defaults and replaces
+// whatever the user had before.
+func (p *NudgeProvider) SaveNudgeSettings(settings domain.NudgeSettings) (*domain.NudgeSettings, error) {
+	log.Println("Saving nudge settings for user: " + settings.UserID)
+	if err := validateSettings(&settings); err != nil {
+		return nil, err
+	}
+
+	settings.UpdatedAt = time.Now()
+	_, err := p.db.Exec(`
+        INSERT INTO nudge_settings (`+settingsColumns+`)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+        ON CONFLICT (user_id) DO UPDATE SET
+            enabled = excluded.enabled,
+            timezone = excluded.timezone,
+            send_at = excluded.send_at,
+            quiet_start = excluded.quiet_start,
+            quiet_end = excluded.quiet_end,
+            updated_at = excluded.updated_at`,
+		settings.UserID, settings.Enabled, settings.Timezone, settings.SendAt,
+		settings.QuietStart, settings.QuietEnd, settings.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save nudge settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// ListEnabledNudgeSettings returns the settings of every opted-in user.
+func (p *NudgeProvider) ListEnabledNudgeSettings() ([]domain.NudgeSettings, error) {
+	rows, err := p.db.Query(`SELECT ` + settingsColumns + ` FROM nudge_settings WHERE enabled = 1`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []domain.NudgeSettings{}
+	for rows.Next() {
+		settings, err := scanSettings(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *settings)
+	}
+
+	return list, rows.Err()
+}
+
+// HasNudge reports whether the user already got a nudge for day.
+func (p *NudgeProvider) HasNudge(userID string, day string) (bool, error) {
+	var count int
+	err := p.db.QueryRow(`SELECT COUNT(*) FROM nudges WHERE user_id = ? AND day = ?`, userID, day).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CreateNudge stores a nudge in the user's inbox, assigning its ID and
+// creation time. A second nudge for the same day is ErrNudgeExists.
+func (p *NudgeProvider) CreateNudge(nudge domain.Nudge) (*domain.Nudge, error) {
+	log.Println("Storing nudge for user: " + nudge.UserID)
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	nudge.ID = id.String()
+	nudge.CreatedAt = time.Now()
+	nudge.DeliveredAt = nil
+	nudge.ReadAt = nil
+	res, err := p.db.Exec(`
+        INSERT INTO nudges (id, user_id, day, content, model, created_at)
+        VALUES (?, ?, ?, ?, ?, ?)
+        ON CONFLICT (user_id, day) DO NOTHING`,
+		nudge.ID, nudge.UserID, nudge.Day, nudge.Content, nudge.Model, nudge.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store nudge: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrNudgeExists
+	}
+
+	return &nudge, nil
+}
+
+func (p *NudgeProvider) GetNudge(id string) (*domain.Nudge, error) {
+	return scanNudge(p.db.QueryRow(`SELECT `+nudgeColumns+` FROM nudges WHERE id = ?`, id))
+}
+
+// ListNudges returns the user's inbox, newest first.
+func (p *NudgeProvider) ListNudges(userID string, unreadOnly bool, limit int, offset int) ([]domain.Nudge, error) {
+	query := `SELECT ` + nudgeColumns + ` FROM nudges WHERE user_id = ?`
+	if unreadOnly {
+		query += ` AND read_at IS NULL`
+	}
+	query += ` ORDER BY created_at DESC LIMIT ? OFFSET ?`
+
+	rows, err := p.db.Query(query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nudges := []domain.Nudge{}
+	for rows.Next() {
+		nudge, err := scanNudge(rows)
+		if err != nil {
+			return nil, err
+		}
+		nudges = append(nudges, *nudge)
+	}
+
+	return nudges, rows.Err()
+}
+
+func (p *NudgeProvider) CountUnreadNudges(userID string) (int, error) {
+	var count int
+	err := p.db.QueryRow(`SELECT COUNT(*) FROM nudges WHERE user_id = ? AND read_at IS NULL`, userID).Scan(&count)
+	return count, err
+}
+
+// MarkNudgeDelivered records when the notifier handed the nudge off.
+func (p *NudgeProvider) MarkNudgeDelivered(id string, at time.Time) error {
+	return p.stamp(`UPDATE nudges SET delivered_at = ? WHERE id = ?`, id, at)
+}
+
+// MarkNudgeRead keeps the first time the nudge was read.
+func (p *NudgeProvider) MarkNudgeRead(id string, at time.Time) error {
+	return p.stamp(`UPDATE nudges SET read_at = COALESCE(read_at, ?) WHERE id = ?`, id, at)
+}
+
+func (p *NudgeProvider) stamp(query string, id string, at time.Time) error {
+	res, err := p.db.Exec(query, at, id)
+	if err != nil {
+		return fmt.Errorf("failed to update nudge: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNudgeNotFound
+	}
+	return nil
+}
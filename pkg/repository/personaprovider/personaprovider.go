@@ -0,0 +1,237 @@
+package personaprovider
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/fgb-andu/hustl-api/pkg/repository/sqliteerr"
+	"github.com/google/uuid"
+	"log"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPersonaNotFound     = errors.New("persona not found")
+	ErrPersonaNameTaken    = errors.New("persona name already in use")
+	ErrDefaultPersona      = errors.New("the default persona cannot be deleted or disabled")
+	ErrNoDefaultPersona    = errors.New("no default persona configured")
+	ErrPersonaNameRequired = errors.New("persona name is required")
+)
+
+type PersonaProvider struct {
+	db *sql.DB
+}
+
+func NewPersonaProvider(db *sql.DB) *PersonaProvider {
+	return &PersonaProvider{db: db}
+}
+
+const personaColumns = `id, name, system_prompt, model, max_tokens, temperature,
+               presence_penalty, frequency_penalty, enabled, is_default, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPersona(row rowScanner) (*domain.Persona, error) {
+	var persona domain.Persona
+	var maxTokens sql.NullInt64
+	var temperature, presencePenalty, frequencyPenalty sql.NullFloat64
+
+	err := row.Scan(
+		&persona.ID, &persona.Name, &persona.SystemPrompt, &persona.Model,
+		&maxTokens, &temperature, &presencePenalty, &frequencyPenalty,
+		&persona.Enabled, &persona.IsDefault, &persona.CreatedAt, &persona.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrPersonaNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Handle nullable fields
+	if maxTokens.Valid {
+		v := int(maxTokens.Int64)
+		persona.MaxTokens = &v
+	}
+	persona.Temperature = nullFloat32(temperature)
+	persona.PresencePenalty = nullFloat32(presencePenalty)
+	persona.FrequencyPenalty = nullFloat32(frequencyPenalty)
+
+	return &persona, nil
+}
+
+func nullFloat32(v sql.NullFloat64) *float32 {
+	if !v.Valid {
+		return nil
+	}
+	f := float32(v.Float64)
+	return &f
+}
+
+func (p *PersonaProvider) GetPersona(id string) (*domain.Persona, error) {
+	return scanPersona(p.db.QueryRow(`SELECT `+personaColumns+` FROM personas WHERE id = ?`, id))
+}
+
+// FindPersona is GetPersona for callers that take a missing persona as nil
+// rather than an error, such as the chat service.
+func (p *PersonaProvider) FindPersona(id string) (*domain.Persona, error) {
+	persona, err := p.GetPersona(id)
+	if err == ErrPersonaNotFound {
+		return nil, nil
+	}
+	return persona, err
+}
+
+func (p *PersonaProvider) GetDefaultPersona() (*domain.Persona, error) {
+	persona, err := scanPersona(p.db.QueryRow(`SELECT ` + personaColumns + ` FROM personas WHERE is_default = 1`))
+	if err == ErrPersonaNotFound {
+		return nil, ErrNoDefaultPersona
+	}
+	return persona, err
+}
+
+func (p *PersonaProvider) ListPersonas() ([]domain.Persona, error) {
+	rows, err := p.db.Query(`SELECT ` + personaColumns + ` FROM personas ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	personas := []domain.Persona{}
+	for rows.Next() {
+		persona, err := scanPersona(rows)
+		if err != nil {
+			return nil, err
+		}
+		personas = append(personas, *persona)
+	}
+
+	return personas, rows.Err()
+}
+
+// CreatePersona stores a new persona. If it is marked as default, the
+// previous default loses the flag.
+func (p *PersonaProvider) CreatePersona(persona domain.Persona) (*domain.Persona, error) {
+	log.Println("Creating persona: " + persona.Name)
+	if strings.TrimSpace(persona.Name) == "" {
+		return nil, ErrPersonaNameRequired
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	persona.ID = id.String()
+	persona.CreatedAt = time.Now()
+	persona.UpdatedAt = persona.CreatedAt
+	if persona.IsDefault {
+		persona.Enabled = true
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if persona.IsDefault {
+		if _, err := tx.Exec(`UPDATE personas SET is_default = 0`); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO personas (
+            id, name, system_prompt, model, max_tokens, temperature,
+            presence_penalty, frequency_penalty, enabled, is_default, created_at, updated_at
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		persona.ID, persona.Name, persona.SystemPrompt, persona.Model,
+		persona.MaxTokens, persona.Temperature, persona.PresencePenalty, persona.FrequencyPenalty,
+		persona.Enabled, persona.IsDefault, persona.CreatedAt, persona.UpdatedAt,
+	)
+	if err != nil {
+		if sqliteerr.IsUniqueViolation(err, "personas.name") {
+			return nil, ErrPersonaNameTaken
+		}
+		return nil, fmt.Errorf("failed to create persona: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &persona, nil
+}
+
+// UpdatePersona replaces every editable field of the persona.
+func (p *PersonaProvider) UpdatePersona(persona domain.Persona) (*domain.Persona, error) {
+	log.Println("Updating persona: " + persona.ID)
+	if strings.TrimSpace(persona.Name) == "" {
+		return nil, ErrPersonaNameRequired
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	existing, err := scanPersona(tx.QueryRow(`SELECT `+personaColumns+` FROM personas WHERE id = ?`, persona.ID))
+	if err != nil {
+		return nil, err
+	}
+	if existing.IsDefault && (!persona.IsDefault || !persona.Enabled) {
+		// Another persona has to become the default first
+		return nil, ErrDefaultPersona
+	}
+
+	if persona.IsDefault && !existing.IsDefault {
+		if _, err := tx.Exec(`UPDATE personas SET is_default = 0`); err != nil {
+			return nil, err
+		}
+		persona.Enabled = true
+	}
+
+	persona.CreatedAt = existing.CreatedAt
+	persona.UpdatedAt = time.Now()
+	_, err = tx.Exec(`
+        UPDATE personas
+        SET name = ?, system_prompt = ?, model = ?, max_tokens = ?, temperature = ?,
+            presence_penalty = ?, frequency_penalty = ?, enabled = ?, is_default = ?, updated_at = ?
+        WHERE id = ?`,
+		persona.Name, persona.SystemPrompt, persona.Model, persona.MaxTokens, persona.Temperature,
+		persona.PresencePenalty, persona.FrequencyPenalty, persona.Enabled, persona.IsDefault, persona.UpdatedAt,
+		persona.ID,
+	)
+	if err != nil {
+		if sqliteerr.IsUniqueViolation(err, "personas.name") {
+			return nil, ErrPersonaNameTaken
+		}
+		return nil, fmt.Errorf("failed to update persona: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &persona, nil
+}
+
+func (p *PersonaProvider) DeletePersona(id string) error {
+	log.Println("Deleting persona: " + id)
+
+	persona, err := p.GetPersona(id)
+	if err != nil {
+		return err
+	}
+	if persona.IsDefault {
+		return ErrDefaultPersona
+	}
+
+	if _, err := p.db.Exec(`DELETE FROM personas WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete persona: %w", err)
+	}
+	return nil
+}
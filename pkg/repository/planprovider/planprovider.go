@@ -0,0 +1,104 @@
+package planprovider
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+var ErrActionPlanNotFound = errors.New("action plan not found")
+
+type PlanProvider struct {
+	db *sql.DB
+}
+
+func NewPlanProvider(db *sql.DB) *PlanProvider {
+	return &PlanProvider{db: db}
+}
+
+// CreateActionPlan stores the plan, assigning its ID and creation time.
+func (p *PlanProvider) CreateActionPlan(plan domain.ActionPlan) (*domain.ActionPlan, error) {
+	log.Println("Storing action plan for user: " + plan.UserID)
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	goals, err := json.Marshal(plan.Goals)
+	if err != nil {
+		return nil, err
+	}
+
+	plan.ID = id.String()
+	plan.CreatedAt = time.Now()
+	_, err = p.db.Exec(`
+        INSERT INTO action_plans (id, user_id, conversation_id, summary, goals, model, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		plan.ID, plan.UserID,
+		sql.NullString{String: plan.ConversationID, Valid: plan.ConversationID != ""},
+		plan.Summary, string(goals), plan.Model, plan.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store action plan: %w", err)
+	}
+
+	return &plan, nil
+}
+
+const planColumns = `id, user_id, conversation_id, summary, goals, model, created_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPlan(row rowScanner) (*domain.ActionPlan, error) {
+	var plan domain.ActionPlan
+	var conversationID sql.NullString
+	var goals string
+
+	err := row.Scan(
+		&plan.ID, &plan.UserID, &conversationID, &plan.Summary, &goals, &plan.Model, &plan.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrActionPlanNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plan.ConversationID = conversationID.String
+	if err := json.Unmarshal([]byte(goals), &plan.Goals); err != nil {
+		return nil, fmt.Errorf("failed to decode action plan goals: %w", err)
+	}
+	return &plan, nil
+}
+
+func (p *PlanProvider) GetActionPlan(id string) (*domain.ActionPlan, error) {
+	return scanPlan(p.db.QueryRow(`SELECT `+planColumns+` FROM action_plans WHERE id = ?`, id))
+}
+
+// ListActionPlans returns a page of the user's plans, newest first.
+func (p *PlanProvider) ListActionPlans(userID string, limit int, offset int) ([]domain.ActionPlan, error) {
+	rows, err := p.db.Query(`
+        SELECT `+planColumns+` FROM action_plans WHERE user_id = ?
+        ORDER BY created_at DESC LIMIT ? OFFSET ?`, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := []domain.ActionPlan{}
+	for rows.Next() {
+		plan, err := scanPlan(rows)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, *plan)
+	}
+
+	return plans, rows.Err()
+}
@@ -0,0 +1,249 @@
+package promptprovider
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/google/uuid"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPromptVersionNotFound = errors.New("prompt version not found")
+	ErrNoActivePrompt        = errors.New("no prompt version is active")
+	ErrNoPreviousVersion     = errors.New("no previously active prompt version to roll back to")
+	ErrPromptRequired        = errors.New("prompt content is required")
+	ErrAuthorRequired        = errors.New("prompt author is required")
+)
+
+type PromptProvider struct {
+	db *sql.DB
+}
+
+func NewPromptProvider(db *sql.DB) *PromptProvider {
+	return &PromptProvider{db: db}
+}
+
+const promptColumns = `id, version, content, author, note, active, created_at, activated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPromptVersion(row rowScanner) (*domain.PromptVersion, error) {
+	var version domain.PromptVersion
+	var activatedAt sql.NullTime
+
+	err := row.Scan(
+		&version.ID, &version.Version, &version.Content, &version.Author,
+		&version.Note, &version.Active, &version.CreatedAt, &activatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrPromptVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if activatedAt.Valid {
+		version.ActivatedAt = &activatedAt.Time
+	}
+	return &version, nil
+}
+
+// GetPromptVersion accepts either the version's ID or its number.
+func (p *PromptProvider) GetPromptVersion(id string) (*domain.PromptVersion, error) {
+	if number, err := strconv.Atoi(id); err == nil {
+		return scanPromptVersion(p.db.QueryRow(`SELECT `+promptColumns+` FROM prompt_versions WHERE version = ?`, number))
+	}
+	return scanPromptVersion(p.db.QueryRow(`SELECT `+promptColumns+` FROM prompt_versions WHERE id = ?`, id))
+}
+
+func (p *PromptProvider) GetActivePromptVersion() (*domain.PromptVersion, error) {
+	version, err := scanPromptVersion(p.db.QueryRow(`SELECT ` + promptColumns + ` FROM prompt_versions WHERE active = 1`))
+	if err == ErrPromptVersionNotFound {
+		return nil, ErrNoActivePrompt
+	}
+	return version, err
+}
+
+// ListPromptVersions returns every version, newest first.
+func (p *PromptProvider) ListPromptVersions() ([]domain.PromptVersion, error) {
+	rows, err := p.db.Query(`SELECT ` + promptColumns + ` FROM prompt_versions ORDER BY version DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []domain.PromptVersion{}
+	for rows.Next() {
+		version, err := scanPromptVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *version)
+	}
+
+	return versions, rows.Err()
+}
+
+// CreatePromptVersion stores a new version numbered after the latest one.
+// It does not become active until ActivatePromptVersion is called.
+func (p *PromptProvider) CreatePromptVersion(content string, author string, note string) (*domain.PromptVersion, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, ErrPromptRequired
+	}
+	if strings.TrimSpace(author) == "" {
+		return nil, ErrAuthorRequired
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var latest int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM prompt_versions`).Scan(&latest); err != nil {
+		return nil, err
+	}
+
+	version := &domain.PromptVersion{
+		ID:        id.String(),
+		Version:   latest + 1,
+		Content:   content,
+		Author:    author,
+		Note:      note,
+		CreatedAt: time.Now(),
+	}
+	log.Printf("Creating prompt version %d by %s", version.Version, author)
+
+	_, err = tx.Exec(`
+        INSERT INTO prompt_versions (id, version, content, author, note, active, created_at)
+        VALUES (?, ?, ?, ?, ?, 0, ?)`,
+		version.ID, version.Version, version.Content, version.Author, version.Note, version.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create prompt version: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// ActivatePromptVersion makes the given version the only active one.
+func (p *PromptProvider) ActivatePromptVersion(id string) (*domain.PromptVersion, error) {
+	version, err := p.GetPromptVersion(id)
+	if err != nil {
+		return nil, err
+	}
+	return p.activate(version)
+}
+
+// RollbackPromptVersion undoes the latest activation and reactivates the
+// version that was active before it. Repeated rollbacks keep walking back
+// through the activation history.
+func (p *PromptProvider) RollbackPromptVersion() (*domain.PromptVersion, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+        SELECT id, prompt_version_id FROM prompt_activations
+        WHERE rolled_back_at IS NULL ORDER BY id DESC LIMIT 2`)
+	if err != nil {
+		return nil, err
+	}
+	var activationIDs []int64
+	var versionIDs []string
+	for rows.Next() {
+		var activationID int64
+		var versionID string
+		if err := rows.Scan(&activationID, &versionID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		activationIDs = append(activationIDs, activationID)
+		versionIDs = append(versionIDs, versionID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	switch len(activationIDs) {
+	case 0:
+		return nil, ErrNoActivePrompt
+	case 1:
+		return nil, ErrNoPreviousVersion
+	}
+
+	previous, err := scanPromptVersion(tx.QueryRow(`SELECT `+promptColumns+` FROM prompt_versions WHERE id = ?`, versionIDs[1]))
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Rolling back to prompt version %d", previous.Version)
+
+	now := time.Now()
+	if _, err := tx.Exec(`UPDATE prompt_activations SET rolled_back_at = ? WHERE id = ?`, now, activationIDs[0]); err != nil {
+		return nil, fmt.Errorf("failed to roll back prompt version: %w", err)
+	}
+	if err := setActive(tx, previous, now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+func (p *PromptProvider) activate(version *domain.PromptVersion) (*domain.PromptVersion, error) {
+	log.Printf("Activating prompt version %d", version.Version)
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := setActive(tx, version, now); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`INSERT INTO prompt_activations (prompt_version_id, activated_at) VALUES (?, ?)`, version.ID, now); err != nil {
+		return nil, fmt.Errorf("failed to record prompt activation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// setActive makes version the only active one, without touching the
+// activation history.
+func setActive(tx *sql.Tx, version *domain.PromptVersion, now time.Time) error {
+	if _, err := tx.Exec(`UPDATE prompt_versions SET active = 0 WHERE active = 1`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE prompt_versions SET active = 1, activated_at = ? WHERE id = ?`, now, version.ID); err != nil {
+		return fmt.Errorf("failed to activate prompt version: %w", err)
+	}
+
+	version.Active = true
+	version.ActivatedAt = &now
+	return nil
+}
@@ -0,0 +1,160 @@
+package sessionprovider
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+var ErrRefreshTokenNotFound = errors.New("refresh token not found")
+
+type SessionProvider struct {
+	db *sql.DB
+}
+
+func NewSessionProvider(db *sql.DB) *SessionProvider {
+	return &SessionProvider{db: db}
+}
+
+const tokenColumns = `id, user_id, family_id, token_hash, created_at, expires_at, rotated_at, revoked_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanToken(row rowScanner) (*domain.RefreshToken, error) {
+	var token domain.RefreshToken
+	var rotatedAt, revokedAt sql.NullTime
+
+	err := row.Scan(
+		&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash,
+		&token.CreatedAt, &token.ExpiresAt, &rotatedAt, &revokedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if rotatedAt.Valid {
+		token.RotatedAt = &rotatedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return &token, nil
+}
+
+// GetRefreshToken looks a token up by the hash of its value.
+func (p *SessionProvider) GetRefreshToken(tokenHash string) (*domain.RefreshToken, error) {
+	return scanToken(p.db.QueryRow(`SELECT `+tokenColumns+` FROM refresh_tokens WHERE token_hash = ?`, tokenHash))
+}
+
+// CreateRefreshToken stores a token that starts a new family, or continues
+// the one it names.
+func (p *SessionProvider) CreateRefreshToken(token domain.RefreshToken) (*domain.RefreshToken, error) {
+	if err := assignID(&token); err != nil {
+		return nil, err
+	}
+
+	if err := insertToken(p.db, token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RotateRefreshToken marks the used token as rotated and stores next in its
+// place, in one transaction. It reports false without storing next when the
+// used token was already rotated or revoked, such as by a concurrent
+// refresh with the same token.
+func (p *SessionProvider) RotateRefreshToken(usedID string, next domain.RefreshToken) (*domain.RefreshToken, bool, error) {
+	if err := assignID(&next); err != nil {
+		return nil, false, err
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+        UPDATE refresh_tokens SET rotated_at = ?
+        WHERE id = ? AND rotated_at IS NULL AND revoked_at IS NULL`,
+		next.CreatedAt, usedID,
+	)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, false, nil
+	}
+
+	if err := insertToken(tx, next); err != nil {
+		return nil, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	return &next, true, nil
+}
+
+// RevokeRefreshTokenFamily revokes every token of the family, so none of
+// them can be refreshed again.
+func (p *SessionProvider) RevokeRefreshTokenFamily(familyID string) error {
+	log.Println("Revoking refresh token family: " + familyID)
+
+	_, err := p.db.Exec(`UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL`, time.Now(), familyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredRefreshTokens removes tokens past their expiry and reports
+// how many there were.
+func (p *SessionProvider) DeleteExpiredRefreshTokens() (int64, error) {
+	res, err := p.db.Exec(`DELETE FROM refresh_tokens WHERE expires_at <= ?`, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired refresh tokens: %w", err)
+	}
+
+	return res.RowsAffected()
+}
+
+func assignID(token *domain.RefreshToken) error {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+	token.ID = id.String()
+	if token.FamilyID == "" {
+		token.FamilyID = token.ID
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertToken(db execer, token domain.RefreshToken) error {
+	_, err := db.Exec(`
+        INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, created_at, expires_at)
+        VALUES (?, ?, ?, ?, ?, ?)`,
+		token.ID, token.UserID, token.FamilyID, token.TokenHash, token.CreatedAt, token.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+	return nil
+}
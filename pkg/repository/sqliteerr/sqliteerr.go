@@ -0,0 +1,19 @@
+package sqliteerr
+
+import (
+	"errors"
+	sqlite "github.com/mattn/go-sqlite3"
+	"strings"
+)
+
+// IsUniqueViolation reports whether err is the failure of a UNIQUE
+// constraint on column, such as "users.username". SQLite names every column
+// of the constraint: "UNIQUE constraint failed: users.auth_provider,
+// users.subject".
+func IsUniqueViolation(err error, column string) bool {
+	var sqliteErr sqlite.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.ExtendedCode != sqlite.ErrConstraintUnique {
+		return false
+	}
+	return strings.Contains(sqliteErr.Error(), column)
+}
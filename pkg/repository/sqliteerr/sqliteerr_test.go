@@ -0,0 +1,48 @@
+package sqliteerr
+
+import (
+	"database/sql"
+	"errors"
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`
+        CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT UNIQUE NOT NULL, owner TEXT, slot INTEGER, UNIQUE (owner, slot));
+        INSERT INTO items (name, owner, slot) VALUES ('first', 'alice', 1);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, duplicateName := db.Exec(`INSERT INTO items (name, owner, slot) VALUES ('first', 'bob', 1)`)
+	_, duplicateSlot := db.Exec(`INSERT INTO items (name, owner, slot) VALUES ('second', 'alice', 1)`)
+	_, missingName := db.Exec(`INSERT INTO items (owner, slot) VALUES ('carol', 1)`)
+
+	tests := []struct {
+		name   string
+		err    error
+		column string
+		want   bool
+	}{
+		{name: "duplicate name", err: duplicateName, column: "items.name", want: true},
+		{name: "other column", err: duplicateName, column: "items.slot", want: false},
+		{name: "composite constraint", err: duplicateSlot, column: "items.slot", want: true},
+		{name: "not null constraint", err: missingName, column: "items.name", want: false},
+		{name: "not an SQLite error", err: errors.New("UNIQUE constraint failed: items.name"), column: "items.name", want: false},
+		{name: "no error", err: nil, column: "items.name", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsUniqueViolation(tt.err, tt.column); got != tt.want {
+				t.Errorf("IsUniqueViolation(%v, %q) = %v, want %v", tt.err, tt.column, got, tt.want)
+			}
+		})
+	}
+}
@@ -5,11 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/fgb-andu/hustl-api/pkg/repository/sqliteerr"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/sqlite3"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/google/uuid"
-	_ "github.com/mattn/go-sqlite3"
 	"log"
 	"time"
 )
@@ -65,6 +65,17 @@ func runMigrations(db *sql.DB, migrationsPath string) error {
 
 // Rest of the UserProvider implementation remains the same...
 func (p *UserProvider) CreateUser(authProvider domain.AuthProvider, username string, email string) (*domain.User, error) {
+	return p.createUser(authProvider, username, email, sql.NullString{})
+}
+
+// CreateUserWithSubject creates a user who signed in with an identity
+// provider. subject is the provider's ID for the user and doubles as the
+// username.
+func (p *UserProvider) CreateUserWithSubject(authProvider domain.AuthProvider, subject string, email string) (*domain.User, error) {
+	return p.createUser(authProvider, subject, email, sql.NullString{String: subject, Valid: true})
+}
+
+func (p *UserProvider) createUser(authProvider domain.AuthProvider, username string, email string, subject sql.NullString) (*domain.User, error) {
 	log.Println("Creating user with username: " + username)
 	id, err := uuid.NewRandom()
 	if err != nil {
@@ -73,16 +84,16 @@ func (p *UserProvider) CreateUser(authProvider domain.AuthProvider, username str
 
 	_, err = p.db.Exec(`
     INSERT INTO users (
-        id, auth_provider, username, email, 
+        id, auth_provider, username, email, subject,
         daily_message_limit, messages_used, last_reset, last_active,
         subscription_type, subscription_platform
-    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		id.String(), authProvider, username, email,
+    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id.String(), authProvider, username, email, subject,
 		FREE_USER_MESSAGE_LIMIT, 0, time.Now(), time.Now(),
 		domain.SubscriptionTypeFree, domain.SubscriptionPlatformNone,
 	)
 	if err != nil {
-		return nil, err
+		return nil, uniqueViolation(err)
 	}
 
 	return &domain.User{
@@ -99,6 +110,73 @@ func (p *UserProvider) CreateUser(authProvider domain.AuthProvider, username str
 	}, nil
 }
 
+// uniqueViolation maps a UNIQUE constraint failure to the error for the
+// column that is taken, and returns other errors as they are.
+func uniqueViolation(err error) error {
+	switch {
+	case sqliteerr.IsUniqueViolation(err, "users.subject"):
+		return ErrSubjectTaken
+	case sqliteerr.IsUniqueViolation(err, "users.username"):
+		return ErrUsernameTaken
+	}
+	return err
+}
+
+// LinkLegacyUser records subject for a user of the provider who signed up
+// before subjects were recorded: the one whose username is subject or,
+// failing that, the only one whose email is email. Email only links when
+// emailVerified says the provider verified it, since anyone can claim an
+// unverified address. It returns ErrUserNotFound when no user matches.
+func (p *UserProvider) LinkLegacyUser(authProvider domain.AuthProvider, subject string, email string, emailVerified bool) (*domain.User, error) {
+	var id string
+	err := p.db.QueryRow(`
+        SELECT id FROM users
+        WHERE auth_provider = ? AND subject IS NULL AND username = ?`,
+		authProvider, subject,
+	).Scan(&id)
+	if err == sql.ErrNoRows && emailVerified && email != "" {
+		var matches int
+		err = p.db.QueryRow(`
+            SELECT COUNT(*), COALESCE(MIN(id), '') FROM users
+            WHERE auth_provider = ? AND subject IS NULL AND email = ?`,
+			authProvider, email,
+		).Scan(&matches, &id)
+		if err == nil && matches != 1 {
+			err = sql.ErrNoRows
+		}
+	}
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("Linking user " + id + " to subject " + subject)
+	res, err := p.db.Exec(`UPDATE users SET subject = ? WHERE id = ? AND subject IS NULL`, subject, id)
+	if err != nil {
+		return nil, uniqueViolation(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// Linked to another subject in the meantime
+		return nil, ErrUserNotFound
+	}
+	return p.GetUser(id)
+}
+
+// GetUserBySubject finds the user an identity provider knows by subject.
+func (p *UserProvider) GetUserBySubject(authProvider domain.AuthProvider, subject string) (*domain.User, error) {
+	var id string
+	err := p.db.QueryRow(`SELECT id FROM users WHERE auth_provider = ? AND subject = ?`, authProvider, subject).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p.GetUser(id)
+}
+
 func (p *UserProvider) GetUser(id string) (*domain.User, error) {
 	log.Println("Getting user by ID: " + id)
 
@@ -108,11 +186,11 @@ func (p *UserProvider) GetUser(id string) (*domain.User, error) {
 	var subscriptionExpiresAt sql.NullTime
 
 	err := p.db.QueryRow(`
-        SELECT id, auth_provider, username, email, 
+        SELECT id, auth_provider, username, email, locale,
                daily_message_limit, messages_used, last_reset, last_active, 
                subscription_type, subscription_platform, original_transaction_id, subscription_expires_at
         FROM users WHERE id = ?`, id).Scan(
-		&user.ID, &user.AuthProvider, &user.Username, &user.Email,
+		&user.ID, &user.AuthProvider, &user.Username, &user.Email, &user.Locale,
 		&user.Entitlements.DailyMessageLimit, &user.Entitlements.MessagesUsed,
 		&lastReset, &lastActive,
 		&user.Entitlements.Subscription.Type, &user.Entitlements.Subscription.Platform,
@@ -142,7 +220,7 @@ func (p *UserProvider) GetUser(id string) (*domain.User, error) {
 		log.Println("Resetting!")
 		_, err = p.db.Exec(`
             UPDATE users 
-            SET messages_used = 0, last_reset = ? 
+            SET messages_used = 0, messages_reserved = 0, last_reset = ? 
             WHERE id = ?`,
 			time.Now(), id,
 		)
@@ -165,11 +243,11 @@ func (p *UserProvider) GetUserByUsername(username string) (*domain.User, error)
 	var subscriptionExpiresAt sql.NullTime
 
 	err := p.db.QueryRow(`
-        SELECT id, auth_provider, username, email, 
+        SELECT id, auth_provider, username, email, locale,
                daily_message_limit, messages_used, last_reset, last_active, 
                subscription_type, subscription_platform, original_transaction_id, subscription_expires_at
         FROM users WHERE username = ?`, username).Scan(
-		&user.ID, &user.AuthProvider, &user.Username, &user.Email,
+		&user.ID, &user.AuthProvider, &user.Username, &user.Email, &user.Locale,
 		&user.Entitlements.DailyMessageLimit, &user.Entitlements.MessagesUsed,
 		&lastReset, &lastActive,
 		&user.Entitlements.Subscription.Type, &user.Entitlements.Subscription.Platform,
@@ -199,7 +277,7 @@ func (p *UserProvider) GetUserByUsername(username string) (*domain.User, error)
 		log.Println("Resetting!")
 		_, err = p.db.Exec(`
             UPDATE users 
-            SET messages_used = 0, last_reset = ? 
+            SET messages_used = 0, messages_reserved = 0, last_reset = ? 
             WHERE username = ?`,
 			time.Now(), username,
 		)
@@ -213,56 +291,127 @@ func (p *UserProvider) GetUserByUsername(username string) (*domain.User, error)
 	return &user, nil
 }
 
-func (p *UserProvider) CheckAndIncrementMessageCount(userID string) error {
-	log.Println("Checking user and incrementing counter if needed.")
+// DB exposes the underlying database so other repositories can share the
+// connection and the migrations run by NewUserProvider.
+func (p *UserProvider) DB() *sql.DB {
+	return p.db
+}
+
+// Reservation holds one message of a user's daily quota while a reply is
+// being generated. It must be either committed or released.
+type Reservation struct {
+	UserID string
+}
+
+// ReserveMessage holds a message slot for the user. Reserved slots count
+// against the limit but are only charged on commit.
+func (p *UserProvider) ReserveMessage(id string) (*Reservation, error) {
+	log.Println("Reserving message for user: " + id)
 
 	tx, err := p.db.Begin()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer tx.Rollback()
 
-	var messagesUsed int
-	var dailyMessageLimit int
+	var userID string
+	var messagesUsed, messagesReserved, dailyMessageLimit int
 	var lastReset time.Time
 
 	err = tx.QueryRow(`
-        SELECT messages_used, daily_message_limit, last_reset 
-        FROM users WHERE username = ?`, userID).Scan(
-		&messagesUsed, &dailyMessageLimit, &lastReset,
+        SELECT id, messages_used, messages_reserved, daily_message_limit, last_reset 
+        FROM users WHERE id = ?`, id).Scan(
+		&userID, &messagesUsed, &messagesReserved, &dailyMessageLimit, &lastReset,
 	)
 
 	if err == sql.ErrNoRows {
-		return ErrUserNotFound
+		return nil, ErrUserNotFound
 	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Check if we need to reset daily count
 	if time.Since(lastReset) > MESSAGES_RESET_TIME {
 		log.Println("Resetting!")
 		messagesUsed = 0
+		messagesReserved = 0
 		lastReset = time.Now()
 	}
 
-	// Check if user has reached their limit
-	if messagesUsed >= dailyMessageLimit {
-		return ErrDailyLimitReached
+	// Check if user has reached their limit, counting in-flight messages
+	if messagesUsed+messagesReserved >= dailyMessageLimit {
+		return nil, ErrDailyLimitReached
 	}
 
-	// Increment message count
 	_, err = tx.Exec(`
         UPDATE users 
-        SET messages_used = ?, last_reset = ?, last_active = ? 
-        WHERE username = ?`,
-		messagesUsed+1, lastReset, time.Now(), userID,
+        SET messages_used = ?, messages_reserved = ?, last_reset = ?, last_active = ? 
+        WHERE id = ?`,
+		messagesUsed, messagesReserved+1, lastReset, time.Now(), userID,
 	)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &Reservation{UserID: userID}, nil
+}
+
+// CommitReservation charges the reserved message against the quota.
+func (p *UserProvider) CommitReservation(reservation *Reservation) error {
+	_, err := p.db.Exec(`
+        UPDATE users 
+        SET messages_used = messages_used + 1,
+            messages_reserved = MAX(messages_reserved - 1, 0) 
+        WHERE id = ?`, reservation.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to commit reservation: %w", err)
 	}
+	return nil
+}
 
-	return tx.Commit()
+// ReleaseReservation gives the reserved message back without charging it.
+func (p *UserProvider) ReleaseReservation(reservation *Reservation) error {
+	_, err := p.db.Exec(`
+        UPDATE users 
+        SET messages_reserved = MAX(messages_reserved - 1, 0) 
+        WHERE id = ?`, reservation.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to release reservation: %w", err)
+	}
+	return nil
+}
+
+// SetLocale stores the locale the user's prompts, fallbacks and errors are
+// in. An empty locale clears it so requests negotiate one again.
+func (p *UserProvider) SetLocale(id string, locale domain.Locale) error {
+	log.Println("Setting locale for user: " + id)
+	if locale != "" && !locale.Supported() {
+		return ErrUnsupportedLocale
+	}
+
+	res, err := p.db.Exec(`UPDATE users SET locale = ? WHERE id = ?`, locale, id)
+	if err != nil {
+		return fmt.Errorf("failed to set locale: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// UserLocale returns the user's stored locale, or "" if they have none.
+func (p *UserProvider) UserLocale(id string) (domain.Locale, error) {
+	var locale domain.Locale
+	err := p.db.QueryRow(`SELECT locale FROM users WHERE id = ?`, id).Scan(&locale)
+	if err == sql.ErrNoRows {
+		return "", ErrUserNotFound
+	}
+	return locale, err
 }
 
 func (p *UserProvider) Close() error {
@@ -272,10 +421,13 @@ func (p *UserProvider) Close() error {
 var (
 	ErrUserNotFound      = errors.New("user not found")
 	ErrDailyLimitReached = errors.New("daily message limit reached")
+	ErrUnsupportedLocale = errors.New("locale must be one of en, de or es")
+	ErrUsernameTaken     = errors.New("username already in use")
+	ErrSubjectTaken      = errors.New("subject already linked to a user")
 )
 
-func (p *UserProvider) SetEntitlements(username string, entitlements domain.Entitlements) error {
-	log.Println("Updating entitlements for user:", username)
+func (p *UserProvider) SetEntitlements(id string, entitlements domain.Entitlements) error {
+	log.Println("Updating entitlements for user:", id)
 
 	query := `
         UPDATE users 
@@ -285,7 +437,7 @@ func (p *UserProvider) SetEntitlements(username string, entitlements domain.Enti
             subscription_platform = COALESCE(?, subscription_platform),
             original_transaction_id = COALESCE(?, original_transaction_id),
             subscription_expires_at = COALESCE(?, subscription_expires_at)
-        WHERE username = ?`
+        WHERE id = ?`
 
 	_, err := p.db.Exec(query,
 		entitlements.DailyMessageLimit,
@@ -294,7 +446,7 @@ func (p *UserProvider) SetEntitlements(username string, entitlements domain.Enti
 		entitlements.Subscription.Platform,
 		entitlements.Subscription.OriginalTransactionID,
 		entitlements.Subscription.ExpiresAt,
-		username,
+		id,
 	)
 
 	if err != nil {
@@ -0,0 +1,76 @@
+package userprovider
+
+import (
+	"errors"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"path/filepath"
+	"testing"
+)
+
+func newTestProvider(t *testing.T) *UserProvider {
+	t.Helper()
+
+	p, err := NewUserProvider(Config{
+		DatabasePath:   filepath.Join(t.TempDir(), "users.db"),
+		MigrationsPath: "../../../migrations",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.db.Close() })
+	return p
+}
+
+func TestLinkLegacyUser(t *testing.T) {
+	p := newTestProvider(t)
+
+	byUsername, err := p.CreateUser(domain.AuthProviderGoogle, "subject-1", "one@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byEmail, err := p.CreateUser(domain.AuthProviderGoogle, "legacy-name", "two@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, username := range []string{"shared-a", "shared-b"} {
+		if _, err := p.CreateUser(domain.AuthProviderGoogle, username, "shared@example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		subject       string
+		email         string
+		emailVerified bool
+		wantID        string
+	}{
+		{name: "unverified email does not link", subject: "subject-2", email: "two@example.com"},
+		{name: "ambiguous email does not link", subject: "subject-3", email: "shared@example.com", emailVerified: true},
+		{name: "username links without email", subject: "subject-1", wantID: byUsername.ID},
+		{name: "verified email links", subject: "subject-2", email: "two@example.com", emailVerified: true, wantID: byEmail.ID},
+		{name: "linked user does not link again", subject: "subject-4", email: "two@example.com", emailVerified: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := p.LinkLegacyUser(domain.AuthProviderGoogle, tt.subject, tt.email, tt.emailVerified)
+			if tt.wantID == "" {
+				if !errors.Is(err, ErrUserNotFound) {
+					t.Fatalf("LinkLegacyUser = %v, %v, want %v", user, err, ErrUserNotFound)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LinkLegacyUser = %v", err)
+			}
+			if user.ID != tt.wantID {
+				t.Errorf("linked user %s, want %s", user.ID, tt.wantID)
+			}
+
+			found, err := p.GetUserBySubject(domain.AuthProviderGoogle, tt.subject)
+			if err != nil || found.ID != tt.wantID {
+				t.Errorf("GetUserBySubject = %v, %v, want user %s", found, err, tt.wantID)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"time"
+)
+
+var priorities = []any{
+	string(domain.PlanPriorityHigh),
+	string(domain.PlanPriorityMedium),
+	string(domain.PlanPriorityLow),
+}
+
+// ActionPlanSchema is the shape of domain.ActionPlan the model fills in.
+var ActionPlanSchema = &Schema{
+	Type: "object",
+	Properties: map[string]*Schema{
+		"summary": {
+			Type:        "string",
+			Description: "One sentence on what the plan achieves",
+			MinLength:   intPtr(1),
+		},
+		"goals": {
+			Type:     "array",
+			MinItems: intPtr(1),
+			MaxItems: intPtr(5),
+			Items: &Schema{
+				Type: "object",
+				Properties: map[string]*Schema{
+					"title":    {Type: "string", MinLength: intPtr(1)},
+					"priority": {Type: "string", Enum: priorities},
+					"tasks": {
+						Type:     "array",
+						MinItems: intPtr(1),
+						MaxItems: intPtr(7),
+						Items: &Schema{
+							Type: "object",
+							Properties: map[string]*Schema{
+								"title":    {Type: "string", MinLength: intPtr(1), Description: "A concrete step starting with a verb"},
+								"deadline": {Type: "string", Format: "date", Description: "Due date as YYYY-MM-DD; omit when unknown"},
+								"priority": {Type: "string", Enum: priorities},
+							},
+							Required:             []string{"title", "priority"},
+							AdditionalProperties: new(bool),
+						},
+					},
+				},
+				Required:             []string{"title", "priority", "tasks"},
+				AdditionalProperties: new(bool),
+			},
+		},
+	},
+	Required:             []string{"summary", "goals"},
+	AdditionalProperties: new(bool),
+}
+
+// actionPlanMaxTokens leaves room for five goals of seven tasks each.
+const actionPlanMaxTokens = 1500
+
+type ActionPlanRequest struct {
+	// UserID and ConversationID are recorded with moderation decisions; the
+	// conversation may be empty for clients that send their own history.
+	UserID         string
+	ConversationID string
+	Messages       []Message
+	// Now dates the plan: deadlines may not lie before it.
+	Now time.Time
+}
+
+// ActionPlanner generates action plans. GPTService plans and
+// ModeratedService checks what goes in and comes out.
+type ActionPlanner interface {
+	GenerateActionPlan(ctx context.Context, req ActionPlanRequest) (domain.ActionPlan, Result, error)
+}
+
+// Planner returns the outermost planner in the decorator chain, so plans are
+// moderated when replies are.
+func Planner(service Service) ActionPlanner {
+	if moderated, ok := find[*ModeratedService](service); ok {
+		return moderated
+	}
+	return Base(service)
+}
+
+// GenerateActionPlan turns a conversation into a validated plan using the
+// runtime config. Deadlines are relative to req.Now and may not lie in the
+// past. Replies that break the schema are sent back to the model with the
+// problem.
+func (s *GPTService) GenerateActionPlan(ctx context.Context, req ActionPlanRequest) (domain.ActionPlan, Result, error) {
+	s.configMutex.RLock()
+	config := s.config
+	s.configMutex.RUnlock()
+
+	schema, _ := json.Marshal(ActionPlanSchema)
+	today := req.Now.Format(time.DateOnly)
+	request := CompletionRequest{
+		Model: config.Model,
+		Messages: []Message{
+			{
+				Role: RoleSystem,
+				Content: "You turn coaching conversations into action plans. Collect the goals the user is working towards and the concrete tasks the coach advised for each, " +
+					"with a priority and, where the conversation implies one, a deadline. Do not invent goals the conversation does not support. " +
+					"Today is " + today + "; deadlines must not be earlier. " +
+					"Reply with a single JSON object and nothing else. It must match this JSON Schema:\n" + string(schema),
+			},
+			{
+				Role:    RoleUser,
+				Content: "Build an action plan from the following conversation:\n\n" + formatTranscript(req.Messages),
+			},
+		},
+		MaxTokens:   actionPlanMaxTokens,
+		Temperature: min(config.Temperature, 0.3),
+		JSON:        true,
+	}
+
+	var plan domain.ActionPlan
+	result, err := s.completeJSON(ctx, config.callTimeout(), request, func(raw []byte) error {
+		if err := ActionPlanSchema.Validate(raw); err != nil {
+			return err
+		}
+		plan = domain.ActionPlan{}
+		if err := json.Unmarshal(raw, &plan); err != nil {
+			return fmt.Errorf("%w: %w", ErrSchemaViolation, err)
+		}
+		for i, goal := range plan.Goals {
+			for j, task := range goal.Tasks {
+				if task.Deadline != "" && task.Deadline < today {
+					return violation(fmt.Sprintf("$.goals[%d].tasks[%d].deadline", i, j), "deadline is before today, "+today)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return domain.ActionPlan{}, Result{}, fmt.Errorf("error generating action plan: %w", err)
+	}
+
+	plan.Model = result.Model
+	return plan, result, nil
+}
@@ -0,0 +1,306 @@
+package chat
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	anthropicDefaultBaseURL = "https://api.anthropic.com"
+	anthropicVersion        = "2023-06-01"
+	// anthropicDefaultMaxTokens applies when a request sets no limit, since
+	// the Messages API requires one
+	anthropicDefaultMaxTokens = 1024
+)
+
+// AnthropicProvider talks to the Anthropic Messages API.
+type AnthropicProvider struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+func NewAnthropicProvider(apiKey string, baseURL string, httpClient *http.Client) *AnthropicProvider {
+	if baseURL == "" {
+		baseURL = anthropicDefaultBaseURL
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &AnthropicProvider{
+		apiKey:     apiKey,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+func (p *AnthropicProvider) Name() string {
+	return BackendAnthropic
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature *float32           `json:"temperature,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      anthropicUsage `json:"usage"`
+}
+
+type anthropicError struct {
+	Type  string `json:"type"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicStreamEvent covers the fields we need from every streaming event
+// type; unused fields are simply left empty.
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *AnthropicProvider) CreateCompletion(ctx context.Context, req CompletionRequest) (*Completion, error) {
+	resp, err := p.do(ctx, toAnthropicRequest(req, false))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode anthropic response: %w", err)
+	}
+
+	var content strings.Builder
+	for _, block := range body.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+
+	return &Completion{
+		Content:      content.String(),
+		FinishReason: anthropicFinishReason(body.StopReason),
+		Usage: Usage{
+			PromptTokens:     body.Usage.InputTokens,
+			CompletionTokens: body.Usage.OutputTokens,
+			TotalTokens:      body.Usage.InputTokens + body.Usage.OutputTokens,
+		},
+	}, nil
+}
+
+func (p *AnthropicProvider) StreamCompletion(ctx context.Context, req CompletionRequest, onDelta func(string) error) (*Completion, error) {
+	resp, err := p.do(ctx, toAnthropicRequest(req, true))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	result := &Completion{}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &event); err != nil {
+			return nil, fmt.Errorf("failed to decode anthropic stream event: %w", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			result.Usage.PromptTokens = event.Message.Usage.InputTokens
+		case "content_block_delta":
+			if event.Delta.Type != "text_delta" || event.Delta.Text == "" {
+				continue
+			}
+			content.WriteString(event.Delta.Text)
+			if err := onDelta(event.Delta.Text); err != nil {
+				return nil, err
+			}
+		case "message_delta":
+			result.FinishReason = anthropicFinishReason(event.Delta.StopReason)
+			result.Usage.CompletionTokens = event.Usage.OutputTokens
+		case "error":
+			return nil, &ProviderError{
+				Provider:   BackendAnthropic,
+				StatusCode: http.StatusInternalServerError,
+				Type:       event.Error.Type,
+				Message:    event.Error.Message,
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading completion stream: %w", err)
+	}
+
+	result.Content = content.String()
+	result.Usage.TotalTokens = result.Usage.PromptTokens + result.Usage.CompletionTokens
+	return result, nil
+}
+
+type anthropicModelList struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// ListModels returns the first page of models, which covers every model the
+// API currently serves.
+func (p *AnthropicProvider) ListModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/v1/models?limit=1000", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body anthropicModelList
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode anthropic model list: %w", err)
+	}
+
+	models := make([]string, 0, len(body.Data))
+	for _, model := range body.Data {
+		models = append(models, model.ID)
+	}
+	return models, nil
+}
+
+// do sends a Messages API request and returns the response if it succeeded.
+func (p *AnthropicProvider) do(ctx context.Context, body anthropicRequest) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/v1/messages", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return p.send(req)
+}
+
+// send authenticates and sends the request. Error responses are decoded into
+// a ProviderError.
+func (p *AnthropicProvider) send(req *http.Request) (*http.Response, error) {
+	req.Header.Set("x-api-key", p.apiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("anthropic request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		providerErr := &ProviderError{
+			Provider:   BackendAnthropic,
+			StatusCode: resp.StatusCode,
+			Message:    http.StatusText(resp.StatusCode),
+			RetryAfter: parseRetryAfter(resp.Header),
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		var apiErr anthropicError
+		if json.Unmarshal(raw, &apiErr) == nil && apiErr.Error.Message != "" {
+			providerErr.Type = apiErr.Error.Type
+			providerErr.Message = apiErr.Error.Message
+		}
+		return nil, providerErr
+	}
+
+	return resp, nil
+}
+
+// toAnthropicRequest moves system messages into the top-level system field,
+// which is where the Messages API expects them.
+func toAnthropicRequest(req CompletionRequest, stream bool) anthropicRequest {
+	var system []string
+	messages := make([]anthropicMessage, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		if msg.Role == RoleSystem {
+			system = append(system, msg.Content)
+			continue
+		}
+		messages = append(messages, anthropicMessage{
+			Role:    string(msg.Role),
+			Content: msg.Content,
+		})
+	}
+
+	// Anthropic only accepts temperatures up to 1
+	temperature := min(req.Temperature, 1)
+
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = anthropicDefaultMaxTokens
+	}
+
+	return anthropicRequest{
+		Model:       req.Model,
+		System:      strings.Join(system, "\n\n"),
+		Messages:    messages,
+		MaxTokens:   maxTokens,
+		Temperature: &temperature,
+		Stream:      stream,
+	}
+}
+
+// anthropicFinishReason reports a refusal the way OpenAI does, so toResult turns it
+// into ErrContentBlocked rather than an empty completion.
+func anthropicFinishReason(stopReason string) string {
+	if stopReason == "refusal" {
+		return "content_filter"
+	}
+	return stopReason
+}
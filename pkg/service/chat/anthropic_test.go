@@ -0,0 +1,230 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAnthropicRequestMapping(t *testing.T) {
+	var got anthropicRequest
+	provider := newTestProvider(t, BackendAnthropic, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/messages" {
+			t.Errorf("request = %s %s, want POST /v1/messages", r.Method, r.URL.Path)
+		}
+		if key := r.Header.Get("x-api-key"); key != "test-key" {
+			t.Errorf("x-api-key = %q, want %q", key, "test-key")
+		}
+		if version := r.Header.Get("anthropic-version"); version != anthropicVersion {
+			t.Errorf("anthropic-version = %q, want %q", version, anthropicVersion)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"content": [{"type": "text", "text": "Hello"}, {"type": "tool_use"}, {"type": "text", "text": " there"}],
+			"stop_reason": "end_turn",
+			"usage": {"input_tokens": 20, "output_tokens": 3}
+		}`))
+	}, nil)
+
+	completion, err := provider.CreateCompletion(context.Background(), CompletionRequest{
+		Model: "claude-test",
+		Messages: []Message{
+			{Role: RoleSystem, Content: "Be brief."},
+			{Role: RoleUser, Content: "Hi"},
+			{Role: RoleSystem, Content: "Answer in English."},
+			{Role: RoleAssistant, Content: "Hello"},
+			{Role: RoleUser, Content: "How are you?"},
+		},
+		MaxTokens:   64,
+		Temperature: 1.5,
+	})
+	if err != nil {
+		t.Fatalf("CreateCompletion: %v", err)
+	}
+
+	want := anthropicRequest{
+		Model: "claude-test",
+		// System messages move to the system field, in order
+		System: "Be brief.\n\nAnswer in English.",
+		Messages: []anthropicMessage{
+			{Role: "user", Content: "Hi"},
+			{Role: "assistant", Content: "Hello"},
+			{Role: "user", Content: "How are you?"},
+		},
+		MaxTokens: 64,
+	}
+	if got.Temperature == nil || *got.Temperature != 1 {
+		t.Errorf("temperature = %v, want it clamped to 1", got.Temperature)
+	}
+	got.Temperature = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("request = %+v, want %+v", got, want)
+	}
+
+	wantCompletion := &Completion{
+		Content:      "Hello there",
+		FinishReason: "end_turn",
+		Usage:        Usage{PromptTokens: 20, CompletionTokens: 3, TotalTokens: 23},
+	}
+	if !reflect.DeepEqual(completion, wantCompletion) {
+		t.Errorf("completion = %+v, want %+v", completion, wantCompletion)
+	}
+}
+
+func TestAnthropicStreamCompletion(t *testing.T) {
+	var got anthropicRequest
+	provider := newTestProvider(t, BackendAnthropic, func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		writeSSE(w,
+			"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":11,\"output_tokens\":1}}}",
+			"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}",
+			"event: ping\ndata: {\"type\":\"ping\"}",
+			"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hel\"}}",
+			"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"lo\"}}",
+			"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}",
+			"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":2}}",
+			"event: message_stop\ndata: {\"type\":\"message_stop\"}",
+		)
+	}, nil)
+
+	var deltas []string
+	completion, err := provider.StreamCompletion(context.Background(), CompletionRequest{Model: "claude-test", MaxTokens: 16}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamCompletion: %v", err)
+	}
+
+	if !got.Stream {
+		t.Error("streaming request did not ask for a stream")
+	}
+	if want := []string{"Hel", "lo"}; !reflect.DeepEqual(deltas, want) {
+		t.Errorf("deltas = %q, want %q", deltas, want)
+	}
+	want := &Completion{
+		Content:      "Hello",
+		FinishReason: "end_turn",
+		Usage:        Usage{PromptTokens: 11, CompletionTokens: 2, TotalTokens: 13},
+	}
+	if !reflect.DeepEqual(completion, want) {
+		t.Errorf("completion = %+v, want %+v", completion, want)
+	}
+}
+
+func TestAnthropicDefaultMaxTokens(t *testing.T) {
+	var got anthropicRequest
+	provider := newTestProvider(t, BackendAnthropic, func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"content": [{"type": "text", "text": "Hi"}], "stop_reason": "end_turn"}`))
+	}, nil)
+
+	if _, err := provider.CreateCompletion(context.Background(), CompletionRequest{Model: "claude-test"}); err != nil {
+		t.Fatalf("CreateCompletion: %v", err)
+	}
+	if got.MaxTokens != anthropicDefaultMaxTokens {
+		t.Errorf("max_tokens = %d, want %d", got.MaxTokens, anthropicDefaultMaxTokens)
+	}
+}
+
+func TestAnthropicRefusal(t *testing.T) {
+	tests := []struct {
+		name     string
+		complete func(provider Provider) (*Completion, error)
+		handler  http.HandlerFunc
+	}{
+		{
+			name: "completion",
+			complete: func(provider Provider) (*Completion, error) {
+				return provider.CreateCompletion(context.Background(), CompletionRequest{Model: "claude-test"})
+			},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"content": [], "stop_reason": "refusal", "usage": {"input_tokens": 20, "output_tokens": 0}}`))
+			},
+		},
+		{
+			name: "stream",
+			complete: func(provider Provider) (*Completion, error) {
+				return provider.StreamCompletion(context.Background(), CompletionRequest{Model: "claude-test"}, func(string) error { return nil })
+			},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				writeSSE(w,
+					"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":20}}}",
+					"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"refusal\"},\"usage\":{\"output_tokens\":0}}",
+					"event: message_stop\ndata: {\"type\":\"message_stop\"}",
+				)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			completion, err := tt.complete(newTestProvider(t, BackendAnthropic, tt.handler, nil))
+			if err != nil {
+				t.Fatalf("completion failed: %v", err)
+			}
+			if _, err := toResult("claude-test", completion); !errors.Is(err, ErrContentBlocked) {
+				t.Errorf("toResult = %v, want %v", err, ErrContentBlocked)
+			}
+		})
+	}
+}
+
+func TestAnthropicStreamErrorEvent(t *testing.T) {
+	provider := newTestProvider(t, BackendAnthropic, func(w http.ResponseWriter, r *http.Request) {
+		writeSSE(w,
+			"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":11}}}",
+			"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hel\"}}",
+			"event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}",
+		)
+	}, nil)
+
+	var deltas []string
+	_, err := provider.StreamCompletion(context.Background(), CompletionRequest{Model: "claude-test"}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) || providerErr.Type != "overloaded_error" {
+		t.Fatalf("err = %v, want an overloaded_error ProviderError", err)
+	}
+	if classified := classifyError(err); !errors.Is(classified, ErrUpstreamUnavailable) {
+		t.Errorf("classifyError(%v) = %v, want %v", err, classified, ErrUpstreamUnavailable)
+	}
+	if want := []string{"Hel"}; !reflect.DeepEqual(deltas, want) {
+		t.Errorf("deltas = %q, want %q", deltas, want)
+	}
+}
+
+func TestAnthropicErrorBody(t *testing.T) {
+	provider := newTestProvider(t, BackendAnthropic, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("retry-after-ms", "1500")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"type":"error","error":{"type":"rate_limit_error","message":"Number of requests has exceeded your rate limit"}}`))
+	}, nil)
+
+	_, err := provider.CreateCompletion(context.Background(), CompletionRequest{Model: "claude-test"})
+
+	want := &ProviderError{
+		Provider:   BackendAnthropic,
+		StatusCode: http.StatusTooManyRequests,
+		Type:       "rate_limit_error",
+		Message:    "Number of requests has exceeded your rate limit",
+		RetryAfter: 1500 * time.Millisecond,
+	}
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) || !reflect.DeepEqual(providerErr, want) {
+		t.Fatalf("err = %#v, want %#v", err, want)
+	}
+}
@@ -0,0 +1,239 @@
+package chat
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// defaultContextBudget applies to models without an entry in
+	// Config.ContextBudgets or DefaultContextBudgets.
+	defaultContextBudget = 8000
+
+	// messageTokenOverhead approximates the per-message framing tokens the
+	// chat format adds around role and content.
+	messageTokenOverhead = 4
+
+	// maxCachedSummaries bounds the rolling summary cache.
+	maxCachedSummaries = 1000
+)
+
+// DefaultContextBudgets is the prompt token budget per model, leaving room
+// for the reply within the model's context window.
+var DefaultContextBudgets = map[string]int{
+	"gpt-4o":                   16000,
+	"gpt-4o-mini":              16000,
+	"gpt-4-turbo":              16000,
+	"gpt-3.5-turbo":            12000,
+	"claude-3-5-sonnet-latest": 16000,
+	"claude-3-5-haiku-latest":  16000,
+}
+
+// Tokenizer counts the tokens a piece of text costs.
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// ApproxTokenizer estimates token counts without a model-specific
+// vocabulary: roughly four characters per token, but never fewer tokens than
+// words and punctuation marks. It is only a fallback, for models whose
+// vocabulary is unknown, and can be off in either direction.
+type ApproxTokenizer struct{}
+
+func (ApproxTokenizer) CountTokens(text string) int {
+	chars := utf8.RuneCountInString(text)
+	if chars == 0 {
+		return 0
+	}
+
+	pieces := 0
+	inWord := false
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if !inWord {
+				pieces++
+			}
+			inWord = true
+		case unicode.IsSpace(r):
+			inWord = false
+		default:
+			pieces++
+			inWord = false
+		}
+	}
+
+	return max(int(math.Ceil(float64(chars)/4)), pieces)
+}
+
+type rollingSummary struct {
+	// covered is how many leading messages the summary folds in, and
+	// coveredHash fingerprints them so edited histories are detected.
+	covered     int
+	coveredHash string
+	summary     string
+	lastUsed    time.Time
+}
+
+// BudgetManager trims conversations to a token budget. It keeps the system
+// prompt and the most recent turns, and folds everything older into a
+// rolling summary that is cached per conversation and extended as the
+// conversation grows.
+type BudgetManager struct {
+	tokenizers func(model string) Tokenizer
+	summarize  func(context.Context, []Message) (Result, error)
+
+	mu        sync.Mutex
+	summaries map[string]*rollingSummary
+}
+
+// NewBudgetManager counts a model's tokens with the tokenizer tokenizers
+// returns for it, such as TokenizerFor.
+func NewBudgetManager(tokenizers func(model string) Tokenizer, summarize func(context.Context, []Message) (Result, error)) *BudgetManager {
+	return &BudgetManager{
+		tokenizers: tokenizers,
+		summarize:  summarize,
+		summaries:  make(map[string]*rollingSummary),
+	}
+}
+
+func countMessages(tokenizer Tokenizer, messages []Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += tokenizer.CountTokens(msg.Content) + messageTokenOverhead
+	}
+	return total
+}
+
+// Fit returns the messages to send to model, starting with the system
+// prompt. When the history fits in budget it is returned unchanged. If the
+// summary cannot be produced the older turns are dropped instead.
+func (b *BudgetManager) Fit(ctx context.Context, model string, conversationID string, budget int, system Message, history []Message) []Message {
+	tokenizer := b.tokenizers(model)
+	if countMessages(tokenizer, history)+countMessages(tokenizer, []Message{system}) <= budget {
+		return append([]Message{system}, history...)
+	}
+
+	// A quarter of the budget is set aside for the summary itself
+	remaining := budget - countMessages(tokenizer, []Message{system}) - budget/4
+
+	// Walk back from the newest message, always keeping at least one
+	cut := len(history)
+	for cut > 0 {
+		cost := countMessages(tokenizer, history[cut-1:cut])
+		if cut < len(history) && cost > remaining {
+			break
+		}
+		remaining -= cost
+		cut--
+	}
+
+	// Start the kept window on a user turn; some backends reject histories
+	// that open with the assistant
+	for cut > 0 && cut < len(history)-1 && history[cut].Role == RoleAssistant {
+		cut++
+	}
+
+	result := []Message{system}
+	if cut > 0 {
+		summary := b.rollingSummary(ctx, conversationKey(conversationID, history), history[:cut])
+		if summary != "" {
+			result = append(result, Message{
+				Role:    RoleSystem,
+				Content: "Summary of the earlier conversation: " + summary,
+			})
+		}
+	}
+
+	log.Printf("Context window: summarized %d messages, kept %d", cut, len(history)-cut)
+	return append(result, history[cut:]...)
+}
+
+// rollingSummary returns a summary covering older, reusing and extending the
+// cached one when it still matches the start of the history.
+func (b *BudgetManager) rollingSummary(ctx context.Context, key string, older []Message) string {
+	b.mu.Lock()
+	cached := b.summaries[key]
+	b.mu.Unlock()
+
+	toFold := older
+	if cached != nil && cached.covered <= len(older) && cached.coveredHash == hashMessages(older[:cached.covered]) {
+		if cached.covered == len(older) {
+			b.touch(cached)
+			return cached.summary
+		}
+		toFold = append([]Message{{
+			Role:    RoleSystem,
+			Content: cached.summary,
+		}}, older[cached.covered:]...)
+	}
+
+	result, err := b.summarize(ctx, toFold)
+	if err != nil {
+		log.Println("Failed to summarize older turns: " + err.Error())
+		return ""
+	}
+	summary := result.Content
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.summaries[key] = &rollingSummary{
+		covered:     len(older),
+		coveredHash: hashMessages(older),
+		summary:     summary,
+		lastUsed:    time.Now(),
+	}
+	b.evictLocked()
+	return summary
+}
+
+func (b *BudgetManager) touch(summary *rollingSummary) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	summary.lastUsed = time.Now()
+}
+
+// evictLocked drops the least recently used summary once the cache is full.
+func (b *BudgetManager) evictLocked() {
+	if len(b.summaries) <= maxCachedSummaries {
+		return
+	}
+
+	var oldestKey string
+	var oldest time.Time
+	for key, summary := range b.summaries {
+		if oldestKey == "" || summary.lastUsed.Before(oldest) {
+			oldestKey, oldest = key, summary.lastUsed
+		}
+	}
+	delete(b.summaries, oldestKey)
+}
+
+// conversationKey identifies a conversation for caching. Clients that send
+// their own history have no conversation ID, so their opening message stands
+// in for one.
+func conversationKey(conversationID string, history []Message) string {
+	if conversationID != "" {
+		return conversationID
+	}
+	return "anon:" + hashMessages(history[:1])
+}
+
+func hashMessages(messages []Message) string {
+	h := sha256.New()
+	for _, msg := range messages {
+		h.Write([]byte(msg.Role))
+		h.Write([]byte{0})
+		h.Write([]byte(strings.TrimSpace(msg.Content)))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,322 @@
+package chat
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ResultStore is the persistent tier of the result cache. Implementations
+// must not return expired entries.
+type ResultStore interface {
+	GetResult(key string) (value []byte, ok bool, err error)
+	PutResult(key string, value []byte, ttl time.Duration) error
+	PurgeResults() error
+}
+
+type CacheOptions struct {
+	// Size is the number of results kept in memory.
+	Size int
+	// TTL is how long a result stays valid in either tier.
+	TTL time.Duration
+}
+
+const (
+	DefaultCacheSize = 1000
+	DefaultCacheTTL  = 24 * time.Hour
+)
+
+// CacheStats counts lookups since the service started.
+type CacheStats struct {
+	MemoryHits int64   `json:"memory_hits"`
+	StoreHits  int64   `json:"store_hits"`
+	Misses     int64   `json:"misses"`
+	HitRate    float64 `json:"hit_rate"`
+	Entries    int     `json:"entries"`
+}
+
+// CachedService serves repeated summaries and replies from a cache. Results
+// are keyed on the messages together with the exact prompt, model and
+// options they were generated with, so a different prompt or config never
+// hits an old entry. Both tiers are also emptied when the prompt or config
+// changes. Fallbacks and errors are never cached.
+type CachedService struct {
+	next   Service
+	base   *GPTService
+	memory *lru
+	store  ResultStore
+	ttl    time.Duration
+
+	memoryHits atomic.Int64
+	storeHits  atomic.Int64
+	misses     atomic.Int64
+}
+
+// NewCachedService wraps next, which must have a GPTService at its base.
+// store may be nil for a memory-only cache.
+func NewCachedService(next Service, store ResultStore, options CacheOptions) (*CachedService, error) {
+	base := Base(next)
+	if base == nil {
+		return nil, fmt.Errorf("result cache needs a GPTService to key on")
+	}
+	if options.Size <= 0 {
+		options.Size = DefaultCacheSize
+	}
+	if options.TTL <= 0 {
+		options.TTL = DefaultCacheTTL
+	}
+
+	c := &CachedService{
+		next:   next,
+		base:   base,
+		memory: newLRU(options.Size),
+		store:  store,
+		ttl:    options.TTL,
+	}
+	base.OnChange(c.Purge)
+	return c, nil
+}
+
+func (c *CachedService) Unwrap() Service {
+	return c.next
+}
+
+func (c *CachedService) Summarize(ctx context.Context, messages []Message, options SummaryOptions) (Result, error) {
+	if err := options.Validate(); err != nil {
+		return Result{}, err
+	}
+	request, _ := c.base.summaryRequest(messages, options)
+	key := cacheKey("summarize", request)
+	if result, ok := c.lookup(key); ok {
+		return result, nil
+	}
+
+	result, err := c.next.Summarize(ctx, messages, options)
+	if err != nil {
+		return result, err
+	}
+	c.save(key, result)
+	return result, nil
+}
+
+func (c *CachedService) GetNextMessage(ctx context.Context, req NextMessageRequest) (Result, error) {
+	key, prepared, err := c.nextMessageKey(&req)
+	if err != nil {
+		return c.next.GetNextMessage(ctx, req)
+	}
+	if result, ok := c.lookup(key); ok {
+		return prepared.annotate(result), nil
+	}
+
+	result, err := c.next.GetNextMessage(ctx, req)
+	if err != nil {
+		return result, err
+	}
+	c.save(key, result)
+	return result, nil
+}
+
+// StreamNextMessage sends a cached reply as a single delta.
+func (c *CachedService) StreamNextMessage(ctx context.Context, req NextMessageRequest, onDelta func(string) error) (Result, error) {
+	key, prepared, err := c.nextMessageKey(&req)
+	if err != nil {
+		return c.next.StreamNextMessage(ctx, req, onDelta)
+	}
+	if result, ok := c.lookup(key); ok {
+		if err := onDelta(result.Content); err != nil {
+			return Result{}, err
+		}
+		return prepared.annotate(result), nil
+	}
+
+	result, err := c.next.StreamNextMessage(ctx, req, onDelta)
+	if err != nil {
+		return result, err
+	}
+	c.save(key, result)
+	return result, nil
+}
+
+// Purge empties both tiers.
+func (c *CachedService) Purge() {
+	c.memory.purge()
+	if c.store == nil {
+		return
+	}
+	if err := c.store.PurgeResults(); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+func (c *CachedService) Stats() CacheStats {
+	stats := CacheStats{
+		MemoryHits: c.memoryHits.Load(),
+		StoreHits:  c.storeHits.Load(),
+		Misses:     c.misses.Load(),
+		Entries:    c.memory.len(),
+	}
+	if total := stats.MemoryHits + stats.StoreHits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.MemoryHits+stats.StoreHits) / float64(total)
+	}
+	return stats
+}
+
+// nextMessageKey resolves the persona and variant the request would get, so
+// users in different variants do not share replies. The resolution is kept
+// in req for the service below, which would otherwise repeat it. The history
+// is hashed before it is trimmed to the context budget, which could cost a
+// summary.
+func (c *CachedService) nextMessageKey(req *NextMessageRequest) (string, preparedRequest, error) {
+	prepared, system, err := c.base.resolve(*req)
+	if err != nil {
+		return "", preparedRequest{}, err
+	}
+	req.resolved = &resolvedRequest{prepared: prepared, system: system}
+
+	config := prepared.config
+	request := CompletionRequest{
+		Model:            config.Model,
+		Messages:         append([]Message{system}, req.Messages...),
+		MaxTokens:        config.MaxTokens,
+		Temperature:      config.Temperature,
+		PresencePenalty:  config.PresencePenalty,
+		FrequencyPenalty: config.FrequencyPenalty,
+	}
+	return cacheKey("next", request), prepared, nil
+}
+
+func (c *CachedService) lookup(key string) (Result, bool) {
+	if result, ok := c.memory.get(key); ok {
+		c.memoryHits.Add(1)
+		return cachedResult(result), true
+	}
+
+	if c.store != nil {
+		value, ok, err := c.store.GetResult(key)
+		if err != nil {
+			log.Println(err.Error())
+		}
+		var result Result
+		if ok && json.Unmarshal(value, &result) == nil {
+			c.storeHits.Add(1)
+			c.memory.add(key, result, time.Now().Add(c.ttl))
+			return cachedResult(result), true
+		}
+	}
+
+	c.misses.Add(1)
+	return Result{}, false
+}
+
+func (c *CachedService) save(key string, result Result) {
+	if result.Fallback || result.Cached {
+		return
+	}
+
+	c.memory.add(key, result, time.Now().Add(c.ttl))
+	if c.store == nil {
+		return
+	}
+	value, err := json.Marshal(result)
+	if err == nil {
+		err = c.store.PutResult(key, value, c.ttl)
+	}
+	if err != nil {
+		log.Println(err.Error())
+	}
+}
+
+func cachedResult(result Result) Result {
+	result.Cached = true
+	result.Usage = Usage{}
+	return result
+}
+
+// cacheKey hashes everything that determines a completion.
+func cacheKey(kind string, request CompletionRequest) string {
+	raw, _ := json.Marshal(struct {
+		Kind    string
+		Request CompletionRequest
+	}{kind, request})
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// lru is the in-memory tier: a fixed number of results, least recently used
+// evicted first.
+type lru struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type lruEntry struct {
+	key       string
+	result    Result
+	expiresAt time.Time
+}
+
+func newLRU(capacity int) *lru {
+	return &lru{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (l *lru) get(key string) (Result, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	element, ok := l.entries[key]
+	if !ok {
+		return Result{}, false
+	}
+	entry := element.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		l.order.Remove(element)
+		delete(l.entries, key)
+		return Result{}, false
+	}
+	l.order.MoveToFront(element)
+	return entry.result, true
+}
+
+func (l *lru) add(key string, result Result, expiresAt time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if element, ok := l.entries[key]; ok {
+		element.Value = &lruEntry{key: key, result: result, expiresAt: expiresAt}
+		l.order.MoveToFront(element)
+		return
+	}
+
+	l.entries[key] = l.order.PushFront(&lruEntry{key: key, result: result, expiresAt: expiresAt})
+	if l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (l *lru) purge() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.order.Init()
+	l.entries = make(map[string]*list.Element)
+}
+
+func (l *lru) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
@@ -2,158 +2,594 @@ package chat
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/sashabaranov/go-openai"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/fgb-andu/hustl-api/pkg/service/retry"
 	"log"
 	"log/slog"
-	"math/rand"
 	"strings"
 	"sync"
 	"time"
 )
 
+// Service generates chat replies. Cancelling ctx aborts the upstream
+// request; errors wrap one of the sentinels in errors.go.
 type Service interface {
-	Summarize([]string) string
-	GetNextMessage([]string) string
+	Summarize(ctx context.Context, messages []Message, options SummaryOptions) (Result, error)
+	GetNextMessage(ctx context.Context, req NextMessageRequest) (Result, error)
+	// StreamNextMessage generates the next message like GetNextMessage, but
+	// hands every content delta to onDelta as soon as it arrives.
+	StreamNextMessage(ctx context.Context, req NextMessageRequest, onDelta func(string) error) (Result, error)
+}
+
+// Base returns the GPTService behind any decorators such as
+// ModeratedService, or nil if there is none.
+func Base(service Service) *GPTService {
+	base, _ := find[*GPTService](service)
+	return base
+}
+
+// Cache returns the CachedService in the decorator chain, or nil if results
+// are not cached.
+func Cache(service Service) *CachedService {
+	cache, _ := find[*CachedService](service)
+	return cache
+}
+
+// find walks the decorator chain down to the first service of type T.
+func find[T Service](service Service) (T, bool) {
+	for {
+		if s, ok := service.(T); ok {
+			return s, true
+		}
+		wrapper, ok := service.(interface{ Unwrap() Service })
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		service = wrapper.Unwrap()
+	}
+}
+
+type Result struct {
+	Content string `json:"content"`
+	Model   string `json:"model"`
+	Persona string `json:"persona,omitempty"`
+	// PromptVersionID identifies the stored global prompt that produced
+	// Content, if any.
+	PromptVersionID string `json:"prompt_version_id,omitempty"`
+	// ExperimentID and VariantID are set when the user is enrolled in a
+	// running experiment.
+	ExperimentID string `json:"experiment_id,omitempty"`
+	VariantID    string `json:"variant_id,omitempty"`
+	// Moderation is set when moderation flagged or replaced the reply.
+	Moderation *ModerationOutcome `json:"moderation,omitempty"`
+	// Cached is set when Content was served from the result cache; Usage is
+	// then zero because no tokens were spent.
+	Cached bool `json:"cached,omitempty"`
+	// Data is Content as raw JSON when structured output was requested.
+	Data         json.RawMessage `json:"data,omitempty"`
+	FinishReason string          `json:"finish_reason,omitempty"`
+	Usage        Usage           `json:"usage"`
+
+	// Fallback is set when Content is a canned message rather than a
+	// completion; FallbackReason says why.
+	Fallback       bool   `json:"fallback,omitempty"`
+	FallbackReason string `json:"fallback_reason,omitempty"`
+}
+
+// Reasons reported in Result.FallbackReason.
+const (
+	FallbackReasonCircuitOpen = "circuit_open"
+	FallbackReasonRateLimited = "rate_limited"
+	FallbackReasonUnavailable = "upstream_unavailable"
+	FallbackReasonTimeout     = "timeout"
+	FallbackReasonEmpty       = "empty_completion"
+)
+
+func fallbackReason(err error) string {
+	switch {
+	case errors.Is(err, retry.ErrCircuitOpen):
+		return FallbackReasonCircuitOpen
+	case errors.Is(err, ErrRateLimited):
+		return FallbackReasonRateLimited
+	case errors.Is(err, ErrTimeout):
+		return FallbackReasonTimeout
+	case errors.Is(err, ErrEmptyCompletion):
+		return FallbackReasonEmpty
+	default:
+		return FallbackReasonUnavailable
+	}
+}
+
+type NextMessageRequest struct {
+	// UserID assigns the user to an experiment variant; it may be empty.
+	UserID string
+	// ConversationID is empty for clients that send their own history.
+	ConversationID string
+	// PersonaID selects a persona; empty means the default persona.
+	PersonaID string
+	Messages  []Message
+	// Now is the user's local time, which dates in the prompt are based on.
+	// Zero means the server's time.
+	Now time.Time
+	// Locale is the language to reply in; empty means DefaultLocale.
+	Locale domain.Locale
+
+	// noExperiment keeps the request out of experiments, for messages the
+	// user did not ask for
+	noExperiment bool
+	// resolved is set by a decorator that already resolved the request, so
+	// the persona and variant are not looked up a second time
+	resolved *resolvedRequest
+}
+
+var (
+	ErrInvalidRole   = errors.New("message role must be user or assistant")
+	ErrSystemMessage = errors.New("system messages are not accepted from clients")
+	ErrEmptyMessage  = errors.New("message content must not be empty")
+)
+
+// ValidateClientMessages checks messages received from a client. Only user
+// and assistant turns are allowed; the system prompt is owned by the server.
+func ValidateClientMessages(messages []Message) error {
+	for i, msg := range messages {
+		if msg.Role == RoleSystem {
+			return fmt.Errorf("message %d: %w", i, ErrSystemMessage)
+		}
+		if !msg.Role.Valid() {
+			return fmt.Errorf("message %d: %w", i, ErrInvalidRole)
+		}
+		if strings.TrimSpace(msg.Content) == "" {
+			return fmt.Errorf("message %d: %w", i, ErrEmptyMessage)
+		}
+	}
+	return nil
+}
+
+// FromLegacyMessages converts the v1 format, where messages alternate between
+// user and assistant starting with the user.
+func FromLegacyMessages(messages []string) []Message {
+	converted := make([]Message, 0, len(messages))
+	for i, msg := range messages {
+		role := RoleUser
+		if i%2 == 1 {
+			role = RoleAssistant
+		}
+		converted = append(converted, Message{
+			Role:    role,
+			Content: msg,
+		})
+	}
+	return converted
+}
+
+// Usage reports the tokens consumed by a single completion.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
 }
 
 type GPTService struct {
-	client *openai.Client
-	model  string
+	provider Provider
+	model    string
+	budget   *BudgetManager
+
+	// Provider calls go through the breaker and are retried per policy
+	retryPolicy retry.Policy
+	breaker     *retry.Breaker
 
 	// Configuration with thread-safe access
 	config      Config
 	configMutex sync.RWMutex
 
-	// Initial prompt for GetNextMessage
-	initialPrompt string
+	// The provider's models, used to validate config changes
+	models          []string
+	modelsFetchedAt time.Time
+	modelsMutex     sync.Mutex
+
+	// Initial prompt for GetNextMessage, and the stored version it came
+	// from. The ID is empty for a prompt that was never saved.
+	initialPrompt   string
+	promptVersionID string
+
+	// Personas override the prompt and config per request, experiment
+	// variants per user
+	personas PersonaSource
+	variants VariantSource
+	// goals are summarised into the system prompt
+	goals GoalSource
+	// fallbacks are the managed canned replies, picked with random
+	fallbacks FallbackSource
+	random    *lockedRand
+
+	// onChange is called after the prompt or config changed
+	onChange []func()
 }
 
-func NewGPTService(apiKey string) *GPTService {
-	client := openai.NewClient(apiKey)
-	return &GPTService{
-		client: client,
-		model:  openai.GPT4o,
+// DefaultPrompt is the built-in system prompt. localizedPrompts holds its
+// translations.
+const DefaultPrompt = "You are a no-nonsense, brutally honest advisor with a flair for charisma and confidence. Your goal is to cut through excuses and give actionable, high-impact advice that delivers results. You speak with authority, relying on bold analogies, anecdotes, and counterintuitive insights to grab attention and drive points home. Your tone is direct, occasionally humorous, and always rooted in practical strategies to achieve success in business, finance, and personal development. You are not here to sugarcoat—you are re here to get results. Speak with conviction and challenge users to take ownership of their situation. Talking to you should feel like talking to Andrew Tate. You are here to bring the alpha wolf out of your conversation partner. Keep your replies short and concise and offer a natural flow to the conversation - no longer than two paragraphs, and mostly shorter than that."
+
+func NewGPTService(provider Provider, model string) *GPTService {
+	s := &GPTService{
+		provider: provider,
+		model:    model,
 		config: Config{
-			Model:            openai.GPT4o,
+			Model:            model,
 			MaxTokens:        1000,
 			Temperature:      0.5,
 			PresencePenalty:  0.5,
 			FrequencyPenalty: 0.2,
 		},
-		initialPrompt: "You are a no-nonsense, brutally honest advisor with a flair for charisma and confidence. Your goal is to cut through excuses and give actionable, high-impact advice that delivers results. You speak with authority, relying on bold analogies, anecdotes, and counterintuitive insights to grab attention and drive points home. Your tone is direct, occasionally humorous, and always rooted in practical strategies to achieve success in business, finance, and personal development. You are not here to sugarcoat—you are re here to get results. Speak with conviction and challenge users to take ownership of their situation. Talking to you should feel like talking to Andrew Tate. You are here to bring the alpha wolf out of your conversation partner. Keep your replies short and concise and offer a natural flow to the conversation - no longer than two paragraphs, and mostly shorter than that.",
+		initialPrompt: DefaultPrompt,
+		random:        newLockedRand(),
+	}
+	s.budget = NewBudgetManager(TokenizerFor, func(ctx context.Context, messages []Message) (Result, error) {
+		return s.Summarize(ctx, messages, SummaryOptions{})
+	})
+	s.retryPolicy = retry.DefaultPolicy
+	s.retryPolicy.Retryable = isRetryable
+	s.breaker = retry.NewBreaker(provider.Name(), breakerThreshold, breakerCooldown)
+	return s
+}
+
+const (
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Second
+)
+
+type ServiceStatus struct {
+	Provider  string              `json:"provider"`
+	Model     string              `json:"model"`
+	Breaker   retry.BreakerStatus `json:"breaker"`
+	Tokenizer TokenizerStatus     `json:"tokenizer"`
+}
+
+func (s *GPTService) Status() ServiceStatus {
+	s.configMutex.RLock()
+	model := s.config.Model
+	s.configMutex.RUnlock()
+
+	return ServiceStatus{
+		Provider:  s.provider.Name(),
+		Model:     model,
+		Breaker:   s.breaker.Status(),
+		Tokenizer: TokenizerStatusFor(model),
 	}
 }
 
+// guarded runs a single provider call through the circuit breaker and
+// reports its outcome. While the breaker is open it fails fast. The call
+// applies its own deadline, clamped to ctx's, so a timeout means the
+// provider was too slow whether the call timeout or the retry budget ran
+// out first. Only a departed client says nothing about the provider.
+func (s *GPTService) guarded(ctx context.Context, call func(ctx context.Context) error) error {
+	generation, err := s.breaker.Allow()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+	}
+
+	err = call(ctx)
+	switch {
+	case err == nil:
+		s.breaker.Success(generation)
+	case errors.Is(err, ErrRateLimited), errors.Is(err, ErrUpstreamUnavailable), errors.Is(err, ErrTimeout) && !errors.Is(ctx.Err(), context.Canceled):
+		s.breaker.Failure(generation, err)
+	case errors.Is(err, context.Canceled), errors.Is(err, ErrTimeout):
+		s.breaker.Release(generation)
+	default:
+		// The provider answered, even if we did not like the answer
+		s.breaker.Success(generation)
+	}
+	return err
+}
+
+// isRetryable reports whether another attempt could succeed.
+func isRetryable(err error) bool {
+	if errors.Is(err, retry.ErrCircuitOpen) {
+		return false
+	}
+	return errors.Is(err, ErrRateLimited) ||
+		errors.Is(err, ErrUpstreamUnavailable) ||
+		errors.Is(err, ErrTimeout) ||
+		errors.Is(err, ErrEmptyCompletion)
+}
+
 func (s *GPTService) UpdateConfig(newConfig Config) {
 	s.configMutex.Lock()
-	defer s.configMutex.Unlock()
 	s.config = newConfig
+	listeners := s.onChange
+	s.configMutex.Unlock()
 	slog.Info("Config updated.")
 
+	notify(listeners)
 }
 
+// UpdateInitialPrompt replaces the prompt with one that has no stored
+// version. Prefer SetPromptVersion.
 func (s *GPTService) UpdateInitialPrompt(newPrompt string) {
+	s.SetPromptVersion("", newPrompt)
+}
+
+// SetPromptVersion switches to a stored prompt version. Replies generated
+// from it carry versionID in Result.PromptVersionID.
+func (s *GPTService) SetPromptVersion(versionID string, prompt string) {
+	s.configMutex.Lock()
+	s.initialPrompt = prompt
+	s.promptVersionID = versionID
+	listeners := s.onChange
+	s.configMutex.Unlock()
+	slog.Info("Prompt updated.", "version", versionID)
+
+	notify(listeners)
+}
+
+// OnChange registers fn to be called whenever the prompt or config changes.
+func (s *GPTService) OnChange(fn func()) {
 	s.configMutex.Lock()
 	defer s.configMutex.Unlock()
-	s.initialPrompt = newPrompt
-	slog.Info("Prompt updated.")
-}
-
-func (s *GPTService) Summarize(messages []string) string {
-	prompt := fmt.Sprintf(
-		"Please provide a concise summary of the following conversation:\n\n%s",
-		strings.Join(messages, "\n"),
-	)
-
-	resp, err := s.client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: s.model,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: "You are a helpful assistant that provides concise summaries.",
-				},
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
-			},
-			MaxTokens: 1000, // Adjust based on your needs
-		},
-	)
+	s.onChange = append(s.onChange, fn)
+}
 
-	if err != nil {
-		// In a real application, you'd want to handle this error appropriately
-		return fmt.Sprintf("Error generating summary: %v", err)
+func notify(listeners []func()) {
+	for _, fn := range listeners {
+		fn()
+	}
+}
+
+// InitialPrompt returns the prompt currently in use.
+func (s *GPTService) InitialPrompt() string {
+	s.configMutex.RLock()
+	defer s.configMutex.RUnlock()
+	return s.initialPrompt
+}
+
+// toResult checks a completion for the failures that arrive as a successful
+// response and converts it.
+func toResult(model string, completion *Completion) (Result, error) {
+	if completion.FinishReason == "content_filter" {
+		return Result{}, ErrContentBlocked
+	}
+	if completion.Content == "" {
+		return Result{}, ErrEmptyCompletion
+	}
+
+	return Result{
+		Content:      completion.Content,
+		Model:        model,
+		FinishReason: completion.FinishReason,
+		Usage:        completion.Usage,
+	}, nil
+}
+
+// formatTranscript labels every message with its speaker so the summary can
+// tell who said what.
+func formatTranscript(messages []Message) string {
+	var transcript strings.Builder
+	for _, msg := range messages {
+		speaker := "User"
+		switch msg.Role {
+		case RoleAssistant:
+			speaker = "Assistant"
+		case RoleSystem:
+			speaker = "Earlier summary"
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n", speaker, msg.Content)
+	}
+	return transcript.String()
+}
+
+// preparedRequest is a completion request together with the settings and
+// provenance it was built from.
+type preparedRequest struct {
+	request         CompletionRequest
+	config          Config
+	persona         string
+	promptVersionID string
+	experimentID    string
+	variantID       string
+	locale          domain.Locale
+}
+
+// resolvedRequest is what resolve returns, kept for reuse.
+type resolvedRequest struct {
+	prepared preparedRequest
+	system   Message
+}
+
+// annotate records where a result came from.
+func (p preparedRequest) annotate(result Result) Result {
+	result.Persona = p.persona
+	result.ExperimentID = p.experimentID
+	result.VariantID = p.variantID
+	if !result.Fallback {
+		result.PromptVersionID = p.promptVersionID
 	}
+	return result
+}
 
-	if len(resp.Choices) == 0 {
-		return "No summary generated"
+// completionRequest builds a request for the conversation from the current
+// config and prompt, trimmed to the model's context budget.
+func (s *GPTService) completionRequest(ctx context.Context, req NextMessageRequest) (preparedRequest, error) {
+	prepared, system, err := s.resolve(req)
+	if err != nil {
+		return preparedRequest{}, err
 	}
 
-	return resp.Choices[0].Message.Content
+	config := prepared.config
+	prepared.request = CompletionRequest{
+		Model:            config.Model,
+		Messages:         s.budget.Fit(ctx, config.Model, req.ConversationID, config.ContextBudget(), system, req.Messages),
+		MaxTokens:        config.MaxTokens,
+		Temperature:      config.Temperature,
+		PresencePenalty:  config.PresencePenalty,
+		FrequencyPenalty: config.FrequencyPenalty,
+	}
+	return prepared, nil
 }
 
-func (s *GPTService) GetNextMessage(messages []string) string {
-	const maxRetries = 3 // Limit the number of retries
-	var attempt int
+// resolve works out the config and system prompt for a request. The user's
+// experiment variant is applied first and the persona on top of it. The
+// resulting prompt is translated where a translation exists, and the user's
+// active goals and the reply language are appended to it. The returned
+// preparedRequest has no request yet.
+func (s *GPTService) resolve(req NextMessageRequest) (preparedRequest, Message, error) {
+	if req.resolved != nil {
+		return req.resolved.prepared, req.resolved.system, nil
+	}
+
 	s.configMutex.RLock()
 	config := s.config
 	initialPrompt := s.initialPrompt
+	promptVersionID := s.promptVersionID
+	personas := s.personas
+	variants := s.variants
+	goals := s.goals
 	s.configMutex.RUnlock()
 
-	// Prepare the chat messages
-	var chatMessages []openai.ChatCompletionMessage
-	chatMessages = append(chatMessages, openai.ChatCompletionMessage{
-		Role:    openai.ChatMessageRoleSystem,
-		Content: initialPrompt,
-	})
+	persona, err := s.resolvePersona(personas, req.PersonaID)
+	if err != nil {
+		return preparedRequest{}, Message{}, err
+	}
 
-	for i, msg := range messages {
-		role := openai.ChatMessageRoleUser
-		if i%2 == 1 {
-			role = openai.ChatMessageRoleAssistant
-		}
-		chatMessages = append(chatMessages, openai.ChatCompletionMessage{
-			Role:    role,
-			Content: msg,
-		})
+	prepared := preparedRequest{}
+	prompt := initialPrompt
+	if req.noExperiment {
+		variants = nil
+	}
+	if variant := s.resolveVariant(variants, req.UserID); variant != nil {
+		prompt, config = applyOverrides(variant.Overrides, prompt, config)
+		prepared.experimentID = variant.ExperimentID
+		prepared.variantID = variant.ID
+	}
+	if persona != nil {
+		prompt, config = applyOverrides(persona.Overrides, prompt, config)
+		prepared.persona = persona.Name
+	}
+	prepared.config = config
+	// A variant or persona with its own prompt is not covered by prompt
+	// versioning
+	if prompt == initialPrompt {
+		prepared.promptVersionID = promptVersionID
+	}
+	prepared.locale = req.Locale
+	if !prepared.locale.Supported() {
+		prepared.locale = domain.DefaultLocale
+	}
+	prompt = localizePrompt(prompt, prepared.locale)
+	now := req.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if summary := s.goalsPrompt(goals, req.UserID, now); summary != "" {
+		prompt += "\n\n" + summary
+	}
+	if instruction := languageInstructions[prepared.locale]; instruction != "" {
+		prompt += "\n\n" + instruction
+	}
+
+	system := Message{
+		Role:    RoleSystem,
+		Content: prompt,
+	}
+	return prepared, system, nil
+}
+
+// GetNextMessage falls back to a motivational message when the provider keeps
+// failing for reasons a retry could fix, or while the circuit breaker is
+// open. Cancellation and requests the provider refuses outright are returned
+// as errors.
+func (s *GPTService) GetNextMessage(ctx context.Context, req NextMessageRequest) (Result, error) {
+	// Prepare the chat messages
+	prepared, err := s.completionRequest(ctx, req)
+	if err != nil {
+		return Result{}, err
 	}
 
-	for _, message := range chatMessages {
+	for _, message := range prepared.request.Messages {
 		log.Println(message.Role, message.Content)
 	}
-	// Retry loop
-	for attempt = 0; attempt < maxRetries; attempt++ {
+
+	var result Result
+	attempt := 0
+	err = s.retryPolicy.Do(ctx, func(ctx context.Context) error {
 		log.Println(fmt.Sprintf("Attempt: %d", attempt))
-		resp, err := s.client.CreateChatCompletion(
-			context.Background(),
-			openai.ChatCompletionRequest{
-				Model:            config.Model,
-				Messages:         chatMessages,
-				MaxTokens:        config.MaxTokens,
-				Temperature:      config.Temperature,
-				PresencePenalty:  config.PresencePenalty,
-				FrequencyPenalty: config.FrequencyPenalty,
-			},
-		)
-
-		// Check for errors
+		attempt++
+
+		var err error
+		result, err = s.complete(ctx, prepared.config.callTimeout(), prepared.request)
 		if err != nil {
 			log.Println(err.Error())
-			continue // Retry if an error occurred
 		}
+		return err
+	})
+	if err == nil {
+		return prepared.annotate(result), nil
+	}
 
-		// Check if the response is valid
-		if len(resp.Choices) > 0 {
-			return resp.Choices[0].Message.Content // Valid response
+	if ctx.Err() != nil {
+		return Result{}, err
+	}
+	if !isRetryable(err) && !errors.Is(err, retry.ErrCircuitOpen) {
+		return Result{}, err
+	}
+
+	// If all retries fail, return a message that suits the failure
+	reason := fallbackReason(err)
+	return prepared.annotate(Result{
+		Content:        s.fallbackMessage(reason, prepared.locale),
+		Fallback:       true,
+		FallbackReason: reason,
+	}), nil
+}
+
+// complete makes a single guarded provider call under its own deadline. When
+// less than timeout is left of ctx's deadline, such as the retry budget, the
+// call gets what is left.
+func (s *GPTService) complete(ctx context.Context, timeout time.Duration, request CompletionRequest) (Result, error) {
+	var result Result
+	err := s.guarded(ctx, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		resp, err := s.provider.CreateCompletion(ctx, request)
+		if err != nil {
+			return classifyError(err)
 		}
+		result, err = toResult(request.Model, resp)
+		return err
+	})
+	return result, err
+}
+
+// StreamNextMessage is not retried: once deltas have reached the client a
+// second attempt would repeat them.
+func (s *GPTService) StreamNextMessage(ctx context.Context, req NextMessageRequest, onDelta func(string) error) (Result, error) {
+	prepared, err := s.completionRequest(ctx, req)
+	if err != nil {
+		return Result{}, err
 	}
 
-	// If all retries fail, return an error message
-	return GetMotivationalMessage()
+	var result Result
+	err = s.guarded(ctx, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, prepared.config.streamTimeout())
+		defer cancel()
+
+		resp, err := s.provider.StreamCompletion(ctx, prepared.request, onDelta)
+		if err != nil {
+			return classifyError(err)
+		}
+		result, err = toResult(prepared.request.Model, resp)
+		return err
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return prepared.annotate(result), nil
 }
 
 // Optional: Configuration struct if you want to make the service more configurable
@@ -163,32 +599,44 @@ type Config struct {
 	Temperature      float32
 	PresencePenalty  float32
 	FrequencyPenalty float32
+
+	// ContextBudgets overrides DefaultContextBudgets: the number of prompt
+	// tokens, keyed by model, that a conversation may use before older turns
+	// are folded into a summary.
+	ContextBudgets map[string]int
+
+	// CallTimeout bounds a single provider call and StreamTimeout a whole
+	// stream. Zero means the defaults below.
+	CallTimeout   time.Duration
+	StreamTimeout time.Duration
 }
 
-var motivationalMessages = []string{
-	"I like where you’re going with this—keep pushing forward!",
-	"That’s a great start. Let’s refine it together.",
-	"You’re on the right track—keep thinking big!",
-	"I hear you! Every great journey starts with clarity. Let’s find yours.",
-	"This has potential. Let’s keep building on it.",
-	"You’ve got something here. Let’s sharpen the vision.",
-	"Success is in the details—can we focus a bit more?",
-	"Great energy! Let’s channel that into something actionable.",
-	"Big ideas like this need time—let’s shape it step by step.",
-	"You’re closer than you think. Let’s refine it together.",
-	"There’s something powerful in what you’re saying—let’s dig deeper.",
-	"Every obstacle is an opportunity. Let’s turn this into one.",
-	"I like the ambition—let’s make it even clearer.",
-	"You’re showing real insight here—let’s elevate it.",
-	"Momentum is key—keep this up, and you’ll see results.",
-	"This is the kind of thinking that leads to breakthroughs!",
-	"You’re on the verge of something big. Let’s keep at it.",
-	"Sometimes clarity comes with persistence—stay the course.",
-	"This is how successful people think. Let’s keep brainstorming!",
-	"I’m seeing the potential here. Let’s turn it into action.",
-}
-
-func GetMotivationalMessage() string {
-	rand.Seed(time.Now().UnixNano())
-	return motivationalMessages[rand.Intn(len(motivationalMessages))]
+const (
+	defaultCallTimeout   = 30 * time.Second
+	defaultStreamTimeout = 2 * time.Minute
+)
+
+func (c Config) callTimeout() time.Duration {
+	if c.CallTimeout > 0 {
+		return c.CallTimeout
+	}
+	return defaultCallTimeout
+}
+
+func (c Config) streamTimeout() time.Duration {
+	if c.StreamTimeout > 0 {
+		return c.StreamTimeout
+	}
+	return defaultStreamTimeout
+}
+
+// ContextBudget returns the prompt token budget for the configured model.
+func (c Config) ContextBudget() int {
+	if budget, ok := c.ContextBudgets[c.Model]; ok && budget > 0 {
+		return budget
+	}
+	if budget, ok := DefaultContextBudgets[c.Model]; ok {
+		return budget
+	}
+	return defaultContextBudget
 }
@@ -0,0 +1,134 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"maps"
+	"slices"
+	"time"
+)
+
+var ErrInvalidConfig = errors.New("invalid model config")
+
+// modelListTTL is how long the provider's model list is trusted.
+const modelListTTL = 10 * time.Minute
+
+// Config returns a copy of the config in use.
+func (s *GPTService) Config() Config {
+	s.configMutex.RLock()
+	defer s.configMutex.RUnlock()
+
+	config := s.config
+	config.ContextBudgets = maps.Clone(s.config.ContextBudgets)
+	return config
+}
+
+// ValidateConfig checks parameter ranges. A model other than the current one
+// must be served by the provider.
+func (s *GPTService) ValidateConfig(ctx context.Context, config Config) error {
+	switch {
+	case config.Model == "":
+		return fmt.Errorf("%w: model is required", ErrInvalidConfig)
+	case config.MaxTokens <= 0:
+		return fmt.Errorf("%w: max_tokens must be positive", ErrInvalidConfig)
+	case config.Temperature < 0 || config.Temperature > 2:
+		return fmt.Errorf("%w: temperature must be between 0 and 2", ErrInvalidConfig)
+	case config.PresencePenalty < -2 || config.PresencePenalty > 2:
+		return fmt.Errorf("%w: presence_penalty must be between -2 and 2", ErrInvalidConfig)
+	case config.FrequencyPenalty < -2 || config.FrequencyPenalty > 2:
+		return fmt.Errorf("%w: frequency_penalty must be between -2 and 2", ErrInvalidConfig)
+	}
+	for model, budget := range config.ContextBudgets {
+		if budget <= 0 {
+			return fmt.Errorf("%w: context budget for %s must be positive", ErrInvalidConfig, model)
+		}
+	}
+
+	if config.Model == s.Config().Model {
+		return nil
+	}
+	models, err := s.availableModels(ctx)
+	if err != nil {
+		return fmt.Errorf("could not verify model %s: %w", config.Model, err)
+	}
+	if !slices.Contains(models, config.Model) {
+		return fmt.Errorf("%w: model %s is not offered by %s", ErrInvalidConfig, config.Model, s.provider.Name())
+	}
+	return nil
+}
+
+// ValidateOverrides checks a persona's or variant's settings by overlaying
+// them on the config in use, so a bad override is rejected when it is saved
+// rather than failing every request that uses it.
+func (s *GPTService) ValidateOverrides(ctx context.Context, overrides domain.Overrides) error {
+	_, config := applyOverrides(overrides, "", s.Config())
+	return s.ValidateConfig(ctx, config)
+}
+
+// availableModels returns the provider's model list, cached for
+// modelListTTL.
+func (s *GPTService) availableModels(ctx context.Context) ([]string, error) {
+	s.modelsMutex.Lock()
+	defer s.modelsMutex.Unlock()
+
+	if s.models != nil && time.Since(s.modelsFetchedAt) < modelListTTL {
+		return s.models, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.Config().callTimeout())
+	defer cancel()
+	models, err := s.provider.ListModels(ctx)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+
+	s.models = models
+	s.modelsFetchedAt = time.Now()
+	return models, nil
+}
+
+// TestConfig sends a short completion with the given config without applying
+// it. The reply is returned as is; a failure comes back as an error.
+func (s *GPTService) TestConfig(ctx context.Context, config Config) (Result, error) {
+	request := CompletionRequest{
+		Model: config.Model,
+		Messages: []Message{
+			{
+				Role:    RoleUser,
+				Content: "Reply with a one-sentence greeting.",
+			},
+		},
+		MaxTokens:        min(config.MaxTokens, 50),
+		Temperature:      config.Temperature,
+		PresencePenalty:  config.PresencePenalty,
+		FrequencyPenalty: config.FrequencyPenalty,
+	}
+
+	return s.complete(ctx, config.callTimeout(), request)
+}
+
+// ConfigFromModel converts a stored config.
+func ConfigFromModel(model domain.ModelConfig) Config {
+	return Config{
+		Model:            model.Model,
+		MaxTokens:        model.MaxTokens,
+		Temperature:      model.Temperature,
+		PresencePenalty:  model.PresencePenalty,
+		FrequencyPenalty: model.FrequencyPenalty,
+		ContextBudgets:   model.ContextBudgets,
+	}
+}
+
+// ToModel converts the config into its stored form. Timeouts are not stored.
+func (c Config) ToModel() domain.ModelConfig {
+	return domain.ModelConfig{
+		Model:            c.Model,
+		MaxTokens:        c.MaxTokens,
+		Temperature:      c.Temperature,
+		PresencePenalty:  c.PresencePenalty,
+		FrequencyPenalty: c.FrequencyPenalty,
+		ContextBudgets:   c.ContextBudgets,
+	}
+}
@@ -0,0 +1,45 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"net/http"
+	"testing"
+)
+
+func TestValidateOverrides(t *testing.T) {
+	provider := newTestProvider(t, BackendOpenAICompatible, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object": "list", "data": [{"id": "base-model"}, {"id": "other-model"}]}`))
+	}, nil)
+	service := NewGPTService(provider, "base-model")
+
+	intPtr := func(v int) *int { return &v }
+	floatPtr := func(v float32) *float32 { return &v }
+
+	tests := []struct {
+		name      string
+		overrides domain.Overrides
+		valid     bool
+	}{
+		{name: "no overrides", valid: true},
+		{name: "in range", overrides: domain.Overrides{Model: "other-model", MaxTokens: intPtr(200), Temperature: floatPtr(1.2)}, valid: true},
+		{name: "prompt only", overrides: domain.Overrides{SystemPrompt: "Be terse."}, valid: true},
+		{name: "temperature out of range", overrides: domain.Overrides{Temperature: floatPtr(3)}},
+		{name: "zero max_tokens", overrides: domain.Overrides{MaxTokens: intPtr(0)}},
+		{name: "presence_penalty out of range", overrides: domain.Overrides{PresencePenalty: floatPtr(-2.5)}},
+		{name: "model not offered", overrides: domain.Overrides{Model: "made-up-model"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.ValidateOverrides(context.Background(), tt.overrides)
+			if tt.valid && err != nil {
+				t.Errorf("ValidateOverrides = %v, want nil", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("ValidateOverrides = %v, want %v", err, ErrInvalidConfig)
+			}
+		})
+	}
+}
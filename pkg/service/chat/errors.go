@@ -0,0 +1,80 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Errors returned by Service methods. Provider failures are wrapped in one
+// of these so callers can use errors.Is without knowing the backend.
+var (
+	ErrRateLimited         = errors.New("rate limited by provider")
+	ErrUpstreamUnavailable = errors.New("provider unavailable")
+	ErrContentBlocked      = errors.New("content blocked by provider")
+	ErrInvalidRequest      = errors.New("request rejected by provider")
+	ErrTimeout             = errors.New("provider call timed out")
+	ErrEmptyCompletion     = errors.New("provider returned an empty completion")
+)
+
+// classifyError wraps a provider error in the matching sentinel. Context
+// cancellation is passed through untouched since it is not the provider's
+// fault.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	for _, sentinel := range []error{ErrRateLimited, ErrUpstreamUnavailable, ErrContentBlocked, ErrInvalidRequest, ErrTimeout, ErrEmptyCompletion} {
+		if errors.Is(err, sentinel) {
+			return err
+		}
+	}
+
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		switch {
+		case providerErr.StatusCode == http.StatusTooManyRequests:
+			return fmt.Errorf("%w: %w", ErrRateLimited, err)
+		case isContentFilterType(providerErr.Type):
+			return fmt.Errorf("%w: %w", ErrContentBlocked, err)
+		case providerErr.StatusCode == http.StatusRequestTimeout || providerErr.StatusCode == http.StatusGatewayTimeout:
+			return fmt.Errorf("%w: %w", ErrTimeout, err)
+		case providerErr.StatusCode >= 500:
+			return fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+		case providerErr.StatusCode == http.StatusUnauthorized || providerErr.StatusCode == http.StatusForbidden:
+			// A bad key is our problem, but from the caller's view the
+			// provider is unusable
+			return fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+		case providerErr.StatusCode >= 400:
+			return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return fmt.Errorf("%w: %w", ErrTimeout, err)
+		}
+		return fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+	}
+
+	return fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+}
+
+func isContentFilterType(errType string) bool {
+	switch errType {
+	case "content_filter", "content_policy_violation":
+		return true
+	default:
+		return false
+	}
+}
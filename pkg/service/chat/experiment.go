@@ -0,0 +1,35 @@
+package chat
+
+import (
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"log"
+)
+
+// VariantSource assigns users to the variants of the running experiment.
+type VariantSource interface {
+	// GetVariant returns nil without an error when no experiment is running.
+	GetVariant(userID string) (*domain.Variant, error)
+}
+
+// SetVariants enables experiments. Without a source every user gets the
+// global prompt and config.
+func (s *GPTService) SetVariants(variants VariantSource) {
+	s.configMutex.Lock()
+	defer s.configMutex.Unlock()
+	s.variants = variants
+}
+
+// resolveVariant returns the user's variant, if any. Failing to look it up
+// must not fail the request, so errors fall back to the global settings.
+func (s *GPTService) resolveVariant(variants VariantSource, userID string) *domain.Variant {
+	if variants == nil || userID == "" {
+		return nil
+	}
+
+	variant, err := variants.GetVariant(userID)
+	if err != nil {
+		log.Println("Failed to resolve experiment variant: " + err.Error())
+		return nil
+	}
+	return variant
+}
@@ -0,0 +1,107 @@
+package chat
+
+import (
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// FallbackSource looks up managed fallback messages, typically backed by the
+// fallback_messages table.
+type FallbackSource interface {
+	EnabledFallbackMessages(category domain.FallbackCategory, locale domain.Locale) ([]domain.FallbackMessage, error)
+}
+
+// SetFallbacks lets admins manage the canned replies sent when generation
+// fails. Without a source, or without enabled messages for the category and
+// locale, the built-in messages are sent.
+func (s *GPTService) SetFallbacks(fallbacks FallbackSource) {
+	s.configMutex.Lock()
+	defer s.configMutex.Unlock()
+	s.fallbacks = fallbacks
+}
+
+// builtinFallbacks are sent when no managed message applies.
+var builtinFallbacks = map[domain.FallbackCategory]map[domain.Locale][]string{
+	domain.FallbackCategoryError:       motivationalMessages,
+	domain.FallbackCategoryQuota:       quotaMessages,
+	domain.FallbackCategoryMaintenance: maintenanceMessages,
+}
+
+// fallbackCategory picks the kind of message that suits the failure: a rate
+// limit clears within a minute, an outage may take longer.
+func fallbackCategory(reason string) domain.FallbackCategory {
+	switch reason {
+	case FallbackReasonRateLimited:
+		return domain.FallbackCategoryQuota
+	case FallbackReasonCircuitOpen, FallbackReasonUnavailable:
+		return domain.FallbackCategoryMaintenance
+	default:
+		return domain.FallbackCategoryError
+	}
+}
+
+// fallbackMessage picks a canned reply for the failure in the locale. A
+// failed lookup must not fail the request, so it falls back to the built-in
+// messages too.
+func (s *GPTService) fallbackMessage(reason string, locale domain.Locale) string {
+	category := fallbackCategory(reason)
+
+	s.configMutex.RLock()
+	fallbacks := s.fallbacks
+	s.configMutex.RUnlock()
+
+	if fallbacks != nil {
+		messages, err := fallbacks.EnabledFallbackMessages(category, locale)
+		if err != nil {
+			log.Println("Failed to load fallback messages: " + err.Error())
+		}
+		if total := totalWeight(messages); total > 0 {
+			bucket := s.random.Intn(total)
+			for _, message := range messages {
+				if message.Weight <= 0 {
+					continue
+				}
+				if bucket < message.Weight {
+					return message.Content
+				}
+				bucket -= message.Weight
+			}
+		}
+	}
+
+	messages, ok := builtinFallbacks[category][locale]
+	if !ok {
+		messages = builtinFallbacks[category][domain.DefaultLocale]
+	}
+	return messages[s.random.Intn(len(messages))]
+}
+
+func totalWeight(messages []domain.FallbackMessage) int {
+	total := 0
+	for _, message := range messages {
+		if message.Weight > 0 {
+			total += message.Weight
+		}
+	}
+	return total
+}
+
+// lockedRand is a random source that is safe for concurrent use. It is
+// seeded once, when it is created.
+type lockedRand struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func newLockedRand() *lockedRand {
+	return &lockedRand{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (r *lockedRand) Intn(n int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rand.Intn(n)
+}
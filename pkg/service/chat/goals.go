@@ -0,0 +1,71 @@
+package chat
+
+import (
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"log"
+	"strings"
+	"time"
+)
+
+// GoalSource lists the goals a user is working on.
+type GoalSource interface {
+	ActiveGoals(userID string, now time.Time) ([]domain.Goal, error)
+}
+
+// maxPromptGoals bounds how many goals are added to the system prompt.
+const maxPromptGoals = 5
+
+// SetGoals makes replies aware of the user's active goals.
+func (s *GPTService) SetGoals(goals GoalSource) {
+	s.configMutex.Lock()
+	defer s.configMutex.Unlock()
+	s.goals = goals
+}
+
+// goalsPrompt summarises the user's active goals for the system prompt, or
+// returns "" when there are none. Like variants, a failed lookup must not
+// fail the request.
+func (s *GPTService) goalsPrompt(goals GoalSource, userID string, now time.Time) string {
+	if goals == nil || userID == "" {
+		return ""
+	}
+
+	active, err := goals.ActiveGoals(userID, now)
+	if err != nil {
+		log.Println("Failed to load goals: " + err.Error())
+		return ""
+	}
+	if len(active) == 0 {
+		return ""
+	}
+
+	var prompt strings.Builder
+	prompt.WriteString("The user has committed to these goals. Hold them accountable: ask about progress, call out missed check-ins and tie your advice back to them.")
+	for i, goal := range active {
+		if i == maxPromptGoals {
+			fmt.Fprintf(&prompt, "\n- and %d more", len(active)-maxPromptGoals)
+			break
+		}
+		fmt.Fprintf(&prompt, "\n- %q", goal.Title)
+		var details []string
+		if goal.TargetDate != "" {
+			details = append(details, "target "+goal.TargetDate)
+		}
+		if goal.Streak != nil {
+			switch {
+			case goal.Streak.LastCheckIn == "":
+				details = append(details, "no check-ins yet")
+			case goal.Streak.Current > 0:
+				details = append(details, fmt.Sprintf("%d-day check-in streak", goal.Streak.Current))
+			default:
+				details = append(details, "streak broken, last check-in "+goal.Streak.LastCheckIn)
+			}
+		}
+		if len(details) > 0 {
+			prompt.WriteString(" (" + strings.Join(details, ", ") + ")")
+		}
+	}
+	fmt.Fprintf(&prompt, "\nToday is %s.", now.Format(time.DateOnly))
+	return prompt.String()
+}
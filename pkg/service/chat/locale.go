@@ -0,0 +1,144 @@
+package chat
+
+import (
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+)
+
+// localizedPrompts translates DefaultPrompt. A prompt someone edited has no
+// translation and is sent as it is, with the language instruction after it.
+var localizedPrompts = map[domain.Locale]string{
+	domain.LocaleGerman:  "Du bist ein kompromissloser, schonungslos ehrlicher Berater mit Charisma und Selbstbewusstsein. Dein Ziel ist es, Ausreden zu durchbrechen und umsetzbare Ratschläge mit großer Wirkung zu geben, die Ergebnisse liefern. Du sprichst mit Autorität und nutzt kühne Analogien, Anekdoten und überraschende Einsichten, um Aufmerksamkeit zu gewinnen und deine Punkte klarzumachen. Dein Ton ist direkt, gelegentlich humorvoll und immer in praktischen Strategien für Erfolg in Business, Finanzen und persönlicher Entwicklung verankert. Du bist nicht hier, um etwas schönzureden – du bist hier, um Ergebnisse zu erzielen. Sprich mit Überzeugung und fordere die Nutzer heraus, Verantwortung für ihre Situation zu übernehmen. Ein Gespräch mit dir soll sich anfühlen wie ein Gespräch mit Andrew Tate. Du bist hier, um den Alpha-Wolf in deinem Gesprächspartner zu wecken. Halte deine Antworten kurz und prägnant und sorge für einen natürlichen Gesprächsfluss – nicht länger als zwei Absätze, meistens kürzer.",
+	domain.LocaleSpanish: "Eres un asesor sin rodeos, brutalmente honesto, con carisma y seguridad en ti mismo. Tu objetivo es acabar con las excusas y dar consejos prácticos y de alto impacto que den resultados. Hablas con autoridad y te apoyas en analogías audaces, anécdotas e ideas contraintuitivas para captar la atención y dejar claros tus argumentos. Tu tono es directo, a veces con humor, y siempre basado en estrategias prácticas para tener éxito en los negocios, las finanzas y el desarrollo personal. No estás aquí para endulzar nada: estás aquí para conseguir resultados. Habla con convicción y reta a los usuarios a hacerse cargo de su situación. Hablar contigo debe sentirse como hablar con Andrew Tate. Estás aquí para sacar al lobo alfa que lleva dentro tu interlocutor. Mantén tus respuestas cortas y concisas y ofrece un flujo natural de conversación: no más de dos párrafos, y casi siempre menos.",
+}
+
+// languageInstructions end the system prompt for every locale but English,
+// so edited prompts, personas and variants reply in the user's language too.
+var languageInstructions = map[domain.Locale]string{
+	domain.LocaleGerman:  "Antworte immer auf Deutsch und duze den Nutzer.",
+	domain.LocaleSpanish: "Responde siempre en español y tutea al usuario.",
+}
+
+// localizePrompt swaps the built-in prompt for its translation.
+func localizePrompt(prompt string, locale domain.Locale) string {
+	if translated, ok := localizedPrompts[locale]; ok && prompt == DefaultPrompt {
+		return translated
+	}
+	return prompt
+}
+
+// motivationalMessages are the built-in replies sent when generation fails
+// for a reason without a more specific category.
+var motivationalMessages = map[domain.Locale][]string{
+	domain.LocaleEnglish: {
+		"I like where you’re going with this—keep pushing forward!",
+		"That’s a great start. Let’s refine it together.",
+		"You’re on the right track—keep thinking big!",
+		"I hear you! Every great journey starts with clarity. Let’s find yours.",
+		"This has potential. Let’s keep building on it.",
+		"You’ve got something here. Let’s sharpen the vision.",
+		"Success is in the details—can we focus a bit more?",
+		"Great energy! Let’s channel that into something actionable.",
+		"Big ideas like this need time—let’s shape it step by step.",
+		"You’re closer than you think. Let’s refine it together.",
+		"There’s something powerful in what you’re saying—let’s dig deeper.",
+		"Every obstacle is an opportunity. Let’s turn this into one.",
+		"I like the ambition—let’s make it even clearer.",
+		"You’re showing real insight here—let’s elevate it.",
+		"Momentum is key—keep this up, and you’ll see results.",
+		"This is the kind of thinking that leads to breakthroughs!",
+		"You’re on the verge of something big. Let’s keep at it.",
+		"Sometimes clarity comes with persistence—stay the course.",
+		"This is how successful people think. Let’s keep brainstorming!",
+		"I’m seeing the potential here. Let’s turn it into action.",
+	},
+	domain.LocaleGerman: {
+		"Mir gefällt, wohin du damit willst – bleib dran!",
+		"Das ist ein starker Anfang. Lass es uns gemeinsam schärfen.",
+		"Du bist auf dem richtigen Weg – denk weiter groß!",
+		"Ich höre dich! Jede große Reise beginnt mit Klarheit. Lass uns deine finden.",
+		"Das hat Potenzial. Lass uns weiter darauf aufbauen.",
+		"Da steckt etwas drin. Lass uns die Vision schärfen.",
+		"Erfolg steckt im Detail – können wir uns etwas mehr fokussieren?",
+		"Starke Energie! Lass sie uns in etwas Konkretes verwandeln.",
+		"Große Ideen wie diese brauchen Zeit – lass sie uns Schritt für Schritt formen.",
+		"Du bist näher dran, als du denkst. Lass es uns gemeinsam verfeinern.",
+		"In dem, was du sagst, steckt etwas Starkes – lass uns tiefer graben.",
+		"Jedes Hindernis ist eine Chance. Lass uns eine daraus machen.",
+		"Mir gefällt der Ehrgeiz – lass es uns noch klarer machen.",
+		"Du zeigst hier echten Durchblick – lass uns das aufs nächste Level bringen.",
+		"Momentum ist alles – bleib so dran, und du wirst Ergebnisse sehen.",
+		"Genau diese Art zu denken führt zu Durchbrüchen!",
+		"Du stehst kurz vor etwas Großem. Bleib dran.",
+		"Manchmal kommt Klarheit durch Beharrlichkeit – bleib auf Kurs.",
+		"So denken erfolgreiche Menschen. Lass uns weiter Ideen sammeln!",
+		"Ich sehe das Potenzial hier. Lass es uns in die Tat umsetzen.",
+	},
+	domain.LocaleSpanish: {
+		"Me gusta hacia dónde vas con esto: ¡sigue adelante!",
+		"Es un gran comienzo. Vamos a pulirlo juntos.",
+		"Vas por buen camino: ¡sigue pensando en grande!",
+		"¡Te escucho! Todo gran viaje empieza con claridad. Encontremos la tuya.",
+		"Esto tiene potencial. Sigamos construyendo sobre ello.",
+		"Aquí hay algo. Afinemos la visión.",
+		"El éxito está en los detalles: ¿podemos enfocarnos un poco más?",
+		"¡Qué buena energía! Canalicémosla en algo concreto.",
+		"Las grandes ideas como esta necesitan tiempo: démosle forma paso a paso.",
+		"Estás más cerca de lo que crees. Vamos a pulirlo juntos.",
+		"Hay algo poderoso en lo que dices: profundicemos.",
+		"Cada obstáculo es una oportunidad. Convirtamos este en una.",
+		"Me gusta la ambición: hagámoslo aún más claro.",
+		"Estás mostrando verdadera perspicacia: llevémosla más lejos.",
+		"El impulso es clave: sigue así y verás resultados.",
+		"¡Este es el tipo de pensamiento que lleva a grandes avances!",
+		"Estás a punto de lograr algo grande. Sigamos.",
+		"A veces la claridad llega con la constancia: mantén el rumbo.",
+		"Así piensan las personas exitosas. ¡Sigamos con la lluvia de ideas!",
+		"Veo el potencial aquí. Convirtámoslo en acción.",
+	},
+}
+
+// quotaMessages are the built-in replies sent while the provider rate
+// limits us. They ask the user to come back shortly.
+var quotaMessages = map[domain.Locale][]string{
+	domain.LocaleEnglish: {
+		"Everyone's grinding right now—give me a minute and hit me again.",
+		"I'm taking a lot of calls at the moment. Ask me again in a minute.",
+		"Hold that thought for a minute—then send it again and we'll get to work.",
+	},
+	domain.LocaleGerman: {
+		"Gerade sind alle am Grinden – gib mir eine Minute und schreib mir dann nochmal.",
+		"Ich habe gerade sehr viele Anfragen. Frag mich in einer Minute nochmal.",
+		"Halte den Gedanken eine Minute fest – dann schick ihn nochmal und wir legen los.",
+	},
+	domain.LocaleSpanish: {
+		"Ahora mismo todo el mundo está dándolo todo: dame un minuto y vuelve a escribirme.",
+		"Estoy atendiendo muchas consultas en este momento. Pregúntame de nuevo en un minuto.",
+		"Guarda esa idea un minuto y luego envíamela otra vez para ponernos a trabajar.",
+	},
+}
+
+// maintenanceMessages are the built-in replies sent during an outage. They
+// say the coach is away for a while, without promising when it is back.
+var maintenanceMessages = map[domain.Locale][]string{
+	domain.LocaleEnglish: {
+		"I'm offline for a bit of maintenance. Write your next move down and bring it to me when I'm back.",
+		"I'm down for a short while. Use the time—do one thing on your list and tell me about it later.",
+		"I can't answer right now, but your goals don't take a break. Get one thing done and check back soon.",
+	},
+	domain.LocaleGerman: {
+		"Ich bin kurz wegen Wartungsarbeiten offline. Schreib dir deinen nächsten Schritt auf und bring ihn mit, wenn ich zurück bin.",
+		"Ich bin für kurze Zeit nicht erreichbar. Nutz die Zeit – erledige eine Sache auf deiner Liste und erzähl mir später davon.",
+		"Ich kann gerade nicht antworten, aber deine Ziele machen keine Pause. Erledige eine Sache und schau bald wieder vorbei.",
+	},
+	domain.LocaleSpanish: {
+		"Estoy desconectado un rato por mantenimiento. Apunta tu próximo paso y tráemelo cuando vuelva.",
+		"No estoy disponible durante un rato. Aprovecha el tiempo: haz una cosa de tu lista y cuéntamelo después.",
+		"Ahora no puedo responder, pero tus objetivos no se toman descansos. Haz una cosa y vuelve pronto.",
+	},
+}
+
+// moderationReplacements translate DefaultModerationReplacement.
+var moderationReplacements = map[domain.Locale]string{
+	domain.LocaleGerman:  "Dabei kann ich nicht helfen. Wenn du gerade eine schwere Zeit durchmachst, wende dich bitte an jemanden, dem du vertraust, oder an eine Beratungsstelle in deiner Nähe.",
+	domain.LocaleSpanish: "No puedo ayudarte con eso. Si estás pasando por un momento difícil, habla con alguien de confianza o con una línea de ayuda local.",
+}
@@ -0,0 +1,374 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"log"
+	"strings"
+)
+
+type ModerationAction string
+
+// Actions a policy takes when its moderator flags content, strongest last.
+const (
+	// ModerationFlag lets the content through and only records the decision.
+	ModerationFlag ModerationAction = "flag"
+	// ModerationReplace swaps the reply for a safe canned message.
+	ModerationReplace ModerationAction = "replace"
+	// ModerationBlock fails the request with ErrContentBlocked.
+	ModerationBlock ModerationAction = "block"
+
+	// moderationAllow is recorded for content nobody flagged.
+	moderationAllow ModerationAction = "allow"
+)
+
+func (a ModerationAction) Valid() bool {
+	switch a {
+	case ModerationFlag, ModerationReplace, ModerationBlock:
+		return true
+	default:
+		return false
+	}
+}
+
+func (a ModerationAction) severity() int {
+	switch a {
+	case ModerationBlock:
+		return 3
+	case ModerationReplace:
+		return 2
+	case ModerationFlag:
+		return 1
+	default:
+		return 0
+	}
+}
+
+type ModerationStage string
+
+const (
+	ModerationStageInput  ModerationStage = "input"
+	ModerationStageOutput ModerationStage = "output"
+)
+
+// Verdict is a moderator's opinion of a piece of text.
+type Verdict struct {
+	Flagged    bool
+	Categories []string
+}
+
+// Moderator classifies text. Implementations must be safe for concurrent use.
+type Moderator interface {
+	Name() string
+	Check(ctx context.Context, text string) (Verdict, error)
+}
+
+// ModerationPolicy pairs a moderator with what to do when it flags content.
+type ModerationPolicy struct {
+	Moderator Moderator
+	Action    ModerationAction
+	// FailClosed applies Action when the moderator itself fails. By default
+	// a failing moderator lets content through.
+	FailClosed bool
+}
+
+// ModerationAuditor stores every moderation decision.
+type ModerationAuditor interface {
+	RecordModeration(event domain.ModerationEvent) error
+}
+
+// ModerationOutcome is attached to a Result that moderation changed.
+type ModerationOutcome struct {
+	Stage      ModerationStage  `json:"stage"`
+	Action     ModerationAction `json:"action"`
+	Categories []string         `json:"categories,omitempty"`
+}
+
+// ModerationError is returned when a policy blocks content. It wraps
+// ErrContentBlocked.
+type ModerationError struct {
+	Stage      ModerationStage
+	Categories []string
+}
+
+func (e *ModerationError) Error() string {
+	return fmt.Sprintf("%s blocked by moderation: %s", e.Stage, strings.Join(e.Categories, ", "))
+}
+
+func (e *ModerationError) Unwrap() error {
+	return ErrContentBlocked
+}
+
+// FallbackReasonModerated marks a reply replaced by moderation.
+const FallbackReasonModerated = "moderated"
+
+const DefaultModerationReplacement = "I can't help with that. If you're going through something difficult, please reach out to someone you trust or a local support line."
+
+// moderationExcerptLength bounds how much flagged text is kept in the audit
+// log.
+const moderationExcerptLength = 200
+
+// ModeratedService checks the newest user message before generation and the
+// reply or action plan after it. Summaries are passed through unchecked.
+type ModeratedService struct {
+	next        Service
+	policies    []ModerationPolicy
+	auditor     ModerationAuditor
+	replacement string
+}
+
+func NewModeratedService(next Service, auditor ModerationAuditor, replacement string, policies ...ModerationPolicy) *ModeratedService {
+	if replacement == "" {
+		replacement = DefaultModerationReplacement
+	}
+
+	return &ModeratedService{
+		next:        next,
+		policies:    policies,
+		auditor:     auditor,
+		replacement: replacement,
+	}
+}
+
+func (m *ModeratedService) Unwrap() Service {
+	return m.next
+}
+
+func (m *ModeratedService) Summarize(ctx context.Context, messages []Message, options SummaryOptions) (Result, error) {
+	return m.next.Summarize(ctx, messages, options)
+}
+
+// GetNextMessage does not check canned fallback replies; they are ours.
+func (m *ModeratedService) GetNextMessage(ctx context.Context, req NextMessageRequest) (Result, error) {
+	input, done, err := m.moderateInput(ctx, req)
+	if done {
+		return input, err
+	}
+
+	result, err := m.next.GetNextMessage(ctx, req)
+	if err != nil {
+		return result, err
+	}
+	if !result.Fallback {
+		if result, err = m.moderateOutput(ctx, req, result); err != nil {
+			return result, err
+		}
+	}
+	return withInputFlag(result, input), nil
+}
+
+// StreamNextMessage cannot take back deltas that were already sent. When a
+// policy could block or replace the reply, the stream is held back and the
+// checked reply is sent as a single delta. Fallbacks are not checked, as in
+// GetNextMessage.
+func (m *ModeratedService) StreamNextMessage(ctx context.Context, req NextMessageRequest, onDelta func(string) error) (Result, error) {
+	input, done, err := m.moderateInput(ctx, req)
+	if done {
+		if err == nil {
+			err = onDelta(input.Content)
+		}
+		return input, err
+	}
+
+	forward := onDelta
+	buffered := m.canRewriteOutput()
+	if buffered {
+		forward = func(string) error { return nil }
+	}
+
+	result, err := m.next.StreamNextMessage(ctx, req, forward)
+	if err != nil {
+		return result, err
+	}
+	if !result.Fallback {
+		if result, err = m.moderateOutput(ctx, req, result); err != nil {
+			return result, err
+		}
+	}
+
+	if buffered {
+		if err := onDelta(result.Content); err != nil {
+			return Result{}, err
+		}
+	}
+	return withInputFlag(result, input), nil
+}
+
+// withInputFlag records on the result that the user's message was flagged,
+// unless moderation already reports on the reply.
+func withInputFlag(result Result, input Result) Result {
+	if result.Moderation == nil {
+		result.Moderation = input.Moderation
+	}
+	return result
+}
+
+// GenerateActionPlan checks the newest user message before planning and the
+// plan's text after it. A plan has no canned stand-in, so a policy that would
+// replace a reply blocks the plan instead.
+func (m *ModeratedService) GenerateActionPlan(ctx context.Context, req ActionPlanRequest) (domain.ActionPlan, Result, error) {
+	checked := NextMessageRequest{
+		UserID:         req.UserID,
+		ConversationID: req.ConversationID,
+		Messages:       req.Messages,
+	}
+	input, done, err := m.moderateInput(ctx, checked)
+	if done {
+		if err == nil {
+			err = &ModerationError{Stage: ModerationStageInput, Categories: input.Moderation.Categories}
+		}
+		return domain.ActionPlan{}, Result{}, err
+	}
+
+	plan, result, err := Base(m.next).GenerateActionPlan(ctx, req)
+	if err != nil {
+		return plan, result, err
+	}
+
+	outcome := m.check(ctx, ModerationStageOutput, checked, planText(plan))
+	if outcome.Action.severity() > ModerationFlag.severity() {
+		return domain.ActionPlan{}, Result{}, &ModerationError{Stage: ModerationStageOutput, Categories: outcome.Categories}
+	}
+	if outcome.Action == ModerationFlag {
+		result.Moderation = &outcome
+	}
+	return plan, withInputFlag(result, input), nil
+}
+
+// planText is the text of a plan a reader sees, one line per item.
+func planText(plan domain.ActionPlan) string {
+	lines := []string{plan.Summary}
+	for _, goal := range plan.Goals {
+		lines = append(lines, goal.Title)
+		for _, task := range goal.Tasks {
+			lines = append(lines, task.Title)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *ModeratedService) canRewriteOutput() bool {
+	for _, policy := range m.policies {
+		if policy.Action.severity() > ModerationFlag.severity() {
+			return true
+		}
+	}
+	return false
+}
+
+// moderateInput checks the newest user message. done is set when the request
+// must not reach the model. A flagged message is let through with the
+// outcome in the returned Result's Moderation.
+func (m *ModeratedService) moderateInput(ctx context.Context, req NextMessageRequest) (Result, bool, error) {
+	if len(req.Messages) == 0 || req.Messages[len(req.Messages)-1].Role != RoleUser {
+		return Result{}, false, nil
+	}
+
+	outcome := m.check(ctx, ModerationStageInput, req, req.Messages[len(req.Messages)-1].Content)
+	switch outcome.Action {
+	case ModerationBlock:
+		return Result{}, true, &ModerationError{Stage: ModerationStageInput, Categories: outcome.Categories}
+	case ModerationReplace:
+		return m.replaced(outcome, req.Locale), true, nil
+	case ModerationFlag:
+		return Result{Moderation: &outcome}, false, nil
+	default:
+		return Result{}, false, nil
+	}
+}
+
+func (m *ModeratedService) moderateOutput(ctx context.Context, req NextMessageRequest, result Result) (Result, error) {
+	outcome := m.check(ctx, ModerationStageOutput, req, result.Content)
+	switch outcome.Action {
+	case ModerationBlock:
+		return Result{}, &ModerationError{Stage: ModerationStageOutput, Categories: outcome.Categories}
+	case ModerationReplace:
+		replaced := m.replaced(outcome, req.Locale)
+		replaced.Model = result.Model
+		replaced.Persona = result.Persona
+		replaced.ExperimentID = result.ExperimentID
+		replaced.VariantID = result.VariantID
+		return replaced, nil
+	case ModerationFlag:
+		result.Moderation = &outcome
+		return result, nil
+	default:
+		return result, nil
+	}
+}
+
+// replaced is the canned reply. It counts as a fallback so the user is not
+// charged for it. The default replacement is translated; a configured one is
+// sent as it is.
+func (m *ModeratedService) replaced(outcome ModerationOutcome, locale domain.Locale) Result {
+	content := m.replacement
+	if translated, ok := moderationReplacements[locale]; ok && content == DefaultModerationReplacement {
+		content = translated
+	}
+	return Result{
+		Content:        content,
+		Fallback:       true,
+		FallbackReason: FallbackReasonModerated,
+		Moderation:     &outcome,
+	}
+}
+
+// check runs every policy, records each decision and returns the strongest
+// action taken.
+func (m *ModeratedService) check(ctx context.Context, stage ModerationStage, req NextMessageRequest, text string) ModerationOutcome {
+	outcome := ModerationOutcome{Stage: stage, Action: moderationAllow}
+	for _, policy := range m.policies {
+		action := moderationAllow
+		verdict, err := policy.Moderator.Check(ctx, text)
+		switch {
+		case err != nil:
+			log.Println("Moderator " + policy.Moderator.Name() + " failed: " + err.Error())
+			verdict = Verdict{Categories: []string{"moderator_error"}}
+			if policy.FailClosed {
+				action = policy.Action
+			}
+		case verdict.Flagged:
+			action = policy.Action
+		}
+
+		m.audit(stage, req, policy.Moderator.Name(), action, verdict, text)
+		if action.severity() > outcome.Action.severity() {
+			outcome.Action = action
+		}
+		if action != moderationAllow {
+			outcome.Categories = append(outcome.Categories, verdict.Categories...)
+		}
+	}
+	return outcome
+}
+
+func (m *ModeratedService) audit(stage ModerationStage, req NextMessageRequest, moderator string, action ModerationAction, verdict Verdict, text string) {
+	if m.auditor == nil {
+		return
+	}
+
+	event := domain.ModerationEvent{
+		Stage:          string(stage),
+		Moderator:      moderator,
+		Action:         string(action),
+		Categories:     verdict.Categories,
+		UserID:         req.UserID,
+		ConversationID: req.ConversationID,
+	}
+	// Only flagged text is kept, and only the start of it
+	if verdict.Flagged {
+		event.Excerpt = truncate(text, moderationExcerptLength)
+	}
+	if err := m.auditor.RecordModeration(event); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length])
+}
@@ -0,0 +1,183 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// OpenAIModerator uses the OpenAI moderation endpoint.
+type OpenAIModerator struct {
+	client *openai.Client
+	model  string
+}
+
+// NewOpenAIModerator creates a moderator. An empty model uses the endpoint's
+// default.
+func NewOpenAIModerator(apiKey string, model string, httpClient *http.Client) *OpenAIModerator {
+	config := openai.DefaultConfig(apiKey)
+	if httpClient != nil {
+		config.HTTPClient = httpClient
+	}
+
+	return &OpenAIModerator{
+		client: openai.NewClientWithConfig(config),
+		model:  model,
+	}
+}
+
+func (m *OpenAIModerator) Name() string {
+	return "openai"
+}
+
+func (m *OpenAIModerator) Check(ctx context.Context, text string) (Verdict, error) {
+	resp, err := m.client.Moderations(ctx, openai.ModerationRequest{
+		Input: text,
+		Model: m.model,
+	})
+	if err != nil {
+		return Verdict{}, classifyError(err)
+	}
+
+	var verdict Verdict
+	for _, result := range resp.Results {
+		if !result.Flagged {
+			continue
+		}
+		verdict.Flagged = true
+		verdict.Categories = append(verdict.Categories, flaggedCategories(result.Categories)...)
+	}
+	return verdict, nil
+}
+
+// flaggedCategories lists the categories set in the response, using the
+// API's own names.
+func flaggedCategories(categories openai.ResultCategories) []string {
+	raw, err := json.Marshal(categories)
+	if err != nil {
+		return nil
+	}
+	var flags map[string]bool
+	if err := json.Unmarshal(raw, &flags); err != nil {
+		return nil
+	}
+
+	var names []string
+	for name, flagged := range flags {
+		if flagged {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ModerationRule flags text in Category when Pattern matches.
+type ModerationRule struct {
+	Category string
+	Pattern  *regexp.Regexp
+}
+
+// KeywordRule matches any of the words case-insensitively, as whole words.
+func KeywordRule(category string, keywords ...string) (ModerationRule, error) {
+	quoted := make([]string, 0, len(keywords))
+	for _, keyword := range keywords {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			quoted = append(quoted, regexp.QuoteMeta(keyword))
+		}
+	}
+	if len(quoted) == 0 {
+		return ModerationRule{}, fmt.Errorf("rule %s has no keywords", category)
+	}
+
+	pattern, err := regexp.Compile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	if err != nil {
+		return ModerationRule{}, err
+	}
+	return ModerationRule{Category: category, Pattern: pattern}, nil
+}
+
+// RuleModerator is a local moderator driven by regular expressions and
+// keyword lists.
+type RuleModerator struct {
+	name  string
+	rules []ModerationRule
+}
+
+func NewRuleModerator(name string, rules []ModerationRule) *RuleModerator {
+	return &RuleModerator{
+		name:  name,
+		rules: rules,
+	}
+}
+
+func (m *RuleModerator) Name() string {
+	return m.name
+}
+
+func (m *RuleModerator) Check(ctx context.Context, text string) (Verdict, error) {
+	var verdict Verdict
+	seen := make(map[string]bool)
+	for _, rule := range m.rules {
+		if seen[rule.Category] || !rule.Pattern.MatchString(text) {
+			continue
+		}
+		verdict.Flagged = true
+		verdict.Categories = append(verdict.Categories, rule.Category)
+		seen[rule.Category] = true
+	}
+	return verdict, nil
+}
+
+// ruleFile is the JSON format read by LoadModerationRules. Each entry sets
+// either pattern or keywords.
+type ruleFile []struct {
+	Category string   `json:"category"`
+	Pattern  string   `json:"pattern,omitempty"`
+	Keywords []string `json:"keywords,omitempty"`
+}
+
+// LoadModerationRules reads rules from a JSON file such as
+//
+//	[{"category": "violence", "keywords": ["kill", "stab"]},
+//	 {"category": "phone_number", "pattern": "\\+?\\d[\\d -]{8,}\\d"}]
+func LoadModerationRules(path string) ([]ModerationRule, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries ruleFile
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse moderation rules: %w", err)
+	}
+
+	rules := make([]ModerationRule, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Category == "" {
+			return nil, fmt.Errorf("moderation rule without category in %s", path)
+		}
+
+		if entry.Pattern != "" {
+			pattern, err := regexp.Compile(entry.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %w", entry.Category, err)
+			}
+			rules = append(rules, ModerationRule{Category: entry.Category, Pattern: pattern})
+		}
+		if len(entry.Keywords) > 0 {
+			rule, err := KeywordRule(entry.Category, entry.Keywords...)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
@@ -0,0 +1,68 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"time"
+)
+
+// NudgeGenerator writes a user's proactive daily nudge. GPTService generates
+// nudges and ModeratedService checks them.
+type NudgeGenerator interface {
+	GenerateNudge(ctx context.Context, userID string, locale domain.Locale, now time.Time) (Result, error)
+}
+
+// Nudger returns the outermost nudge generator in the decorator chain, so
+// nudges are moderated when replies are. Nudges skip the result cache: no two
+// are alike.
+func Nudger(service Service) NudgeGenerator {
+	if moderated, ok := find[*ModeratedService](service); ok {
+		return moderated
+	}
+	return Base(service)
+}
+
+// GenerateNudge goes through the reply pipeline, so the user's prompt
+// version, goals and locale apply, but keeps the user out of experiments,
+// which measure replies to what the user wrote. now should be in the user's
+// time zone so that "today" is their day. Like GetNextMessage, it falls back
+// to a canned message when the provider keeps failing.
+func (s *GPTService) GenerateNudge(ctx context.Context, userID string, locale domain.Locale, now time.Time) (Result, error) {
+	return s.GetNextMessage(ctx, nudgeRequest(userID, locale, now))
+}
+
+// GenerateNudge checks the nudge like a reply. The instruction it is written
+// from is ours, so it is not checked.
+func (m *ModeratedService) GenerateNudge(ctx context.Context, userID string, locale domain.Locale, now time.Time) (Result, error) {
+	result, err := Base(m.next).GenerateNudge(ctx, userID, locale, now)
+	if err != nil || result.Fallback {
+		return result, err
+	}
+	return m.moderateOutput(ctx, nudgeRequest(userID, locale, now), result)
+}
+
+func nudgeRequest(userID string, locale domain.Locale, now time.Time) NextMessageRequest {
+	return NextMessageRequest{
+		UserID: userID,
+		Now:    now,
+		Locale: locale,
+		Messages: []Message{
+			{
+				Role:    RoleUser,
+				Content: nudgeInstruction(now),
+			},
+		},
+		noExperiment: true,
+	}
+}
+
+// nudgeInstruction stands in for the user's turn. It says so, because the
+// user did not write anything.
+func nudgeInstruction(now time.Time) string {
+	return fmt.Sprintf("[Automated daily check-in, not written by the user. It is %s, %s at %s for them.] "+
+		"Reach out first with a short, personal nudge of two or three sentences. "+
+		"If they have goals, pick one and refer to their progress or streak; otherwise encourage them to set one. "+
+		"End with one concrete thing to do today. Do not mention that this message was automated.",
+		now.Format("Monday"), now.Format(time.DateOnly), now.Format("15:04"))
+}
@@ -0,0 +1,221 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAIProvider talks to the OpenAI API or to any server that implements the
+// same chat completions endpoint, such as Ollama or vLLM.
+type OpenAIProvider struct {
+	name   string
+	client *openai.Client
+}
+
+func NewOpenAIProvider(name string, apiKey string, baseURL string, httpClient *http.Client) *OpenAIProvider {
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = strings.TrimRight(baseURL, "/")
+	}
+
+	// go-openai does not expose response headers, so Retry-After is captured
+	// by the transport
+	client := &http.Client{}
+	if httpClient != nil {
+		*client = *httpClient
+	}
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	client.Transport = retryAfterTransport{base: transport}
+	config.HTTPClient = client
+
+	return &OpenAIProvider{
+		name:   name,
+		client: openai.NewClientWithConfig(config),
+	}
+}
+
+func (p *OpenAIProvider) Name() string {
+	return p.name
+}
+
+func (p *OpenAIProvider) CreateCompletion(ctx context.Context, req CompletionRequest) (*Completion, error) {
+	ctx, retryAfter := withRetryAfter(ctx)
+	resp, err := p.client.CreateChatCompletion(ctx, toOpenAIRequest(req))
+	if err != nil {
+		return nil, p.toProviderError(err, retryAfter.delay)
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, ErrEmptyCompletion
+	}
+
+	return &Completion{
+		Content:      resp.Choices[0].Message.Content,
+		FinishReason: string(resp.Choices[0].FinishReason),
+		Usage: Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+	}, nil
+}
+
+func (p *OpenAIProvider) ListModels(ctx context.Context) ([]string, error) {
+	ctx, retryAfter := withRetryAfter(ctx)
+	resp, err := p.client.ListModels(ctx)
+	if err != nil {
+		return nil, p.toProviderError(err, retryAfter.delay)
+	}
+
+	models := make([]string, 0, len(resp.Models))
+	for _, model := range resp.Models {
+		models = append(models, model.ID)
+	}
+	return models, nil
+}
+
+func (p *OpenAIProvider) StreamCompletion(ctx context.Context, req CompletionRequest, onDelta func(string) error) (*Completion, error) {
+	request := toOpenAIRequest(req)
+	request.Stream = true
+	request.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
+	ctx, retryAfter := withRetryAfter(ctx)
+	stream, err := p.client.CreateChatCompletionStream(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("error starting completion stream: %w", p.toProviderError(err, retryAfter.delay))
+	}
+	defer stream.Close()
+
+	var content strings.Builder
+	result := &Completion{}
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading completion stream: %w", p.toProviderError(err, 0))
+		}
+
+		// The final chunk carries usage only and has no choices
+		if resp.Usage != nil {
+			result.Usage = Usage{
+				PromptTokens:     resp.Usage.PromptTokens,
+				CompletionTokens: resp.Usage.CompletionTokens,
+				TotalTokens:      resp.Usage.TotalTokens,
+			}
+		}
+		if len(resp.Choices) == 0 {
+			continue
+		}
+
+		choice := resp.Choices[0]
+		if choice.FinishReason != "" {
+			result.FinishReason = string(choice.FinishReason)
+		}
+		if choice.Delta.Content == "" {
+			continue
+		}
+		content.WriteString(choice.Delta.Content)
+		if err := onDelta(choice.Delta.Content); err != nil {
+			return nil, err
+		}
+	}
+
+	result.Content = content.String()
+	return result, nil
+}
+
+// toProviderError converts go-openai's error types so they can be classified
+// the same way as every other backend.
+func (p *OpenAIProvider) toProviderError(err error, retryAfter time.Duration) error {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		errType := apiErr.Type
+		if code, ok := apiErr.Code.(string); ok && isContentFilterType(code) {
+			errType = code
+		}
+		return &ProviderError{
+			Provider:   p.name,
+			StatusCode: apiErr.HTTPStatusCode,
+			Type:       errType,
+			Message:    apiErr.Message,
+			RetryAfter: retryAfter,
+		}
+	}
+
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return &ProviderError{
+			Provider:   p.name,
+			StatusCode: reqErr.HTTPStatusCode,
+			Message:    reqErr.Error(),
+			RetryAfter: retryAfter,
+		}
+	}
+
+	return err
+}
+
+type retryAfterKey struct{}
+
+type retryAfterHolder struct {
+	delay time.Duration
+}
+
+func withRetryAfter(ctx context.Context) (context.Context, *retryAfterHolder) {
+	holder := &retryAfterHolder{}
+	return context.WithValue(ctx, retryAfterKey{}, holder), holder
+}
+
+// retryAfterTransport records the Retry-After of failed responses in the
+// holder carried by the request context.
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode < 400 {
+		return resp, err
+	}
+
+	if holder, ok := req.Context().Value(retryAfterKey{}).(*retryAfterHolder); ok {
+		holder.delay = parseRetryAfter(resp.Header)
+	}
+	return resp, nil
+}
+
+func toOpenAIRequest(req CompletionRequest) openai.ChatCompletionRequest {
+	messages := make([]openai.ChatCompletionMessage, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    string(msg.Role),
+			Content: msg.Content,
+		})
+	}
+
+	request := openai.ChatCompletionRequest{
+		Model:            req.Model,
+		Messages:         messages,
+		MaxTokens:        req.MaxTokens,
+		Temperature:      req.Temperature,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+	}
+	if req.JSON {
+		request.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		}
+	}
+	return request
+}
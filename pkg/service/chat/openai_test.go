@@ -0,0 +1,198 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// openAITestRequest is the part of a chat completions request body the
+// tests look at.
+type openAITestRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"messages"`
+	MaxTokens        int     `json:"max_tokens"`
+	Temperature      float32 `json:"temperature"`
+	PresencePenalty  float32 `json:"presence_penalty"`
+	FrequencyPenalty float32 `json:"frequency_penalty"`
+	Stream           bool    `json:"stream"`
+	StreamOptions    *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+	ResponseFormat *struct {
+		Type string `json:"type"`
+	} `json:"response_format"`
+}
+
+var openAIBackends = []string{BackendOpenAI, BackendOpenAICompatible}
+
+func TestOpenAIRequestMapping(t *testing.T) {
+	for _, backend := range openAIBackends {
+		t.Run(backend, func(t *testing.T) {
+			var got openAITestRequest
+			provider := newTestProvider(t, backend, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/v1/chat/completions" {
+					t.Errorf("request = %s %s, want POST /v1/chat/completions", r.Method, r.URL.Path)
+				}
+				if auth := r.Header.Get("Authorization"); auth != "Bearer test-key" {
+					t.Errorf("Authorization = %q, want %q", auth, "Bearer test-key")
+				}
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{
+					"choices": [{"index": 0, "message": {"role": "assistant", "content": "{\"ok\":true}"}, "finish_reason": "stop"}],
+					"usage": {"prompt_tokens": 12, "completion_tokens": 4, "total_tokens": 16}
+				}`))
+			}, nil)
+
+			completion, err := provider.CreateCompletion(context.Background(), CompletionRequest{
+				Model: "test-model",
+				Messages: []Message{
+					{Role: RoleSystem, Content: "Be brief."},
+					{Role: RoleUser, Content: "Hi"},
+					{Role: RoleAssistant, Content: "Hello"},
+					{Role: RoleUser, Content: "Answer in JSON"},
+				},
+				MaxTokens:        64,
+				Temperature:      1.5,
+				PresencePenalty:  0.25,
+				FrequencyPenalty: 0.5,
+				JSON:             true,
+			})
+			if err != nil {
+				t.Fatalf("CreateCompletion: %v", err)
+			}
+
+			if got.Model != "test-model" || got.MaxTokens != 64 || got.Temperature != 1.5 ||
+				got.PresencePenalty != 0.25 || got.FrequencyPenalty != 0.5 {
+				t.Errorf("parameters = %+v", got)
+			}
+			if got.Stream {
+				t.Error("non-streaming request asked for a stream")
+			}
+			if got.ResponseFormat == nil || got.ResponseFormat.Type != "json_object" {
+				t.Errorf("response_format = %+v, want json_object", got.ResponseFormat)
+			}
+
+			var roles, contents []string
+			for _, msg := range got.Messages {
+				roles = append(roles, msg.Role)
+				contents = append(contents, msg.Content)
+			}
+			// System messages stay in the message list
+			if want := []string{"system", "user", "assistant", "user"}; !reflect.DeepEqual(roles, want) {
+				t.Errorf("roles = %v, want %v", roles, want)
+			}
+			if want := []string{"Be brief.", "Hi", "Hello", "Answer in JSON"}; !reflect.DeepEqual(contents, want) {
+				t.Errorf("contents = %v, want %v", contents, want)
+			}
+
+			want := &Completion{
+				Content:      `{"ok":true}`,
+				FinishReason: "stop",
+				Usage:        Usage{PromptTokens: 12, CompletionTokens: 4, TotalTokens: 16},
+			}
+			if !reflect.DeepEqual(completion, want) {
+				t.Errorf("completion = %+v, want %+v", completion, want)
+			}
+		})
+	}
+}
+
+func TestOpenAIWithoutJSONModeOmitsResponseFormat(t *testing.T) {
+	var got openAITestRequest
+	provider := newTestProvider(t, BackendOpenAI, func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "Hi"}, "finish_reason": "stop"}]}`))
+	}, nil)
+
+	if _, err := provider.CreateCompletion(context.Background(), CompletionRequest{Model: "test-model"}); err != nil {
+		t.Fatalf("CreateCompletion: %v", err)
+	}
+	if got.ResponseFormat != nil {
+		t.Errorf("response_format = %+v, want none", got.ResponseFormat)
+	}
+}
+
+func TestOpenAIEmptyChoices(t *testing.T) {
+	provider := newTestProvider(t, BackendOpenAI, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": []}`))
+	}, nil)
+
+	_, err := provider.CreateCompletion(context.Background(), CompletionRequest{Model: "test-model"})
+	if err != ErrEmptyCompletion {
+		t.Fatalf("err = %v, want %v", err, ErrEmptyCompletion)
+	}
+}
+
+func TestOpenAIStreamCompletion(t *testing.T) {
+	for _, backend := range openAIBackends {
+		t.Run(backend, func(t *testing.T) {
+			var got openAITestRequest
+			provider := newTestProvider(t, backend, func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&got)
+				writeSSE(w,
+					`data: {"choices":[{"index":0,"delta":{"role":"assistant"}}]}`,
+					`data: {"choices":[{"index":0,"delta":{"content":"Hel"}}]}`,
+					`data: {"choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+					`data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+					// The usage chunk has no choices
+					`data: {"choices":[],"usage":{"prompt_tokens":7,"completion_tokens":2,"total_tokens":9}}`,
+					`data: [DONE]`,
+				)
+			}, nil)
+
+			var deltas []string
+			completion, err := provider.StreamCompletion(context.Background(), CompletionRequest{Model: "test-model"}, func(delta string) error {
+				deltas = append(deltas, delta)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("StreamCompletion: %v", err)
+			}
+
+			if !got.Stream || got.StreamOptions == nil || !got.StreamOptions.IncludeUsage {
+				t.Errorf("stream = %v, stream_options = %+v, want a stream that includes usage", got.Stream, got.StreamOptions)
+			}
+			if want := []string{"Hel", "lo"}; !reflect.DeepEqual(deltas, want) {
+				t.Errorf("deltas = %q, want %q", deltas, want)
+			}
+			want := &Completion{
+				Content:      "Hello",
+				FinishReason: "stop",
+				Usage:        Usage{PromptTokens: 7, CompletionTokens: 2, TotalTokens: 9},
+			}
+			if !reflect.DeepEqual(completion, want) {
+				t.Errorf("completion = %+v, want %+v", completion, want)
+			}
+		})
+	}
+}
+
+func TestOpenAIListModels(t *testing.T) {
+	provider := newTestProvider(t, BackendOpenAICompatible, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" {
+			t.Errorf("path = %s, want /v1/models", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object": "list", "data": [{"id": "llama3"}, {"id": "mistral"}]}`))
+	}, nil)
+
+	models, err := provider.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels: %v", err)
+	}
+	if want := []string{"llama3", "mistral"}; !reflect.DeepEqual(models, want) {
+		t.Errorf("models = %v, want %v", models, want)
+	}
+}
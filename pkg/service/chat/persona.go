@@ -0,0 +1,80 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"log"
+)
+
+var ErrUnknownPersona = errors.New("unknown or disabled persona")
+
+// PersonaSource looks up personas, typically backed by the personas table.
+type PersonaSource interface {
+	// FindPersona returns nil without an error when no persona has the ID.
+	FindPersona(id string) (*domain.Persona, error)
+	GetDefaultPersona() (*domain.Persona, error)
+}
+
+// SetPersonas enables per-request personas. Without a source every request
+// uses the global prompt and config.
+func (s *GPTService) SetPersonas(personas PersonaSource) {
+	s.configMutex.Lock()
+	defer s.configMutex.Unlock()
+	s.personas = personas
+}
+
+// resolvePersona returns the requested persona, or the default one when id
+// is empty. A missing default is not an error: the global prompt and config
+// apply. Only a persona that does not exist or is disabled is unknown;
+// failing to look it up is an error of our own.
+func (s *GPTService) resolvePersona(personas PersonaSource, id string) (*domain.Persona, error) {
+	if personas == nil {
+		if id != "" {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPersona, id)
+		}
+		return nil, nil
+	}
+
+	if id == "" {
+		persona, err := personas.GetDefaultPersona()
+		if err != nil {
+			log.Println("Failed to load default persona: " + err.Error())
+			return nil, nil
+		}
+		return persona, nil
+	}
+
+	persona, err := personas.FindPersona(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load persona %s: %w", id, err)
+	}
+	if persona == nil || !persona.Enabled {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPersona, id)
+	}
+	return persona, nil
+}
+
+// applyOverrides overlays a persona's or variant's settings on the prompt
+// and config.
+func applyOverrides(overrides domain.Overrides, prompt string, config Config) (string, Config) {
+	if overrides.SystemPrompt != "" {
+		prompt = overrides.SystemPrompt
+	}
+	if overrides.Model != "" {
+		config.Model = overrides.Model
+	}
+	if overrides.MaxTokens != nil {
+		config.MaxTokens = *overrides.MaxTokens
+	}
+	if overrides.Temperature != nil {
+		config.Temperature = *overrides.Temperature
+	}
+	if overrides.PresencePenalty != nil {
+		config.PresencePenalty = *overrides.PresencePenalty
+	}
+	if overrides.FrequencyPenalty != nil {
+		config.FrequencyPenalty = *overrides.FrequencyPenalty
+	}
+	return prompt, config
+}
@@ -0,0 +1,154 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Supported provider backends.
+const (
+	BackendOpenAI           = "openai"
+	BackendOpenAICompatible = "openai-compatible"
+	BackendAnthropic        = "anthropic"
+)
+
+type Role string
+
+const (
+	RoleSystem    Role = "system"
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
+
+func (r Role) Valid() bool {
+	switch r {
+	case RoleSystem, RoleUser, RoleAssistant:
+		return true
+	default:
+		return false
+	}
+}
+
+type Message struct {
+	Role      Role      `json:"role"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CompletionRequest is the provider-neutral form of a chat completion call.
+// Backends ignore parameters they do not support.
+type CompletionRequest struct {
+	Model            string
+	Messages         []Message
+	MaxTokens        int
+	Temperature      float32
+	PresencePenalty  float32
+	FrequencyPenalty float32
+	// JSON asks for a single JSON object. Backends without a JSON mode rely
+	// on the prompt saying so.
+	JSON bool
+}
+
+type Completion struct {
+	Content      string `json:"content"`
+	FinishReason string `json:"finish_reason,omitempty"`
+	Usage        Usage  `json:"usage"`
+}
+
+// Provider is a chat completion backend.
+type Provider interface {
+	Name() string
+	CreateCompletion(ctx context.Context, req CompletionRequest) (*Completion, error)
+	// StreamCompletion hands every content delta to onDelta as it arrives and
+	// returns the assembled completion once the stream ends.
+	StreamCompletion(ctx context.Context, req CompletionRequest, onDelta func(string) error) (*Completion, error)
+	// ListModels returns the IDs of the models the backend serves.
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+type ProviderConfig struct {
+	Backend string
+	APIKey  string
+	// BaseURL overrides the backend's default endpoint. It is required for
+	// BackendOpenAICompatible.
+	BaseURL string
+	// HTTPClient defaults to http.DefaultClient when nil.
+	HTTPClient *http.Client
+}
+
+// ProviderError is returned when a backend answers with a non-success status.
+type ProviderError struct {
+	Provider   string
+	StatusCode int
+	Type       string
+	Message    string
+	// RetryAfter is the delay the backend asked for, if any.
+	RetryAfter time.Duration
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s: HTTP %d: %s", e.Provider, e.StatusCode, e.Message)
+}
+
+// RetryDelay implements retry.RetryAfterError.
+func (e *ProviderError) RetryDelay() time.Duration {
+	return e.RetryAfter
+}
+
+// parseRetryAfter reads the delay from retry-after-ms or Retry-After, which
+// holds either seconds or an HTTP date.
+func parseRetryAfter(header http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("retry-after-ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+func NewProvider(config ProviderConfig) (Provider, error) {
+	switch config.Backend {
+	case BackendOpenAI, "":
+		if config.APIKey == "" {
+			return nil, fmt.Errorf("%s backend requires an API key", BackendOpenAI)
+		}
+		return NewOpenAIProvider(BackendOpenAI, config.APIKey, config.BaseURL, config.HTTPClient), nil
+	case BackendOpenAICompatible:
+		if config.BaseURL == "" {
+			return nil, fmt.Errorf("%s backend requires a base URL", BackendOpenAICompatible)
+		}
+		return NewOpenAIProvider(BackendOpenAICompatible, config.APIKey, config.BaseURL, config.HTTPClient), nil
+	case BackendAnthropic:
+		if config.APIKey == "" {
+			return nil, fmt.Errorf("%s backend requires an API key", BackendAnthropic)
+		}
+		return NewAnthropicProvider(config.APIKey, config.BaseURL, config.HTTPClient), nil
+	default:
+		return nil, fmt.Errorf("unknown provider backend %q", config.Backend)
+	}
+}
+
+// DefaultModel returns the model used when none is configured, or an empty
+// string if the backend has no sensible default.
+func DefaultModel(backend string) string {
+	switch backend {
+	case BackendOpenAI, "":
+		return "gpt-4o"
+	case BackendAnthropic:
+		return "claude-3-5-sonnet-latest"
+	default:
+		return ""
+	}
+}
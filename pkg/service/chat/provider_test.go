@@ -0,0 +1,190 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testBackends = []string{BackendOpenAI, BackendOpenAICompatible, BackendAnthropic}
+
+// newTestProvider points a backend at a test server running handler. The
+// OpenAI backends are given a /v1 base URL, like the real endpoints.
+func newTestProvider(t *testing.T, backend string, handler http.HandlerFunc, client *http.Client) Provider {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	baseURL := server.URL
+	if backend != BackendAnthropic {
+		baseURL += "/v1"
+	}
+	provider, err := NewProvider(ProviderConfig{
+		Backend:    backend,
+		APIKey:     "test-key",
+		BaseURL:    baseURL,
+		HTTPClient: client,
+	})
+	if err != nil {
+		t.Fatalf("NewProvider(%s): %v", backend, err)
+	}
+	return provider
+}
+
+// writeSSE writes server-sent events, flushing after each so the client
+// sees them one at a time.
+func writeSSE(w http.ResponseWriter, events ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	for _, event := range events {
+		w.Write([]byte(event + "\n\n"))
+		w.(http.Flusher).Flush()
+	}
+}
+
+func TestProviderErrorClassification(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		want       error
+		wantDelay  time.Duration
+	}{
+		{name: "rate limited", status: http.StatusTooManyRequests, retryAfter: "2", want: ErrRateLimited, wantDelay: 2 * time.Second},
+		{name: "server error", status: http.StatusInternalServerError, want: ErrUpstreamUnavailable},
+		{name: "unavailable", status: http.StatusServiceUnavailable, want: ErrUpstreamUnavailable},
+		{name: "gateway timeout", status: http.StatusGatewayTimeout, want: ErrTimeout},
+		{name: "unauthorized", status: http.StatusUnauthorized, want: ErrUpstreamUnavailable},
+		{name: "bad request", status: http.StatusBadRequest, want: ErrInvalidRequest},
+	}
+
+	for _, backend := range testBackends {
+		for _, tt := range tests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				provider := newTestProvider(t, backend, func(w http.ResponseWriter, r *http.Request) {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(tt.status)
+					w.Write([]byte(`{"type":"error","error":{"type":"test_error","message":"failed on purpose"}}`))
+				}, nil)
+
+				_, err := provider.CreateCompletion(context.Background(), CompletionRequest{Model: "test-model", MaxTokens: 16})
+				classified := classifyError(err)
+				if !errors.Is(classified, tt.want) {
+					t.Fatalf("classifyError(%v) = %v, want %v", err, classified, tt.want)
+				}
+
+				var providerErr *ProviderError
+				if !errors.As(err, &providerErr) {
+					t.Fatalf("error %v is not a ProviderError", err)
+				}
+				if providerErr.StatusCode != tt.status {
+					t.Errorf("StatusCode = %d, want %d", providerErr.StatusCode, tt.status)
+				}
+				if providerErr.RetryDelay() != tt.wantDelay {
+					t.Errorf("RetryDelay() = %s, want %s", providerErr.RetryDelay(), tt.wantDelay)
+				}
+			})
+		}
+	}
+}
+
+func TestProviderStreamErrorClassification(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend, func(t *testing.T) {
+			provider := newTestProvider(t, backend, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write([]byte(`{"error":{"type":"rate_limit_error","message":"slow down"}}`))
+			}, nil)
+
+			_, err := provider.StreamCompletion(context.Background(), CompletionRequest{Model: "test-model"}, func(string) error {
+				t.Error("onDelta called for a failed stream")
+				return nil
+			})
+			if classified := classifyError(err); !errors.Is(classified, ErrRateLimited) {
+				t.Fatalf("classifyError(%v) = %v, want %v", err, classified, ErrRateLimited)
+			}
+		})
+	}
+}
+
+func TestProviderTimeoutClassification(t *testing.T) {
+	tests := []struct {
+		name string
+		// call fails the request by timing it out one way or another
+		call func(provider Provider) error
+		// client is handed to the provider, for client-side timeouts
+		client *http.Client
+	}{
+		{
+			name: "context deadline",
+			call: func(provider Provider) error {
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+				_, err := provider.CreateCompletion(ctx, CompletionRequest{Model: "test-model"})
+				return err
+			},
+		},
+		{
+			name: "client timeout",
+			call: func(provider Provider) error {
+				_, err := provider.CreateCompletion(context.Background(), CompletionRequest{Model: "test-model"})
+				return err
+			},
+			client: &http.Client{Timeout: 50 * time.Millisecond},
+		},
+	}
+
+	for _, backend := range testBackends {
+		for _, tt := range tests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				done := make(chan struct{})
+				defer close(done)
+				provider := newTestProvider(t, backend, func(w http.ResponseWriter, r *http.Request) {
+					select {
+					case <-r.Context().Done():
+					case <-done:
+					}
+				}, tt.client)
+
+				err := tt.call(provider)
+				if classified := classifyError(err); !errors.Is(classified, ErrTimeout) {
+					t.Fatalf("classifyError(%v) = %v, want %v", err, classified, ErrTimeout)
+				}
+			})
+		}
+	}
+}
+
+func TestProviderCancellationIsNotClassified(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			defer close(done)
+			provider := newTestProvider(t, backend, func(w http.ResponseWriter, r *http.Request) {
+				cancel()
+				select {
+				case <-r.Context().Done():
+				case <-done:
+				}
+			}, nil)
+
+			_, err := provider.CreateCompletion(ctx, CompletionRequest{Model: "test-model"})
+			classified := classifyError(err)
+			if !errors.Is(classified, context.Canceled) {
+				t.Fatalf("classifyError(%v) = %v, want context.Canceled", err, classified)
+			}
+			if errors.Is(classified, ErrUpstreamUnavailable) || errors.Is(classified, ErrTimeout) {
+				t.Errorf("cancellation was classified as a provider failure: %v", classified)
+			}
+		})
+	}
+}
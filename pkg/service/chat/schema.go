@@ -0,0 +1,204 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidSchema is returned for a schema that uses an unknown type or
+	// contradicts itself.
+	ErrInvalidSchema = errors.New("invalid JSON schema")
+	// ErrSchemaViolation is returned when model output does not match the
+	// requested schema, even after asking for a correction.
+	ErrSchemaViolation = errors.New("output does not match the schema")
+)
+
+// Schema is the subset of JSON Schema that structured output is checked
+// against: types, object properties, array items, bounds and enums.
+type Schema struct {
+	Type        string             `json:"type"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	// AdditionalProperties defaults to true, as in JSON Schema.
+	AdditionalProperties *bool   `json:"additionalProperties,omitempty"`
+	Items                *Schema `json:"items,omitempty"`
+	MinItems             *int    `json:"minItems,omitempty"`
+	MaxItems             *int    `json:"maxItems,omitempty"`
+	MinLength            *int    `json:"minLength,omitempty"`
+	MaxLength            *int    `json:"maxLength,omitempty"`
+	// Format is "date" (2006-01-02) or "date-time" (RFC 3339) for strings.
+	Format string `json:"format,omitempty"`
+	Enum   []any  `json:"enum,omitempty"`
+}
+
+var schemaFormats = map[string]string{
+	"date":      time.DateOnly,
+	"date-time": time.RFC3339,
+}
+
+// Check reports whether the schema itself is usable.
+func (s *Schema) Check() error {
+	return s.check("$")
+}
+
+func (s *Schema) check(path string) error {
+	switch s.Type {
+	case "object":
+		for _, name := range s.Required {
+			if _, ok := s.Properties[name]; !ok {
+				return fmt.Errorf("%w: %s requires undeclared property %q", ErrInvalidSchema, path, name)
+			}
+		}
+		for name, property := range s.Properties {
+			if property == nil {
+				return fmt.Errorf("%w: %s.%s has no schema", ErrInvalidSchema, path, name)
+			}
+			if err := property.check(path + "." + name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		if s.Items == nil {
+			return fmt.Errorf("%w: %s is an array without items", ErrInvalidSchema, path)
+		}
+		if s.MinItems != nil && s.MaxItems != nil && *s.MinItems > *s.MaxItems {
+			return fmt.Errorf("%w: %s has minItems above maxItems", ErrInvalidSchema, path)
+		}
+		return s.Items.check(path + "[]")
+	case "string":
+		if _, ok := schemaFormats[s.Format]; s.Format != "" && !ok {
+			return fmt.Errorf("%w: %s has unsupported format %q", ErrInvalidSchema, path, s.Format)
+		}
+	case "number", "integer", "boolean":
+	default:
+		return fmt.Errorf("%w: %s has unsupported type %q", ErrInvalidSchema, path, s.Type)
+	}
+	return nil
+}
+
+// Validate parses data and checks it against the schema. The error names the
+// first offending path, which is fed back to the model on a retry.
+func (s *Schema) Validate(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("%w: not valid JSON: %w", ErrSchemaViolation, err)
+	}
+	if decoder.More() {
+		return fmt.Errorf("%w: trailing data after the JSON value", ErrSchemaViolation)
+	}
+	return s.validate("$", value)
+}
+
+func (s *Schema) validate(path string, value any) error {
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return violation(path, "expected an object")
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				return violation(path, fmt.Sprintf("missing required property %q", name))
+			}
+		}
+		for name, field := range object {
+			property, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return violation(path, fmt.Sprintf("unexpected property %q", name))
+				}
+				continue
+			}
+			if err := property.validate(path+"."+name, field); err != nil {
+				return err
+			}
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return violation(path, "expected an array")
+		}
+		if s.MinItems != nil && len(array) < *s.MinItems {
+			return violation(path, fmt.Sprintf("expected at least %d items, got %d", *s.MinItems, len(array)))
+		}
+		if s.MaxItems != nil && len(array) > *s.MaxItems {
+			return violation(path, fmt.Sprintf("expected at most %d items, got %d", *s.MaxItems, len(array)))
+		}
+		for i, item := range array {
+			if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return violation(path, "expected a string")
+		}
+		length := len([]rune(text))
+		if s.MinLength != nil && length < *s.MinLength {
+			return violation(path, fmt.Sprintf("expected at least %d characters", *s.MinLength))
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return violation(path, fmt.Sprintf("expected at most %d characters", *s.MaxLength))
+		}
+		if layout, ok := schemaFormats[s.Format]; ok {
+			if _, err := time.Parse(layout, text); err != nil {
+				return violation(path, "expected a "+s.Format+" such as "+layout)
+			}
+		}
+	case "number", "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return violation(path, "expected a "+s.Type)
+		}
+		if _, err := number.Int64(); s.Type == "integer" && err != nil {
+			return violation(path, "expected an integer")
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return violation(path, "expected a boolean")
+		}
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		return violation(path, "value is not one of the allowed values")
+	}
+	return nil
+}
+
+func violation(path string, problem string) error {
+	return fmt.Errorf("%w: %s: %s", ErrSchemaViolation, path, problem)
+}
+
+func inEnum(enum []any, value any) bool {
+	if number, ok := value.(json.Number); ok {
+		value, _ = number.Float64()
+	}
+	for _, allowed := range enum {
+		if reflect.DeepEqual(allowed, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractJSON strips the prose or code fences models sometimes put around a
+// JSON object.
+func extractJSON(content string) string {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return strings.TrimSpace(content)
+	}
+	return content[start : end+1]
+}
@@ -0,0 +1,262 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var ErrInvalidSummaryOptions = errors.New("invalid summary options")
+
+type SummaryLength string
+
+const (
+	SummaryShort    SummaryLength = "short"
+	SummaryMedium   SummaryLength = "medium"
+	SummaryDetailed SummaryLength = "detailed"
+)
+
+type SummaryFormat string
+
+const (
+	SummaryProse       SummaryFormat = "prose"
+	SummaryBullets     SummaryFormat = "bullets"
+	SummaryActionItems SummaryFormat = "action_items"
+	// SummaryJSON replies with an object matching SummaryOptions.Schema, or
+	// DefaultSummarySchema when none is given.
+	SummaryJSON SummaryFormat = "json"
+)
+
+// SummaryOptions shapes a summary. The zero value is a medium length prose
+// summary in the conversation's own language.
+type SummaryOptions struct {
+	Length SummaryLength `json:"length,omitempty"`
+	Format SummaryFormat `json:"format,omitempty"`
+	// Language is the language to write in, such as "German" or "es".
+	Language string  `json:"language,omitempty"`
+	Schema   *Schema `json:"schema,omitempty"`
+}
+
+func intPtr(n int) *int { return &n }
+
+// DefaultSummarySchema backs the app's "key takeaways" and "your next 3
+// actions" cards.
+var DefaultSummarySchema = &Schema{
+	Type: "object",
+	Properties: map[string]*Schema{
+		"key_takeaways": {
+			Type:        "array",
+			Description: "The most important insights from the conversation, one sentence each",
+			Items:       &Schema{Type: "string", MinLength: intPtr(1)},
+			MinItems:    intPtr(1),
+			MaxItems:    intPtr(5),
+		},
+		"next_actions": {
+			Type:        "array",
+			Description: "Exactly three concrete actions the user should take next, most important first",
+			Items:       &Schema{Type: "string", MinLength: intPtr(1)},
+			MinItems:    intPtr(3),
+			MaxItems:    intPtr(3),
+		},
+	},
+	Required:             []string{"key_takeaways", "next_actions"},
+	AdditionalProperties: new(bool),
+}
+
+// Validate checks the options and fills in defaults.
+func (o *SummaryOptions) Validate() error {
+	switch o.Length {
+	case "":
+		o.Length = SummaryMedium
+	case SummaryShort, SummaryMedium, SummaryDetailed:
+	default:
+		return fmt.Errorf("%w: unknown length %q", ErrInvalidSummaryOptions, o.Length)
+	}
+
+	switch o.Format {
+	case "":
+		o.Format = SummaryProse
+	case SummaryProse, SummaryBullets, SummaryActionItems:
+	case SummaryJSON:
+		if o.Schema == nil {
+			o.Schema = DefaultSummarySchema
+		}
+		if o.Schema.Type != "object" {
+			return fmt.Errorf("%w: schema must describe an object", ErrInvalidSummaryOptions)
+		}
+		if err := o.Schema.Check(); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidSummaryOptions, err)
+		}
+	default:
+		return fmt.Errorf("%w: unknown format %q", ErrInvalidSummaryOptions, o.Format)
+	}
+	if o.Schema != nil && o.Format != SummaryJSON {
+		return fmt.Errorf("%w: schema requires the json format", ErrInvalidSummaryOptions)
+	}
+
+	o.Language = strings.TrimSpace(o.Language)
+	if len(o.Language) > 40 || strings.IndexFunc(o.Language, notLanguageRune) >= 0 {
+		return fmt.Errorf("%w: invalid language %q", ErrInvalidSummaryOptions, o.Language)
+	}
+	return nil
+}
+
+// notLanguageRune keeps instructions out of the language field, which is
+// pasted into the prompt.
+func notLanguageRune(r rune) bool {
+	return !unicode.IsLetter(r) && r != ' ' && r != '-' && r != '(' && r != ')'
+}
+
+// maxTokens is the completion budget per length. JSON needs room for
+// its syntax, so it never gets less than the medium budget.
+func (o SummaryOptions) maxTokens() int {
+	tokens := 400
+	switch o.Length {
+	case SummaryShort:
+		tokens = 150
+	case SummaryDetailed:
+		tokens = 1000
+	}
+	if o.Format == SummaryJSON {
+		tokens = max(tokens, 400)
+	}
+	return tokens
+}
+
+// instructions is the system prompt for the summary.
+func (o SummaryOptions) instructions() string {
+	var prompt strings.Builder
+	prompt.WriteString("You are a helpful assistant that summarizes coaching conversations between a user and an assistant.")
+
+	switch o.Length {
+	case SummaryShort:
+		prompt.WriteString(" Keep it very short: two or three sentences, or at most three items.")
+	case SummaryMedium:
+		prompt.WriteString(" Keep it concise: one paragraph, or at most six items.")
+	case SummaryDetailed:
+		prompt.WriteString(" Be thorough and cover every topic, decision and open question.")
+	}
+
+	switch o.Format {
+	case SummaryProse:
+		prompt.WriteString(" Write flowing prose without headings or lists.")
+	case SummaryBullets:
+		prompt.WriteString(" Write a bullet list, one point per line, each starting with \"- \".")
+	case SummaryActionItems:
+		prompt.WriteString(" List only the concrete actions the user committed to or should take, one per line, each starting with \"- [ ] \" and an imperative verb.")
+	case SummaryJSON:
+		schema, _ := json.Marshal(o.Schema)
+		prompt.WriteString(" Reply with a single JSON object and nothing else. It must match this JSON Schema:\n")
+		prompt.Write(schema)
+	}
+
+	if o.Language != "" {
+		fmt.Fprintf(&prompt, "\nWrite the summary in %s, whatever language the conversation is in.", o.Language)
+	}
+	return prompt.String()
+}
+
+func (s *GPTService) Summarize(ctx context.Context, messages []Message, options SummaryOptions) (Result, error) {
+	if err := options.Validate(); err != nil {
+		return Result{}, err
+	}
+	request, callTimeout := s.summaryRequest(messages, options)
+
+	var result Result
+	var err error
+	if options.Format == SummaryJSON {
+		result, err = s.completeJSON(ctx, callTimeout, request, options.Schema.Validate)
+	} else {
+		err = s.retryPolicy.Do(ctx, func(ctx context.Context) error {
+			var err error
+			result, err = s.complete(ctx, callTimeout, request)
+			return err
+		})
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("error generating summary: %w", err)
+	}
+
+	return result, nil
+}
+
+// summaryRequest builds the completion request for validated options, using
+// the runtime config for everything but the length.
+func (s *GPTService) summaryRequest(messages []Message, options SummaryOptions) (CompletionRequest, time.Duration) {
+	s.configMutex.RLock()
+	config := s.config
+	s.configMutex.RUnlock()
+
+	request := CompletionRequest{
+		Model: config.Model,
+		Messages: []Message{
+			{
+				Role:    RoleSystem,
+				Content: options.instructions(),
+			},
+			{
+				Role:    RoleUser,
+				Content: "Summarize the following conversation:\n\n" + formatTranscript(messages),
+			},
+		},
+		MaxTokens:        options.maxTokens(),
+		Temperature:      config.Temperature,
+		PresencePenalty:  config.PresencePenalty,
+		FrequencyPenalty: config.FrequencyPenalty,
+		JSON:             options.Format == SummaryJSON,
+	}
+	return request, config.callTimeout()
+}
+
+// schemaAttempts is how many times a model gets to produce JSON matching the
+// schema. Every retry shows it what was wrong with the previous reply.
+const schemaAttempts = 3
+
+// completeJSON asks for JSON that passes validate, typically Schema.Validate.
+// validate should wrap ErrSchemaViolation so a model that never gets it
+// right is reported as such. On success Content is the compacted object and
+// Data holds the same bytes; Usage covers every attempt.
+func (s *GPTService) completeJSON(ctx context.Context, timeout time.Duration, request CompletionRequest, validate func([]byte) error) (Result, error) {
+	request.Messages = append([]Message(nil), request.Messages...)
+
+	var usage Usage
+	var lastErr error
+	for attempt := 0; attempt < schemaAttempts; attempt++ {
+		var result Result
+		err := s.retryPolicy.Do(ctx, func(ctx context.Context) error {
+			var err error
+			result, err = s.complete(ctx, timeout, request)
+			return err
+		})
+		if err != nil {
+			return Result{}, err
+		}
+		usage.PromptTokens += result.Usage.PromptTokens
+		usage.CompletionTokens += result.Usage.CompletionTokens
+		usage.TotalTokens += result.Usage.TotalTokens
+
+		raw := extractJSON(result.Content)
+		if lastErr = validate([]byte(raw)); lastErr == nil {
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, []byte(raw)); err != nil {
+				return Result{}, err
+			}
+			result.Content = compact.String()
+			result.Data = json.RawMessage(compact.Bytes())
+			result.Usage = usage
+			return result, nil
+		}
+
+		request.Messages = append(request.Messages,
+			Message{Role: RoleAssistant, Content: result.Content},
+			Message{Role: RoleUser, Content: "That reply is invalid (" + lastErr.Error() + "). Reply again with only the corrected JSON object."},
+		)
+	}
+
+	return Result{}, lastErr
+}
@@ -0,0 +1,126 @@
+package chat
+
+import (
+	"github.com/pkoukk/tiktoken-go"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// BPETokenizer counts tokens exactly, with the byte-pair encoding of an
+// OpenAI model.
+type BPETokenizer struct {
+	encoding *tiktoken.Tiktoken
+}
+
+func (t BPETokenizer) CountTokens(text string) int {
+	return len(t.encoding.EncodeOrdinary(text))
+}
+
+// bpeEncoding is a vocabulary that is loaded once, in the background.
+type bpeEncoding struct {
+	name     string
+	load     sync.Once
+	encoding atomic.Pointer[tiktoken.Tiktoken]
+	// failure is why the vocabulary could not be loaded
+	failure atomic.Pointer[string]
+}
+
+// bpeEncodings holds a *bpeEncoding per encoding name.
+var bpeEncodings sync.Map
+
+// approximatedModels holds the models without a vocabulary that have been
+// logged.
+var approximatedModels sync.Map
+
+// TokenizerFor returns the tokenizer for a model: a BPETokenizer for OpenAI
+// models, and ApproxTokenizer as the fallback for every other model. The
+// vocabulary is fetched from OpenAI the first time a model needs it, and
+// cached in TIKTOKEN_CACHE_DIR; until it has loaded, or if it cannot be
+// loaded, the model gets ApproxTokenizer too. TokenizerStatusFor reports
+// which a model gets.
+func TokenizerFor(model string) Tokenizer {
+	name, ok := encodingName(model)
+	if !ok {
+		if _, logged := approximatedModels.LoadOrStore(model, true); !logged {
+			log.Printf("No vocabulary for model %s, approximating its token counts", model)
+		}
+		return ApproxTokenizer{}
+	}
+
+	value, _ := bpeEncodings.LoadOrStore(name, &bpeEncoding{name: name})
+	encoding := value.(*bpeEncoding)
+	encoding.load.Do(func() {
+		go encoding.fetch()
+	})
+	if loaded := encoding.encoding.Load(); loaded != nil {
+		return BPETokenizer{encoding: loaded}
+	}
+	return ApproxTokenizer{}
+}
+
+func (e *bpeEncoding) fetch() {
+	loaded, err := tiktoken.GetEncoding(e.name)
+	if err != nil {
+		failure := err.Error()
+		e.failure.Store(&failure)
+		log.Printf("Failed to load the %s vocabulary, approximating token counts until restart: %s", e.name, failure)
+		return
+	}
+	e.encoding.Store(loaded)
+	log.Printf("Loaded the %s vocabulary", e.name)
+}
+
+const (
+	CounterBPE         = "bpe"
+	CounterApproximate = "approximate"
+)
+
+// TokenizerStatus tells whether a model's budgets count tokens exactly, and
+// if not, why.
+type TokenizerStatus struct {
+	Counter  string `json:"counter"`
+	Encoding string `json:"encoding,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// TokenizerStatusFor reports the tokenizer TokenizerFor currently returns for
+// a model, without starting to load its vocabulary.
+func TokenizerStatusFor(model string) TokenizerStatus {
+	name, ok := encodingName(model)
+	if !ok {
+		return TokenizerStatus{Counter: CounterApproximate, Reason: "no vocabulary for this model"}
+	}
+
+	status := TokenizerStatus{Counter: CounterApproximate, Encoding: name}
+	value, ok := bpeEncodings.Load(name)
+	if !ok {
+		status.Reason = "vocabulary not loaded yet"
+		return status
+	}
+	encoding := value.(*bpeEncoding)
+	switch {
+	case encoding.encoding.Load() != nil:
+		status.Counter = CounterBPE
+	case encoding.failure.Load() != nil:
+		status.Reason = "failed to load the vocabulary: " + *encoding.failure.Load()
+	default:
+		status.Reason = "loading the vocabulary"
+	}
+	return status
+}
+
+// encodingName looks up the encoding of an OpenAI model, by exact name or by
+// the prefix of a dated snapshot such as gpt-4o-2024-08-06.
+func encodingName(model string) (string, bool) {
+	if name, ok := tiktoken.MODEL_TO_ENCODING[model]; ok {
+		return name, true
+	}
+	for prefix, name := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if strings.HasPrefix(model, prefix) {
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,53 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+)
+
+// stubEncoding replaces an encoding's entry in bpeEncodings for the test,
+// without fetching the vocabulary.
+func stubEncoding(t *testing.T, encoding *bpeEncoding) {
+	t.Helper()
+
+	encoding.load.Do(func() {})
+	previous, ok := bpeEncodings.Load(encoding.name)
+	bpeEncodings.Store(encoding.name, encoding)
+	t.Cleanup(func() {
+		if ok {
+			bpeEncodings.Store(encoding.name, previous)
+		} else {
+			bpeEncodings.Delete(encoding.name)
+		}
+	})
+}
+
+func TestTokenizerStatusFor(t *testing.T) {
+	failure := "connection refused"
+	failed := &bpeEncoding{name: "cl100k_base"}
+	failed.failure.Store(&failure)
+	stubEncoding(t, failed)
+	stubEncoding(t, &bpeEncoding{name: "o200k_base"})
+
+	tests := []struct {
+		name     string
+		model    string
+		encoding string
+		reason   string
+	}{
+		{name: "no vocabulary", model: "claude-3-5-sonnet-latest", reason: "no vocabulary"},
+		{name: "failed to load", model: "gpt-4", encoding: "cl100k_base", reason: failure},
+		{name: "loading", model: "gpt-4o-2024-08-06", encoding: "o200k_base", reason: "loading"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := TokenizerStatusFor(tt.model)
+			if status.Counter != CounterApproximate || status.Encoding != tt.encoding || !strings.Contains(status.Reason, tt.reason) {
+				t.Errorf("status = %+v, want approximate %q with reason containing %q", status, tt.encoding, tt.reason)
+			}
+			if _, ok := TokenizerFor(tt.model).(ApproxTokenizer); !ok {
+				t.Errorf("TokenizerFor(%s) is not ApproxTokenizer", tt.model)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package nudge
+
+import (
+	"context"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"log"
+)
+
+// Notifier tells the user a nudge is waiting, for example with a push
+// notification. The nudge is already in the inbox, so a failed delivery
+// loses nothing.
+type Notifier interface {
+	Notify(ctx context.Context, nudge domain.Nudge) error
+}
+
+// LogNotifier stands in for a real push service: it only logs the nudge.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, nudge domain.Nudge) error {
+	log.Printf("Nudge %s for user %s: %s", nudge.ID, nudge.UserID, nudge.Content)
+	return nil
+}
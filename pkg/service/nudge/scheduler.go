@@ -0,0 +1,199 @@
+package nudge
+
+import (
+	"context"
+	"fmt"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/fgb-andu/hustl-api/pkg/service/chat"
+	"log"
+	"time"
+)
+
+// DefaultInterval is how often the scheduler looks for due nudges. It bounds
+// how late after send_at a nudge arrives.
+const DefaultInterval = 15 * time.Minute
+
+// Store holds the opt-ins and the inbox nudges are written to.
+type Store interface {
+	ListEnabledNudgeSettings() ([]domain.NudgeSettings, error)
+	HasNudge(userID string, day string) (bool, error)
+	CreateNudge(nudge domain.Nudge) (*domain.Nudge, error)
+	MarkNudgeDelivered(id string, at time.Time) error
+}
+
+// LocaleSource looks up the language a user's nudges are written in.
+type LocaleSource interface {
+	UserLocale(userID string) (domain.Locale, error)
+}
+
+// UsageRecorder records the tokens a nudge cost, next to the usage of
+// replies.
+type UsageRecorder interface {
+	RecordNudgeUsage(userID string, promptVersionID string, model string, promptTokens int, completionTokens int) error
+}
+
+// Scheduler sends every opted-in user one nudge a day, at or after their
+// send_at time and outside their quiet hours. A nudge that could not be
+// generated is tried again on the next tick.
+type Scheduler struct {
+	nudger   chat.NudgeGenerator
+	store    Store
+	locales  LocaleSource
+	usage    UsageRecorder
+	notifier Notifier
+	interval time.Duration
+}
+
+func NewScheduler(nudger chat.NudgeGenerator, store Store, locales LocaleSource, usage UsageRecorder, notifier Notifier, interval time.Duration) *Scheduler {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Scheduler{
+		nudger:   nudger,
+		store:    store,
+		locales:  locales,
+		usage:    usage,
+		notifier: notifier,
+		interval: interval,
+	}
+}
+
+// Run ticks right away and then every interval until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if sent := s.Tick(ctx, time.Now()); sent > 0 {
+			log.Printf("Sent %d nudges", sent)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick sends the nudges that are due at now and returns how many were
+// stored. Users are handled one after another so a large batch does not
+// flood the provider.
+func (s *Scheduler) Tick(ctx context.Context, now time.Time) int {
+	users, err := s.store.ListEnabledNudgeSettings()
+	if err != nil {
+		log.Println("Failed to list nudge settings: " + err.Error())
+		return 0
+	}
+
+	sent := 0
+	for _, settings := range users {
+		if ctx.Err() != nil {
+			break
+		}
+		local, ok := Due(settings, now)
+		if !ok {
+			continue
+		}
+		exists, err := s.store.HasNudge(settings.UserID, local.Format(time.DateOnly))
+		if err != nil {
+			log.Println(err.Error())
+			continue
+		}
+		if exists {
+			continue
+		}
+		if err := s.send(ctx, settings.UserID, local); err != nil {
+			log.Println(err.Error())
+			continue
+		}
+		sent++
+	}
+	return sent
+}
+
+// send generates, stores and delivers a nudge. Canned fallbacks are not
+// personal, so they are dropped and the nudge is retried later.
+func (s *Scheduler) send(ctx context.Context, userID string, local time.Time) error {
+	locale, err := s.locales.UserLocale(userID)
+	if err != nil {
+		return fmt.Errorf("failed to look up locale for user %s: %w", userID, err)
+	}
+
+	result, err := s.nudger.GenerateNudge(ctx, userID, locale, local)
+	if err != nil {
+		return fmt.Errorf("failed to generate nudge for user %s: %w", userID, err)
+	}
+	if result.Fallback {
+		return fmt.Errorf("skipped nudge for user %s: %s", userID, result.FallbackReason)
+	}
+	err = s.usage.RecordNudgeUsage(userID, result.PromptVersionID, result.Model, result.Usage.PromptTokens, result.Usage.CompletionTokens)
+	if err != nil {
+		log.Println(err.Error())
+	}
+
+	nudge, err := s.store.CreateNudge(domain.Nudge{
+		UserID:  userID,
+		Day:     local.Format(time.DateOnly),
+		Content: result.Content,
+		Model:   result.Model,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.notifier.Notify(ctx, *nudge); err != nil {
+		log.Printf("Failed to deliver nudge %s: %s", nudge.ID, err.Error())
+		return nil
+	}
+	if err := s.store.MarkNudgeDelivered(nudge.ID, time.Now()); err != nil {
+		log.Println(err.Error())
+	}
+	return nil
+}
+
+// Due reports whether a nudge may be sent to the user at now, and returns
+// now in the user's time zone. Settings that do not parse are never due.
+func Due(settings domain.NudgeSettings, now time.Time) (time.Time, bool) {
+	location, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		return time.Time{}, false
+	}
+	local := now.In(location)
+	minute := local.Hour()*60 + local.Minute()
+
+	sendAt, ok := parseClock(settings.SendAt)
+	if !ok || minute < sendAt {
+		return local, false
+	}
+	if settings.QuietStart == "" || settings.QuietEnd == "" {
+		return local, true
+	}
+
+	start, ok := parseClock(settings.QuietStart)
+	if !ok {
+		return local, false
+	}
+	end, ok := parseClock(settings.QuietEnd)
+	if !ok {
+		return local, false
+	}
+	return local, !inQuietHours(minute, start, end)
+}
+
+// inQuietHours handles quiet hours that wrap past midnight, such as 22:00 to
+// 07:00. Equal ends mean no quiet hours.
+func inQuietHours(minute int, start int, end int) bool {
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// parseClock turns HH:MM into minutes after midnight.
+func parseClock(clock string) (int, bool) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
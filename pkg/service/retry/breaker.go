@@ -0,0 +1,162 @@
+package retry
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type State string
+
+const (
+	StateClosed   State = "closed"
+	StateOpen     State = "open"
+	StateHalfOpen State = "half-open"
+)
+
+// Breaker stops calls to an unhealthy dependency. After Threshold
+// consecutive failures it opens and rejects calls for Cooldown, then lets a
+// single probe through; the probe's outcome closes or re-opens it.
+//
+// Every change of state starts a new generation. Allow hands out the current
+// one, and an outcome reported for another generation is ignored: a call
+// that started before the breaker opened says nothing about the probe.
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu            sync.Mutex
+	state         State
+	generation    uint64
+	failures      int
+	openedAt      time.Time
+	probeInFlight bool
+	lastFailure   string
+	lastFailureAt time.Time
+}
+
+type BreakerStatus struct {
+	Name                string     `json:"name"`
+	State               State      `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+	LastFailure         string     `json:"last_failure,omitempty"`
+	LastFailureAt       *time.Time `json:"last_failure_at,omitempty"`
+}
+
+func NewBreaker(name string, threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     StateClosed,
+	}
+}
+
+// Allow reports whether a call may proceed and returns the generation to
+// report its outcome for. It returns ErrCircuitOpen while the breaker is
+// open or a half-open probe is already running.
+func (b *Breaker) Allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return 0, ErrCircuitOpen
+		}
+		log.Printf("Circuit %s half-open, probing", b.name)
+		b.setState(StateHalfOpen)
+		b.probeInFlight = true
+	case StateHalfOpen:
+		if b.probeInFlight {
+			return 0, ErrCircuitOpen
+		}
+		b.probeInFlight = true
+	}
+	return b.generation, nil
+}
+
+// Success reports that a call of the generation succeeded.
+func (b *Breaker) Success(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+	if b.state != StateClosed {
+		log.Printf("Circuit %s closed", b.name)
+		b.setState(StateClosed)
+	}
+	b.failures = 0
+}
+
+// Failure reports that a call of the generation failed.
+func (b *Breaker) Failure(generation uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+	b.failures++
+	b.lastFailure = err.Error()
+	b.lastFailureAt = time.Now()
+
+	if b.state == StateHalfOpen || b.failures >= b.threshold {
+		log.Printf("Circuit %s open after %d failures", b.name, b.failures)
+		b.setState(StateOpen)
+		b.openedAt = time.Now()
+	}
+}
+
+// Release ends a call of the generation whose outcome says nothing about the
+// dependency's health, such as a cancelled request. A released probe lets
+// the next call probe instead.
+func (b *Breaker) Release(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation == b.generation {
+		b.probeInFlight = false
+	}
+}
+
+// setState moves to state and starts a new generation.
+func (b *Breaker) setState(state State) {
+	b.state = state
+	b.generation++
+	b.probeInFlight = false
+}
+
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{
+		Name:                b.name,
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		LastFailure:         b.lastFailure,
+	}
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.cooldown {
+		status.State = StateHalfOpen
+	}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		retryAt := b.openedAt.Add(b.cooldown)
+		status.OpenedAt = &openedAt
+		status.RetryAt = &retryAt
+	}
+	if !b.lastFailureAt.IsZero() {
+		lastFailureAt := b.lastFailureAt
+		status.LastFailureAt = &lastFailureAt
+	}
+	return status
+}
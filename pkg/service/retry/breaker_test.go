@@ -0,0 +1,231 @@
+package retry
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+const (
+	testThreshold = 3
+	testCooldown  = time.Minute
+)
+
+var errDown = errors.New("dependency down")
+
+// open trips the breaker with threshold failures.
+func open(t *testing.T, b *Breaker) {
+	t.Helper()
+
+	for range testThreshold {
+		generation, err := b.Allow()
+		if err != nil {
+			t.Fatalf("Allow while closed = %v", err)
+		}
+		b.Failure(generation, errDown)
+	}
+	if b.state != StateOpen {
+		t.Fatalf("state after %d failures = %s, want %s", testThreshold, b.state, StateOpen)
+	}
+}
+
+// coolDown lets the cooldown pass.
+func coolDown(b *Breaker) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.openedAt = time.Now().Add(-testCooldown)
+}
+
+// probe lets the cooldown pass and starts the half-open probe.
+func probe(t *testing.T, b *Breaker) uint64 {
+	t.Helper()
+
+	coolDown(b)
+	generation, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow after cooldown = %v", err)
+	}
+	if b.state != StateHalfOpen {
+		t.Fatalf("state after cooldown = %s, want %s", b.state, StateHalfOpen)
+	}
+	return generation
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, b *Breaker)
+		want State
+		// wantAllow is the error of the next call
+		wantAllow error
+	}{
+		{
+			name: "stays closed below the threshold",
+			run: func(t *testing.T, b *Breaker) {
+				for range testThreshold - 1 {
+					generation, _ := b.Allow()
+					b.Failure(generation, errDown)
+				}
+			},
+			want: StateClosed,
+		},
+		{
+			name: "success resets the count",
+			run: func(t *testing.T, b *Breaker) {
+				for range 2 {
+					for range testThreshold - 1 {
+						generation, _ := b.Allow()
+						b.Failure(generation, errDown)
+					}
+					generation, _ := b.Allow()
+					b.Success(generation)
+				}
+			},
+			want: StateClosed,
+		},
+		{
+			name:      "opens at the threshold",
+			run:       open,
+			want:      StateOpen,
+			wantAllow: ErrCircuitOpen,
+		},
+		{
+			name: "rejects calls during the cooldown",
+			run: func(t *testing.T, b *Breaker) {
+				open(t, b)
+				b.mu.Lock()
+				b.openedAt = time.Now().Add(-testCooldown / 2)
+				b.mu.Unlock()
+			},
+			want:      StateOpen,
+			wantAllow: ErrCircuitOpen,
+		},
+		{
+			name: "lets a single probe through after the cooldown",
+			run: func(t *testing.T, b *Breaker) {
+				open(t, b)
+				probe(t, b)
+			},
+			want:      StateHalfOpen,
+			wantAllow: ErrCircuitOpen,
+		},
+		{
+			name: "probe success closes",
+			run: func(t *testing.T, b *Breaker) {
+				open(t, b)
+				b.Success(probe(t, b))
+			},
+			want: StateClosed,
+		},
+		{
+			name: "probe failure re-opens",
+			run: func(t *testing.T, b *Breaker) {
+				open(t, b)
+				b.Failure(probe(t, b), errDown)
+			},
+			want:      StateOpen,
+			wantAllow: ErrCircuitOpen,
+		},
+		{
+			name: "released probe lets another probe through",
+			run: func(t *testing.T, b *Breaker) {
+				open(t, b)
+				b.Release(probe(t, b))
+			},
+			want: StateHalfOpen,
+		},
+		{
+			name: "stale success does not close an open circuit",
+			run: func(t *testing.T, b *Breaker) {
+				// Starts while closed, finishes after the circuit opened
+				stale, _ := b.Allow()
+				open(t, b)
+				b.Success(stale)
+			},
+			want:      StateOpen,
+			wantAllow: ErrCircuitOpen,
+		},
+		{
+			name: "stale success does not close a half-open circuit",
+			run: func(t *testing.T, b *Breaker) {
+				stale, _ := b.Allow()
+				open(t, b)
+				probe(t, b)
+				b.Success(stale)
+			},
+			want:      StateHalfOpen,
+			wantAllow: ErrCircuitOpen,
+		},
+		{
+			name: "stale release does not free the probe",
+			run: func(t *testing.T, b *Breaker) {
+				stale, _ := b.Allow()
+				open(t, b)
+				probe(t, b)
+				b.Release(stale)
+			},
+			want:      StateHalfOpen,
+			wantAllow: ErrCircuitOpen,
+		},
+		{
+			name: "stale failure does not re-open a closed circuit",
+			run: func(t *testing.T, b *Breaker) {
+				var stale []uint64
+				for range testThreshold {
+					generation, _ := b.Allow()
+					stale = append(stale, generation)
+				}
+				open(t, b)
+				b.Success(probe(t, b))
+				for _, generation := range stale {
+					b.Failure(generation, errDown)
+				}
+			},
+			want: StateClosed,
+		},
+		{
+			name: "outcome of an earlier probe is ignored",
+			run: func(t *testing.T, b *Breaker) {
+				open(t, b)
+				first := probe(t, b)
+				b.Failure(first, errDown)
+				probe(t, b)
+				b.Success(first)
+			},
+			want:      StateHalfOpen,
+			wantAllow: ErrCircuitOpen,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBreaker("test", testThreshold, testCooldown)
+			tt.run(t, b)
+
+			if b.state != tt.want {
+				t.Errorf("state = %s, want %s", b.state, tt.want)
+			}
+			if _, err := b.Allow(); !errors.Is(err, tt.wantAllow) {
+				t.Errorf("Allow = %v, want %v", err, tt.wantAllow)
+			}
+		})
+	}
+}
+
+func TestBreakerStatus(t *testing.T) {
+	b := NewBreaker("test", testThreshold, testCooldown)
+	open(t, b)
+
+	status := b.Status()
+	if status.State != StateOpen || status.ConsecutiveFailures != testThreshold || status.LastFailure != errDown.Error() {
+		t.Errorf("status = %+v", status)
+	}
+	if status.RetryAt == nil || !status.RetryAt.Equal(status.OpenedAt.Add(testCooldown)) {
+		t.Errorf("RetryAt = %v, want cooldown after OpenedAt %v", status.RetryAt, status.OpenedAt)
+	}
+
+	// Once the cooldown has passed, the next call probes
+	coolDown(b)
+	if status := b.Status(); status.State != StateHalfOpen {
+		t.Errorf("state after cooldown = %s, want %s", status.State, StateHalfOpen)
+	}
+}
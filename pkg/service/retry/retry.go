@@ -0,0 +1,105 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RetryAfterError is implemented by errors that carry a server-requested
+// delay, typically taken from a Retry-After header.
+type RetryAfterError interface {
+	error
+	RetryDelay() time.Duration
+}
+
+// Policy retries an operation with exponential backoff and full jitter.
+type Policy struct {
+	// MaxAttempts includes the first attempt.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Budget bounds the whole operation, waits included. Zero means no bound
+	// beyond the caller's context.
+	Budget time.Duration
+	// Retryable decides whether an error is worth another attempt. Nil
+	// retries every error.
+	Retryable func(error) bool
+}
+
+var DefaultPolicy = Policy{
+	MaxAttempts: 3,
+	BaseDelay:   250 * time.Millisecond,
+	MaxDelay:    4 * time.Second,
+	Budget:      20 * time.Second,
+}
+
+var (
+	random     = rand.New(rand.NewSource(time.Now().UnixNano()))
+	randomLock sync.Mutex
+)
+
+// Do calls fn until it succeeds, returns a non-retryable error, runs out of
+// attempts or would exceed the budget. It returns the last error.
+func (p Policy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if p.Budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Budget)
+		defer cancel()
+	}
+
+	var err error
+	for attempt := 0; attempt < max(p.MaxAttempts, 1); attempt++ {
+		if attempt > 0 {
+			delay := p.delay(attempt, err)
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+				log.Printf("Retry budget exhausted after %d attempts", attempt)
+				return err
+			}
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+		}
+
+		if err = fn(ctx); err == nil {
+			return nil
+		}
+		if p.Retryable != nil && !p.Retryable(err) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// delay returns how long to wait before the given attempt. A server-requested
+// delay takes precedence over the backoff.
+func (p Policy) delay(attempt int, err error) time.Duration {
+	var retryAfter RetryAfterError
+	if errors.As(err, &retryAfter) && retryAfter.RetryDelay() > 0 {
+		return retryAfter.RetryDelay()
+	}
+
+	backoff := p.BaseDelay << (attempt - 1)
+	if backoff <= 0 || (p.MaxDelay > 0 && backoff > p.MaxDelay) {
+		backoff = p.MaxDelay
+	}
+	if backoff <= 0 {
+		return 0
+	}
+
+	randomLock.Lock()
+	defer randomLock.Unlock()
+	return time.Duration(random.Int63n(int64(backoff) + 1))
+}
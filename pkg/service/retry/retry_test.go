@@ -0,0 +1,200 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errTransient = errors.New("transient failure")
+
+// retryAfterError asks for a delay, like a 429 with Retry-After.
+type retryAfterError struct {
+	delay time.Duration
+}
+
+func (e retryAfterError) Error() string {
+	return "rate limited"
+}
+
+func (e retryAfterError) RetryDelay() time.Duration {
+	return e.delay
+}
+
+func TestDelayJitterBounds(t *testing.T) {
+	policy := Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		name    string
+		policy  Policy
+		attempt int
+		max     time.Duration
+	}{
+		{name: "first retry", policy: policy, attempt: 1, max: 100 * time.Millisecond},
+		{name: "second retry doubles", policy: policy, attempt: 2, max: 200 * time.Millisecond},
+		{name: "fourth retry", policy: policy, attempt: 4, max: 800 * time.Millisecond},
+		{name: "capped at MaxDelay", policy: policy, attempt: 5, max: time.Second},
+		{name: "shift overflow is capped", policy: policy, attempt: 80, max: time.Second},
+		{name: "no MaxDelay", policy: Policy{BaseDelay: time.Second}, attempt: 3, max: 4 * time.Second},
+		{name: "no delays", policy: Policy{}, attempt: 2, max: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var longest time.Duration
+			for range 1000 {
+				delay := tt.policy.delay(tt.attempt, errTransient)
+				if delay < 0 || delay > tt.max {
+					t.Fatalf("delay(%d) = %s, want between 0 and %s", tt.attempt, delay, tt.max)
+				}
+				longest = max(longest, delay)
+			}
+			// Full jitter spreads delays over the whole range
+			if longest < tt.max/2 {
+				t.Errorf("longest of 1000 delays = %s, want some above %s", longest, tt.max/2)
+			}
+		})
+	}
+}
+
+func TestDelayHonoursRetryAfter(t *testing.T) {
+	policy := Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		name string
+		err  error
+		want time.Duration
+	}{
+		{name: "shorter than backoff", err: retryAfterError{delay: 10 * time.Millisecond}, want: 10 * time.Millisecond},
+		// The server knows best, even beyond MaxDelay; the budget bounds it
+		{name: "longer than MaxDelay", err: retryAfterError{delay: 3 * time.Second}, want: 3 * time.Second},
+		{name: "wrapped", err: errors.Join(errTransient, retryAfterError{delay: 50 * time.Millisecond}), want: 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.delay(1, tt.err); got != tt.want {
+				t.Errorf("delay = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// Without a delay, the backoff applies
+	if got := policy.delay(1, retryAfterError{}); got > 100*time.Millisecond {
+		t.Errorf("delay without Retry-After = %s, want at most the backoff", got)
+	}
+}
+
+func TestDo(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		// errs are returned by successive attempts; attempts past the end
+		// succeed
+		errs         []error
+		wantErr      error
+		wantAttempts int
+		// maxElapsed bounds how long Do may take
+		maxElapsed time.Duration
+	}{
+		{
+			name:         "succeeds after retries",
+			policy:       Policy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+			errs:         []error{errTransient, errTransient},
+			wantAttempts: 3,
+			maxElapsed:   time.Second,
+		},
+		{
+			name:         "runs out of attempts",
+			policy:       Policy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+			errs:         []error{errTransient, errTransient, errTransient, errTransient},
+			wantErr:      errTransient,
+			wantAttempts: 3,
+			maxElapsed:   time.Second,
+		},
+		{
+			name: "stops at a non-retryable error",
+			policy: Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, Retryable: func(err error) bool {
+				return !errors.Is(err, context.DeadlineExceeded)
+			}},
+			errs:         []error{context.DeadlineExceeded},
+			wantErr:      context.DeadlineExceeded,
+			wantAttempts: 1,
+			maxElapsed:   time.Second,
+		},
+		{
+			name:         "waits for Retry-After",
+			policy:       Policy{MaxAttempts: 2, BaseDelay: time.Hour, MaxDelay: time.Hour},
+			errs:         []error{retryAfterError{delay: 20 * time.Millisecond}},
+			wantAttempts: 2,
+			maxElapsed:   time.Second,
+		},
+		{
+			name:         "gives up when Retry-After exceeds the budget",
+			policy:       Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, Budget: 100 * time.Millisecond},
+			errs:         []error{retryAfterError{delay: time.Hour}},
+			wantErr:      retryAfterError{delay: time.Hour},
+			wantAttempts: 1,
+			maxElapsed:   50 * time.Millisecond,
+		},
+		{
+			name:         "budget exhausted by failing attempts",
+			policy:       Policy{MaxAttempts: 1000, BaseDelay: 10 * time.Millisecond, MaxDelay: 10 * time.Millisecond, Budget: 100 * time.Millisecond},
+			errs:         repeat(errTransient, 1000),
+			wantErr:      errTransient,
+			maxElapsed:   200 * time.Millisecond,
+			wantAttempts: -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			start := time.Now()
+			err := tt.policy.Do(context.Background(), func(ctx context.Context) error {
+				attempts++
+				if attempts <= len(tt.errs) {
+					return tt.errs[attempts-1]
+				}
+				return nil
+			})
+			elapsed := time.Since(start)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do = %v, want %v", err, tt.wantErr)
+			}
+			switch {
+			case tt.wantAttempts >= 0 && attempts != tt.wantAttempts:
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			case tt.wantAttempts < 0 && (attempts < 2 || attempts >= len(tt.errs)):
+				t.Errorf("attempts = %d, want several but fewer than %d", attempts, len(tt.errs))
+			}
+			if elapsed > tt.maxElapsed {
+				t.Errorf("Do took %s, want at most %s", elapsed, tt.maxElapsed)
+			}
+		})
+	}
+}
+
+func TestDoBudgetBoundsAttempt(t *testing.T) {
+	policy := Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, Budget: 50 * time.Millisecond}
+
+	attempts := 0
+	err := policy.Do(context.Background(), func(ctx context.Context) error {
+		attempts++
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Do = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1 once the budget ran out", attempts)
+	}
+}
+
+func repeat(err error, n int) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
@@ -0,0 +1,228 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	jwtdecode "github.com/fgb-andu/hustl-api/internal"
+	"github.com/fgb-andu/hustl-api/pkg/domain"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+const (
+	// DefaultIssuer is the iss and aud of our access tokens.
+	DefaultIssuer = "hustl-api"
+	// DefaultAccessTTL keeps access tokens short-lived: they cannot be
+	// revoked, only left to expire.
+	DefaultAccessTTL = 15 * time.Minute
+	// DefaultRefreshTTL is how long a session may go unused before the user
+	// has to sign in again. Every refresh starts it over.
+	DefaultRefreshTTL = 30 * 24 * time.Hour
+
+	// accessTokenType is the typ header of access tokens, per RFC 9068.
+	accessTokenType = "at+jwt"
+	// refreshTokenBytes is the entropy of a refresh token.
+	refreshTokenBytes = 32
+)
+
+var (
+	ErrInvalidAccessToken  = errors.New("access token is invalid or expired")
+	ErrInvalidRefreshToken = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used")
+)
+
+// Store keeps refresh tokens, typically backed by the refresh_tokens table.
+type Store interface {
+	GetRefreshToken(tokenHash string) (*domain.RefreshToken, error)
+	CreateRefreshToken(token domain.RefreshToken) (*domain.RefreshToken, error)
+	RotateRefreshToken(usedID string, next domain.RefreshToken) (*domain.RefreshToken, bool, error)
+	RevokeRefreshTokenFamily(familyID string) error
+}
+
+// Options configure a Manager. Zero values take the defaults above.
+type Options struct {
+	Issuer     string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// Tokens are the credentials of a session.
+type Tokens struct {
+	// AccessToken is a JWT naming the user in sub, sent as a bearer token.
+	AccessToken string
+	// AccessTTL is how long the access token is valid for.
+	AccessTTL time.Duration
+	// RefreshToken is an opaque token that buys new Tokens once.
+	RefreshToken string
+}
+
+// Manager issues our own sessions: short-lived access tokens signed with
+// our keys, and refresh tokens that are replaced on every use.
+type Manager struct {
+	keys       *jwtdecode.SigningKeys
+	store      Store
+	issuer     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func NewManager(keys *jwtdecode.SigningKeys, store Store, options Options) *Manager {
+	if options.Issuer == "" {
+		options.Issuer = DefaultIssuer
+	}
+	if options.AccessTTL <= 0 {
+		options.AccessTTL = DefaultAccessTTL
+	}
+	if options.RefreshTTL <= 0 {
+		options.RefreshTTL = DefaultRefreshTTL
+	}
+
+	return &Manager{
+		keys:       keys,
+		store:      store,
+		issuer:     options.Issuer,
+		accessTTL:  options.AccessTTL,
+		refreshTTL: options.RefreshTTL,
+	}
+}
+
+// Keys are the keys access tokens are signed with, for publishing.
+func (m *Manager) Keys() *jwtdecode.SigningKeys {
+	return m.keys
+}
+
+// Issue starts a new session for the user.
+func (m *Manager) Issue(userID string) (*Tokens, error) {
+	refreshToken, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	_, err = m.store.CreateRefreshToken(domain.RefreshToken{
+		UserID:    userID,
+		TokenHash: hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(m.refreshTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m.tokens(userID, refreshToken, now)
+}
+
+// Refresh exchanges a refresh token for new tokens. The refresh token can be
+// used once: presenting it again revokes the whole session, since either it
+// or its replacement is in the wrong hands.
+func (m *Manager) Refresh(refreshToken string) (*Tokens, error) {
+	used, err := m.store.GetRefreshToken(hashRefreshToken(refreshToken))
+	if err != nil {
+		log.Println("Failed to load refresh token: " + err.Error())
+		return nil, ErrInvalidRefreshToken
+	}
+
+	now := time.Now()
+	if used.RevokedAt != nil || !now.Before(used.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if used.RotatedAt != nil {
+		return nil, m.revoke(used)
+	}
+
+	next, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	_, rotated, err := m.store.RotateRefreshToken(used.ID, domain.RefreshToken{
+		UserID:    used.UserID,
+		FamilyID:  used.FamilyID,
+		TokenHash: hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(m.refreshTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// Another request used the token first
+		return nil, m.revoke(used)
+	}
+
+	return m.tokens(used.UserID, next, now)
+}
+
+func (m *Manager) revoke(used *domain.RefreshToken) error {
+	log.Printf("Refresh token %s of user %s was used twice", used.ID, used.UserID)
+	if err := m.store.RevokeRefreshTokenFamily(used.FamilyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// Verify checks an access token and returns the ID of the user it was
+// issued to.
+func (m *Manager) Verify(accessToken string) (string, error) {
+	var claims jwt.StandardClaims
+	token, err := jwt.ParseWithClaims(accessToken, &claims, m.keys.Keyfunc(accessTokenType))
+	if err != nil || !token.Valid {
+		return "", fmt.Errorf("%w: %v", ErrInvalidAccessToken, err)
+	}
+
+	// jwt-go does not require exp
+	switch {
+	case claims.ExpiresAt == 0:
+		return "", fmt.Errorf("%w: missing exp", ErrInvalidAccessToken)
+	case !claims.VerifyIssuer(m.issuer, true), !claims.VerifyAudience(m.issuer, true):
+		return "", fmt.Errorf("%w: issued for another service", ErrInvalidAccessToken)
+	case claims.Subject == "":
+		return "", fmt.Errorf("%w: missing sub", ErrInvalidAccessToken)
+	}
+	return claims.Subject, nil
+}
+
+func (m *Manager) tokens(userID string, refreshToken string, now time.Time) (*Tokens, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := m.keys.Sign(jwt.StandardClaims{
+		Id:        id.String(),
+		Issuer:    m.issuer,
+		Audience:  m.issuer,
+		Subject:   userID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(m.accessTTL).Unix(),
+	}, accessTokenType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	return &Tokens{
+		AccessToken:  accessToken,
+		AccessTTL:    m.accessTTL,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// newRefreshToken returns a random token and the hash it is stored under.
+func newRefreshToken() (string, string, error) {
+	b := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashRefreshToken(token), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}